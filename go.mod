@@ -2,11 +2,21 @@ module github.com/strick-j/cybr-dpa
 
 go 1.21.4
 
-require golang.org/x/oauth2 v0.15.0
+require (
+	github.com/google/cel-go v0.17.8
+	golang.org/x/oauth2 v0.15.0
+	sigs.k8s.io/yaml v1.4.0
+)
 
 require (
+	github.com/antlr/antlr4/runtime/Go/antlr/v4 v4.0.0-20230305170008-8188dc5388df // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/stoewer/go-strcase v1.2.0 // indirect
+	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e // indirect
 	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20230525234035-dd9d682886f9 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
@@ -0,0 +1,542 @@
+package dpa
+
+import (
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// auditClock returns the time recorded in generated audit reports
+var auditClock = time.Now
+
+// AuditReport contains the tenant configuration documented by the audit
+// report writers. Settings and TargetSets are optional.
+type AuditReport struct {
+	Title       string                   `json:"title,omitempty"`
+	GeneratedAt time.Time                `json:"generatedAt"`
+	Policies    []types.Policy           `json:"policies"`
+	TargetSets  []types.TargetSetMapping `json:"targetSets,omitempty"`
+	Settings    *types.Settings          `json:"settings,omitempty"`
+}
+
+// BuildAuditReport fetches every policy, target set and the tenant settings
+// for an audit report.
+// Returns AuditReport or types.ErrorResponse based on the response from
+// the API. An error is returned on request failure.
+//
+// Example:
+//
+//	report, dpaerr, err := s.BuildAuditReport(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to build audit report. %s", err)
+//		return
+//	}
+//	report.Title = "DPA Access Review Q3"
+//	dpa.WriteAuditHTML(f, report)
+func (s *Service) BuildAuditReport(ctx context.Context) (*AuditReport, *types.ErrorResponse, error) {
+	policies, dpaerr, err := s.FetchPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buildAuditReport: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	targetSets, dpaerr, err := s.FetchTargetSets(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buildAuditReport: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	settings, dpaerr, err := s.ListSettings(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("buildAuditReport: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	return &AuditReport{
+		GeneratedAt: auditClock(),
+		Policies:    policies,
+		TargetSets:  []types.TargetSetMapping{*targetSets},
+		Settings:    settings,
+	}, &types.ErrorResponse{}, nil
+}
+
+// WriteAuditMarkdown writes the audit report as Markdown. Each policy has a
+// section describing its period, scopes and, per rule, the identities,
+// schedule in plain language and connect as users. The tenant settings and
+// target sets are summarized in tables.
+//
+// Example:
+//
+//	report := &dpa.AuditReport{Policies: policies, Settings: settings}
+//	if err := dpa.WriteAuditMarkdown(os.Stdout, report); err != nil {
+//		log.Fatalf("Failed to write audit report. %s", err)
+//		return
+//	}
+func WriteAuditMarkdown(w io.Writer, r *AuditReport) error {
+	if err := auditMarkdownTemplate.Execute(w, newAuditDocument(r)); err != nil {
+		return fmt.Errorf("writeAuditMarkdown: Failed to write report. %s", err)
+	}
+	return nil
+}
+
+// WriteAuditHTML writes the audit report as a standalone HTML page with the
+// content of WriteAuditMarkdown. Styles are inline, so the page can be
+// attached to an audit as a single file.
+//
+// Example:
+//
+//	f, _ := os.Create("dpa-access.html")
+//	defer f.Close()
+//
+//	if err := dpa.WriteAuditHTML(f, report); err != nil {
+//		log.Fatalf("Failed to write audit report. %s", err)
+//		return
+//	}
+func WriteAuditHTML(w io.Writer, r *AuditReport) error {
+	if err := auditHTMLTemplate.Execute(w, newAuditDocument(r)); err != nil {
+		return fmt.Errorf("writeAuditHTML: Failed to write report. %s", err)
+	}
+	return nil
+}
+
+// auditDocument is the plain-language content shared by the report formats
+type auditDocument struct {
+	Title      string
+	Generated  string
+	Summary    string
+	Policies   []auditPolicy
+	Settings   []auditSetting
+	TargetSets []auditTargetSet
+}
+
+type auditPolicy struct {
+	Name        string
+	ID          string
+	Status      string
+	Description string
+	Period      string
+	UpdatedOn   string
+	Scopes      []string
+	Rules       []auditRule
+}
+
+type auditRule struct {
+	Name       string
+	Identities []string
+	Schedule   string
+	Session    string
+	ConnectAs  []string
+}
+
+type auditSetting struct {
+	Feature string
+	Setting string
+	Value   string
+}
+
+type auditTargetSet struct {
+	Name                  string
+	Type                  string
+	SecretType            string
+	StrongAccountID       string
+	CertificateValidation string
+}
+
+// Builds the plain-language document of an audit report
+func newAuditDocument(r *AuditReport) auditDocument {
+	doc := auditDocument{Title: r.Title}
+	if len(doc.Title) == 0 {
+		doc.Title = "Dynamic Privileged Access Audit Report"
+	}
+	generated := r.GeneratedAt
+	if generated.IsZero() {
+		generated = auditClock()
+	}
+	doc.Generated = generated.UTC().Format("2006-01-02 15:04 MST")
+
+	policies := append([]types.Policy(nil), r.Policies...)
+	sort.SliceStable(policies, func(i, j int) bool {
+		return strings.ToLower(policies[i].PolicyName) < strings.ToLower(policies[j].PolicyName)
+	})
+
+	var enabled, rules int
+	for _, p := range policies {
+		if p.Status == types.PolicyStatusEnabled {
+			enabled++
+		}
+		rules += len(p.UserAccessRules)
+		doc.Policies = append(doc.Policies, newAuditPolicy(p))
+	}
+
+	for _, m := range r.TargetSets {
+		for _, ts := range m.TargetSets {
+			doc.TargetSets = append(doc.TargetSets, auditTargetSet{
+				Name:                  ts.Name,
+				Type:                  string(ts.Type),
+				SecretType:            ts.SecretType,
+				StrongAccountID:       m.StrongAccountID,
+				CertificateValidation: describeBool(ts.EnableCertificateValidation, "Enabled", "Disabled"),
+			})
+		}
+	}
+	if r.Settings != nil {
+		doc.Settings = auditSettings(*r.Settings)
+	}
+
+	doc.Summary = fmt.Sprintf("%s (%d enabled) with %s and %s.",
+		plural(len(policies), "policy", "policies"), enabled,
+		plural(rules, "access rule", "access rules"),
+		plural(len(doc.TargetSets), "target set", "target sets"))
+	return doc
+}
+
+// Describes a policy in plain language
+func newAuditPolicy(p types.Policy) auditPolicy {
+	ap := auditPolicy{
+		Name:        p.PolicyName,
+		ID:          p.PolicyID,
+		Status:      string(p.Status),
+		Description: p.Description,
+		UpdatedOn:   p.UpdatedOn,
+	}
+
+	switch {
+	case len(p.StartDate) != 0 && len(p.EndDate) != 0:
+		ap.Period = fmt.Sprintf("From %s until %s", p.StartDate, p.EndDate)
+	case len(p.StartDate) != 0:
+		ap.Period = fmt.Sprintf("From %s with no end date", p.StartDate)
+	case len(p.EndDate) != 0:
+		ap.Period = fmt.Sprintf("Until %s", p.EndDate)
+	default:
+		ap.Period = "No start or end date"
+	}
+
+	providers := graphProviders(p.ProvidersData)
+	for _, provider := range providers {
+		ap.Scopes = append(ap.Scopes, fmt.Sprintf("%s: %s", provider, strings.Join(scopeDetails(policyScope(p, provider)), "; ")))
+	}
+
+	for _, r := range p.UserAccessRules {
+		ci := r.ConnectionInformation
+		rule := auditRule{
+			Name:       r.RuleName,
+			Identities: auditIdentities(r.UserData),
+			Schedule:   describeSchedulePlain(ci),
+			Session:    describeSession(ci),
+		}
+		for _, provider := range providers {
+			if users := connectAsUsers(ci.ConnectAs, provider); len(users) != 0 {
+				rule.ConnectAs = append(rule.ConnectAs, fmt.Sprintf("%s: %s", provider, strings.Join(users, ", ")))
+			}
+		}
+		ap.Rules = append(ap.Rules, rule)
+	}
+	return ap
+}
+
+// Lists the identities of a rule, e.g. "Role DevOps (IDENTITY)"
+func auditIdentities(u types.UserData) []string {
+	var ids []string
+	add := func(kind, name, source string) {
+		if len(source) != 0 {
+			name = fmt.Sprintf("%s (%s)", name, source)
+		}
+		ids = append(ids, kind+" "+name)
+	}
+	for _, r := range u.Roles {
+		add("Role", r.Name, r.Source)
+	}
+	for _, g := range u.Groups {
+		add("Group", g.Name, g.Source)
+	}
+	for _, user := range u.Users {
+		add("User", user.Name, user.Source)
+	}
+	return ids
+}
+
+// Describes a rule schedule in plain language, e.g. "Monday to Friday,
+// from 08:00 to 18:00 (America/New_York)"
+func describeSchedulePlain(ci types.ConnectionInformation) string {
+	days := "Every day"
+	if len(ci.DaysOfWeek) != 0 && len(ci.DaysOfWeek) != 7 {
+		days = describeDays(ci.DaysOfWeek)
+	}
+
+	hours := "at any time"
+	if !ci.FullDays && (len(ci.HoursFrom) != 0 || len(ci.HoursTo) != 0) {
+		hours = fmt.Sprintf("from %s to %s", ci.HoursFrom, ci.HoursTo)
+		if from, to := ci.HoursFrom, ci.HoursTo; len(from) != 0 && len(to) != 0 && to <= from {
+			hours += " the next day"
+		}
+	}
+
+	tz := ci.TimeZone
+	if len(tz) == 0 {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%s, %s (%s)", days, hours, tz)
+}
+
+// Describes the days of a schedule. Runs of three or more consecutive days
+// are written as a range, e.g. "Monday to Friday and Sunday".
+func describeDays(days []types.DayOfWeek) string {
+	var parts []string
+	for wd := 0; wd < 7; {
+		if !containsDay(days, time.Weekday(wd)) {
+			wd++
+			continue
+		}
+		end := wd
+		for end+1 < 7 && containsDay(days, time.Weekday(end+1)) {
+			end++
+		}
+		switch {
+		case end-wd >= 2:
+			parts = append(parts, fmt.Sprintf("%s to %s", time.Weekday(wd), time.Weekday(end)))
+		default:
+			for d := wd; d <= end; d++ {
+				parts = append(parts, time.Weekday(d).String())
+			}
+		}
+		wd = end + 1
+	}
+
+	if len(parts) <= 1 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+func containsDay(days []types.DayOfWeek, wd time.Weekday) bool {
+	for _, d := range days {
+		if d == shortWeekday(wd) {
+			return true
+		}
+	}
+	return false
+}
+
+// Describes the session limits of a rule
+func describeSession(ci types.ConnectionInformation) string {
+	var parts []string
+	if ci.GrantAccess != 0 {
+		parts = append(parts, fmt.Sprintf("access is granted for %s at a time", plural(ci.GrantAccess, "hour", "hours")))
+	}
+	if ci.IdleTime != 0 {
+		parts = append(parts, fmt.Sprintf("idle sessions end after %s", plural(ci.IdleTime, "minute", "minutes")))
+	}
+	if len(parts) == 0 {
+		return "Default session limits"
+	}
+	s := strings.Join(parts, ", ")
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// Summarizes the tenant settings, one row per setting
+func auditSettings(s types.Settings) []auditSetting {
+	var rows []auditSetting
+	add := func(feature, setting, value string) {
+		rows = append(rows, auditSetting{Feature: feature, Setting: setting, Value: value})
+	}
+
+	mfa := deref(s.MfaCaching)
+	add("MFA caching", "Enabled", describeBool(mfa.IsMfaCachingEnabled, "Yes", "No"))
+	add("MFA caching", "Key expiration", describeInt(mfa.KeyExpirationTimeSec, "second", "seconds"))
+
+	sa := deref(s.StandingAccess)
+	add("Standing access", "Available", describeBool(sa.StandingAccessAvailable, "Yes", "No"))
+	add("Standing access", "Maximum session duration", describeInt(sa.SessionMaxDuration, "hour", "hours"))
+	add("Standing access", "Session idle time", describeInt(sa.SessionIdleTime, "minute", "minutes"))
+
+	audit := deref(s.SSHCommandAudit)
+	add("SSH command audit", "Command parsing", describeBool(audit.IsCommandParsingForAuditEnabled, "Enabled", "Disabled"))
+	prompt := "Not configured"
+	if audit.ShellPromptForAudit != nil {
+		prompt = *audit.ShellPromptForAudit
+	}
+	add("SSH command audit", "Shell prompt", prompt)
+
+	add("RDP file transfer", "Enabled", describeBool(deref(s.RdpFileTransfer).Enabled, "Yes", "No"))
+	add("Certificate validation", "Enabled", describeBool(deref(s.CertificateValidation).Enabled, "Yes", "No"))
+	return rows
+}
+
+func describeBool(b *bool, yes, no string) string {
+	switch {
+	case b == nil:
+		return "Not configured"
+	case *b:
+		return yes
+	}
+	return no
+}
+
+func describeInt(i *int, one, many string) string {
+	if i == nil {
+		return "Not configured"
+	}
+	return plural(*i, one, many)
+}
+
+// Returns the count with the singular or plural noun, e.g. "2 hours"
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// Escapes Markdown formatting characters, including the table separator
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", "&lt;", ">", "&gt;", "|", `\|`, "#", `\#`, "\n", " ",
+)
+
+var auditMarkdownTemplate = template.Must(template.New("audit.md").Funcs(template.FuncMap{
+	"md": markdownEscaper.Replace,
+}).Parse(`# {{ md .Title }}
+
+Generated {{ .Generated }}. {{ .Summary }}
+
+## Policies
+{{ range .Policies }}
+### {{ md .Name }}
+
+- **Status:** {{ md .Status }}
+{{- if .ID }}
+- **Policy ID:** {{ md .ID }}
+{{- end }}
+{{- if .Description }}
+- **Description:** {{ md .Description }}
+{{- end }}
+- **Period:** {{ md .Period }}
+{{- if .UpdatedOn }}
+- **Last updated:** {{ md .UpdatedOn }}
+{{- end }}
+- **Targets:**
+{{- range .Scopes }}
+  - {{ md . }}
+{{- else }} None
+{{- end }}
+{{ range .Rules }}
+#### Rule: {{ md .Name }}
+
+- **Who:** {{ range $i, $id := .Identities }}{{ if $i }}, {{ end }}{{ md $id }}{{ else }}Nobody{{ end }}
+- **When:** {{ md .Schedule }}
+- **Session:** {{ md .Session }}
+- **Connect as:** {{ range $i, $ca := .ConnectAs }}{{ if $i }}; {{ end }}{{ md $ca }}{{ else }}Not configured{{ end }}
+{{ end }}
+{{- else }}
+No policies are configured.
+{{ end }}
+{{- if .Settings }}
+## Tenant Settings
+
+| Feature | Setting | Value |
+|:--- |:--- |:--- |
+{{- range .Settings }}
+| {{ md .Feature }} | {{ md .Setting }} | {{ md .Value }} |
+{{- end }}
+{{ end }}
+{{- if .TargetSets }}
+## Target Sets
+
+| Name | Type | Secret Type | Strong Account | Certificate Validation |
+|:--- |:--- |:--- |:--- |:--- |
+{{- range .TargetSets }}
+| {{ md .Name }} | {{ md .Type }} | {{ md .SecretType }} | {{ md .StrongAccountID }} | {{ md .CertificateValidation }} |
+{{- end }}
+{{ end -}}
+`))
+
+var auditHTMLTemplate = htmltemplate.Must(htmltemplate.New("audit.html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+h1, h2 { border-bottom: 1px solid #d0d7de; padding-bottom: .3em; }
+section.policy { border: 1px solid #d0d7de; border-radius: 6px; padding: 0 1em 1em; margin-bottom: 1.5em; }
+dl { display: grid; grid-template-columns: max-content auto; gap: .25em 1em; }
+dt { font-weight: 600; }
+dd { margin: 0; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #d0d7de; padding: .4em .6em; text-align: left; }
+th { background: #f6f8fa; }
+.status-Enabled { color: #1a7f37; }
+.status-Disabled, .status-Expired { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p>Generated {{ .Generated }}. {{ .Summary }}</p>
+
+<h2>Policies</h2>
+{{- range .Policies }}
+<section class="policy">
+<h3>{{ .Name }}</h3>
+<dl>
+<dt>Status</dt><dd class="status-{{ .Status }}">{{ .Status }}</dd>
+{{- if .ID }}
+<dt>Policy ID</dt><dd>{{ .ID }}</dd>
+{{- end }}
+{{- if .Description }}
+<dt>Description</dt><dd>{{ .Description }}</dd>
+{{- end }}
+<dt>Period</dt><dd>{{ .Period }}</dd>
+{{- if .UpdatedOn }}
+<dt>Last updated</dt><dd>{{ .UpdatedOn }}</dd>
+{{- end }}
+<dt>Targets</dt><dd>{{ range $i, $s := .Scopes }}{{ if $i }}<br>{{ end }}{{ $s }}{{ else }}None{{ end }}</dd>
+</dl>
+{{- range .Rules }}
+<h4>Rule: {{ .Name }}</h4>
+<dl>
+<dt>Who</dt><dd>{{ range $i, $id := .Identities }}{{ if $i }}, {{ end }}{{ $id }}{{ else }}Nobody{{ end }}</dd>
+<dt>When</dt><dd>{{ .Schedule }}</dd>
+<dt>Session</dt><dd>{{ .Session }}</dd>
+<dt>Connect as</dt><dd>{{ range $i, $ca := .ConnectAs }}{{ if $i }}<br>{{ end }}{{ $ca }}{{ else }}Not configured{{ end }}</dd>
+</dl>
+{{- end }}
+</section>
+{{- else }}
+<p>No policies are configured.</p>
+{{- end }}
+{{- if .Settings }}
+
+<h2>Tenant Settings</h2>
+<table>
+<tr><th>Feature</th><th>Setting</th><th>Value</th></tr>
+{{- range .Settings }}
+<tr><td>{{ .Feature }}</td><td>{{ .Setting }}</td><td>{{ .Value }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .TargetSets }}
+
+<h2>Target Sets</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>Secret Type</th><th>Strong Account</th><th>Certificate Validation</th></tr>
+{{- range .TargetSets }}
+<tr><td>{{ .Name }}</td><td>{{ .Type }}</td><td>{{ .SecretType }}</td><td>{{ .StrongAccountID }}</td><td>{{ .CertificateValidation }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
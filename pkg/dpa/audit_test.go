@@ -0,0 +1,173 @@
+package dpa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestDescribeSchedulePlain(t *testing.T) {
+	var tests = []struct {
+		name string
+		ci   types.ConnectionInformation
+		want string
+	}{
+		{
+			name: "Every Day",
+			ci:   types.ConnectionInformation{FullDays: true},
+			want: "Every day, at any time (UTC)",
+		},
+		{
+			name: "Weekdays",
+			ci: types.ConnectionInformation{
+				DaysOfWeek: []types.DayOfWeek{types.Monday, types.Tuesday, types.Wednesday, types.Thursday, types.Friday},
+				HoursFrom:  "08:00",
+				HoursTo:    "18:00",
+				TimeZone:   "Europe/Berlin",
+			},
+			want: "Monday to Friday, from 08:00 to 18:00 (Europe/Berlin)",
+		},
+		{
+			name: "Split Days Overnight",
+			ci: types.ConnectionInformation{
+				DaysOfWeek: []types.DayOfWeek{types.Sunday, types.Monday, types.Wednesday, types.Thursday, types.Friday, types.Saturday},
+				HoursFrom:  "22:00",
+				HoursTo:    "06:00",
+			},
+			want: "Sunday, Monday and Wednesday to Saturday, from 22:00 to 06:00 the next day (UTC)",
+		},
+		{
+			name: "Two Days",
+			ci:   types.ConnectionInformation{DaysOfWeek: []types.DayOfWeek{types.Saturday, types.Sunday}, FullDays: true},
+			want: "Sunday and Saturday, at any time (UTC)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeSchedulePlain(tt.ci); got != tt.want {
+				t.Errorf("describeSchedulePlain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func auditReport() *AuditReport {
+	policy := simulatorPolicies[0]
+	policy.PolicyName = "Payments <Prod> | *Critical*"
+	policy.UserAccessRules = append([]types.UserAccessRules(nil), policy.UserAccessRules...)
+	policy.UserAccessRules[0].ConnectionInformation.GrantAccess = 2
+	policy.UserAccessRules[0].ConnectionInformation.IdleTime = 15
+
+	return &AuditReport{
+		Title:       "Quarterly Access Review",
+		GeneratedAt: time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC),
+		Policies:    []types.Policy{simulatorPolicies[1], policy},
+		TargetSets: []types.TargetSetMapping{{
+			StrongAccountID: "acc-1",
+			TargetSets:      []types.TargetSets{{Name: "example.com", Type: types.TargetSetTypeDomain, EnableCertificateValidation: types.Bool(true)}},
+		}},
+		Settings: &types.Settings{
+			MfaCaching:     &types.MfaCaching{IsMfaCachingEnabled: types.Bool(true), KeyExpirationTimeSec: types.Int(900)},
+			StandingAccess: &types.StandingAccess{StandingAccessAvailable: types.Bool(false)},
+		},
+	}
+}
+
+func TestWriteAuditMarkdown(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteAuditMarkdown(&b, auditReport()); err != nil {
+		t.Fatalf("WriteAuditMarkdown() error = %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		"# Quarterly Access Review\n",
+		"Generated 2024-04-01 09:30 UTC. 2 policies (2 enabled) with 2 access rules and 1 target set.",
+		"### OnPrem Night Shift\n",
+		"  - OnPrem: computer names starting with prod in example.local; computer names matching db-\\* in example.local",
+		"- **Who:** Group Operators\n",
+		"- **When:** Friday, from 22:00 to 06:00 the next day (UTC)\n",
+		"- **Connect as:** OnPrem: rdp ephemeral user (Remote Desktop Users)\n",
+		"### Payments &lt;Prod&gt; \\| \\*Critical\\*\n",
+		"- **Session:** Access is granted for 2 hours at a time, idle sessions end after 15 minutes\n",
+		"| MFA caching | Key expiration | 900 seconds |\n",
+		"| Standing access | Available | No |\n",
+		"| RDP file transfer | Enabled | Not configured |\n",
+		"| example.com | Domain |  | acc-1 | Enabled |\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteAuditMarkdown() missing %q in\n%s", want, got)
+		}
+	}
+
+	// Policies are sorted by name
+	if strings.Index(got, "OnPrem Night Shift") > strings.Index(got, "Payments") {
+		t.Errorf("WriteAuditMarkdown() policies are not sorted")
+	}
+}
+
+func TestWriteAuditHTML(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteAuditHTML(&b, auditReport()); err != nil {
+		t.Fatalf("WriteAuditHTML() error = %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		"<title>Quarterly Access Review</title>",
+		"<h3>Payments &lt;Prod&gt; | *Critical*</h3>",
+		"<dt>When</dt><dd>Monday to Friday, from 08:00 to 18:00 (America/New_York)</dd>",
+		"<tr><td>MFA caching</td><td>Enabled</td><td>Yes</td></tr>",
+		"<tr><td>example.com</td><td>Domain</td><td></td><td>acc-1</td><td>Enabled</td></tr>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteAuditHTML() missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<Prod>") {
+		t.Errorf("WriteAuditHTML() did not escape policy name")
+	}
+}
+
+func TestBuildAuditReport(t *testing.T) {
+	policy := simulatorPolicies[0]
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/access-policies":
+			json.NewEncoder(w).Encode(types.ListPolicies{Items: []types.Items{{PolicyID: policy.PolicyID}}, TotalCount: 1})
+		case "/api/access-policies/" + policy.PolicyID:
+			json.NewEncoder(w).Encode(policy)
+		case "/api/discovery/targetsets":
+			w.Write([]byte(`{"target_sets": [{"name": "example.com", "type": "Domain"}]}`))
+		case "/api/settings":
+			w.Write([]byte(`{"mfaCaching": {"isMfaCachingEnabled": true}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	defer func(clock func() time.Time) { auditClock = clock }(auditClock)
+	now := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+	auditClock = func() time.Time { return now }
+
+	report, dpaerr, err := ns.BuildAuditReport(context.Background())
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("BuildAuditReport() error = %v, %v", err, dpaerr)
+	}
+	if len(report.Policies) != 1 || len(report.TargetSets[0].TargetSets) != 1 || !*report.Settings.MfaCaching.IsMfaCachingEnabled || !report.GeneratedAt.Equal(now) {
+		t.Errorf("BuildAuditReport() = %+v", report)
+	}
+}
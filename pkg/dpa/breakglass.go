@@ -0,0 +1,284 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Returns the time a break-glass snapshot is taken, replaced in tests
+var breakGlassClock = time.Now
+
+// BreakGlassSnapshot is the state recorded before break-glass changes the
+// tenant. Policies holds the status of every policy matching the filter
+// and Settings the tenant settings.
+type BreakGlassSnapshot struct {
+	TakenAt  time.Time          `json:"takenAt"`
+	Policies []BreakGlassPolicy `json:"policies"`
+	Settings types.Settings     `json:"settings"`
+}
+
+// BreakGlassPolicy is the status of a policy when the snapshot was taken
+type BreakGlassPolicy struct {
+	PolicyID   string             `json:"policyId"`
+	PolicyName string             `json:"policyName"`
+	Status     types.PolicyStatus `json:"status"`
+}
+
+// BreakGlassOptions configures BreakGlass. Filter selects the policies to
+// disable, all policies when empty. Settings are applied to the tenant
+// while break-glass is active, for example to turn off standing access.
+type BreakGlassOptions struct {
+	Filter   ListPoliciesOptions
+	Settings types.Settings
+	Bulk     BulkOptions
+}
+
+// BreakGlassResult is the outcome of BreakGlass or RestoreBreakGlass.
+// Policies reports the policies whose status was changed and Settings the
+// settings which were updated.
+type BreakGlassResult struct {
+	Snapshot *BreakGlassSnapshot `json:"snapshot"`
+	Policies *BulkReport         `json:"policies"`
+	Settings types.Settings      `json:"settings"`
+}
+
+// BreakGlass cuts off DPA access during an incident. The status of every
+// policy matching the filter and the tenant settings are written to a
+// snapshot file, then every enabled policy is disabled and the break-glass
+// settings are applied. The snapshot file must not already exist so that
+// running BreakGlass twice cannot overwrite the state to restore.
+// Returns a BreakGlassResult or types.ErrorResponse based on the response
+// from the API. Policies which could not be disabled are reported in
+// BreakGlassResult.Policies.
+//
+// Example:
+//
+//	opts := dpa.BreakGlassOptions{
+//		Settings: types.Settings{
+//			StandingAccess: &types.StandingAccess{StandingAccessAvailable: types.Bool(false)},
+//		},
+//	}
+//
+//	result, dpaerr, err := s.BreakGlass(context.Background(), "break-glass.json", opts)
+//	if err != nil {
+//		log.Fatalf("Failed to break glass. %s", err)
+//		return
+//	}
+//	fmt.Printf("%d policies disabled, %d failed\n", result.Policies.Succeeded, result.Policies.Failed)
+func (s *Service) BreakGlass(ctx context.Context, name string, opts BreakGlassOptions) (*BreakGlassResult, *types.ErrorResponse, error) {
+	list, dpaerr, err := s.ListPoliciesWithOptions(ctx, opts.Filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("breakGlass: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	settings, dpaerr, err := s.ListSettings(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("breakGlass: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	snapshot := &BreakGlassSnapshot{TakenAt: breakGlassClock().UTC(), Settings: *settings}
+	var enabled []string
+	for _, item := range list.Items {
+		snapshot.Policies = append(snapshot.Policies, BreakGlassPolicy{PolicyID: item.PolicyID, PolicyName: item.PolicyName, Status: item.Status})
+		if item.Status == types.PolicyStatusEnabled {
+			enabled = append(enabled, item.PolicyID)
+		}
+	}
+	if err := writeBreakGlassSnapshot(name, snapshot); err != nil {
+		return nil, nil, fmt.Errorf("breakGlass: %s", err)
+	}
+
+	result := &BreakGlassResult{Snapshot: snapshot}
+	result.Policies, err = s.DisablePolicies(ctx, enabled, opts.Bulk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("breakGlass: %s", err)
+	}
+
+	if !reflect.DeepEqual(opts.Settings, types.Settings{}) {
+		_, dpaerr, err := s.UpdateSettings(ctx, opts.Settings)
+		if err != nil {
+			return result, nil, fmt.Errorf("breakGlass: %s", err)
+		}
+		if !dpaerr.Empty() {
+			return result, dpaerr, nil
+		}
+		result.Settings = opts.Settings
+	}
+	return result, &types.ErrorResponse{}, nil
+}
+
+// RestoreBreakGlass restores the state recorded by BreakGlass. Only the
+// policies BreakGlass disabled, enabled in the snapshot and still disabled,
+// are enabled again so changes made by hand since are kept. Only the
+// settings which differ are sent. Policies deleted since the snapshot are
+// reported as failed with an error wrapping ErrNotFound.
+// Returns a BreakGlassResult or types.ErrorResponse based on the response
+// from the API.
+//
+// Example:
+//
+//	result, dpaerr, err := s.RestoreBreakGlass(context.Background(), "break-glass.json", dpa.BulkOptions{})
+//	if err != nil {
+//		log.Fatalf("Failed to restore. %s", err)
+//		return
+//	}
+//	if err := result.Policies.Err(); err != nil {
+//		log.Printf("Some policies were not restored. %s", err)
+//	}
+func (s *Service) RestoreBreakGlass(ctx context.Context, name string, opts BulkOptions) (*BreakGlassResult, *types.ErrorResponse, error) {
+	snapshot, err := LoadBreakGlassSnapshot(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("restoreBreakGlass: %s", err)
+	}
+
+	list, dpaerr, err := s.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("restoreBreakGlass: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	current := map[string]types.PolicyStatus{}
+	for _, item := range list.Items {
+		current[item.PolicyID] = item.Status
+	}
+
+	var ids []string
+	for _, p := range snapshot.Policies {
+		if p.Status != types.PolicyStatusEnabled {
+			continue
+		}
+		if status, ok := current[p.PolicyID]; ok && status != types.PolicyStatusDisabled {
+			continue
+		}
+		ids = append(ids, p.PolicyID)
+	}
+
+	result := &BreakGlassResult{Snapshot: snapshot}
+	result.Policies, err = runBulk(ctx, "restoreBreakGlass", ids, opts, func(ctx context.Context, id string) (bool, *types.ErrorResponse, error) {
+		if _, ok := current[id]; !ok {
+			return false, nil, fmt.Errorf("policy %s: %w", id, ErrNotFound)
+		}
+		_, dpaerr, err := s.ModifyPolicy(ctx, id, func(p *types.Policy) error {
+			if p.Status != types.PolicyStatusDisabled {
+				return errStatusUnchanged
+			}
+			p.Status = types.PolicyStatusEnabled
+			return nil
+		})
+		if errors.Is(err, errStatusUnchanged) {
+			return false, &types.ErrorResponse{}, nil
+		}
+		return true, dpaerr, err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("restoreBreakGlass: %s", err)
+	}
+
+	settings, dpaerr, err := s.ListSettings(ctx)
+	if err != nil {
+		return result, nil, fmt.Errorf("restoreBreakGlass: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return result, dpaerr, nil
+	}
+	changes := settingsChanges(*settings, snapshot.Settings)
+	if !reflect.DeepEqual(changes, types.Settings{}) {
+		_, dpaerr, err := s.UpdateSettings(ctx, changes)
+		if err != nil {
+			return result, nil, fmt.Errorf("restoreBreakGlass: %s", err)
+		}
+		if !dpaerr.Empty() {
+			return result, dpaerr, nil
+		}
+		result.Settings = changes
+	}
+	return result, &types.ErrorResponse{}, nil
+}
+
+// LoadBreakGlassSnapshot reads a snapshot written by BreakGlass
+//
+// Example:
+//
+//	snapshot, err := dpa.LoadBreakGlassSnapshot("break-glass.json")
+//	if err != nil {
+//		log.Fatalf("Failed to load snapshot. %s", err)
+//		return
+//	}
+func LoadBreakGlassSnapshot(name string) (*BreakGlassSnapshot, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadBreakGlassSnapshot: Failed to read snapshot. %s", err)
+	}
+	var snapshot BreakGlassSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, fmt.Errorf("loadBreakGlassSnapshot: Failed to parse snapshot. %s", err)
+	}
+	return &snapshot, nil
+}
+
+// Writes the snapshot to a new file, failing when the file exists
+func writeBreakGlassSnapshot(name string, snapshot *BreakGlassSnapshot) error {
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal snapshot. %s", err)
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("Failed to create snapshot. %s", err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to write snapshot. %s", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to write snapshot. %s", err)
+	}
+	return f.Close()
+}
+
+// Returns the values of want which differ from current. Each feature of
+// types.Settings is a pointer to a struct of pointers, unchanged features
+// and values are left nil.
+func settingsChanges(current, want types.Settings) types.Settings {
+	var changes types.Settings
+	cv, wv, out := reflect.ValueOf(current), reflect.ValueOf(want), reflect.ValueOf(&changes).Elem()
+	for i := 0; i < wv.NumField(); i++ {
+		wf, cf := wv.Field(i), cv.Field(i)
+		if wf.IsNil() {
+			continue
+		}
+		feature := reflect.New(wf.Type().Elem())
+		changed := false
+		for j := 0; j < wf.Elem().NumField(); j++ {
+			w := wf.Elem().Field(j)
+			if w.IsNil() {
+				continue
+			}
+			if !cf.IsNil() {
+				if c := cf.Elem().Field(j); !c.IsNil() && reflect.DeepEqual(c.Interface(), w.Interface()) {
+					continue
+				}
+			}
+			feature.Elem().Field(j).Set(w)
+			changed = true
+		}
+		if changed {
+			out.Field(i).Set(feature)
+		}
+	}
+	return changes
+}
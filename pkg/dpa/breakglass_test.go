@@ -0,0 +1,181 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Returns a server holding policy statuses and settings. Every settings
+// PATCH body is appended to patches.
+func breakGlassServer(statuses map[string]types.PolicyStatus, settings *types.Settings, patches *[]string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		id := path.Base(r.URL.Path)
+		switch {
+		case id == "settings" && r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(settings)
+		case id == "settings":
+			var body map[string]json.RawMessage
+			json.NewDecoder(r.Body).Decode(&body)
+			b, _ := json.Marshal(body)
+			*patches = append(*patches, string(b))
+			json.Unmarshal(b, settings)
+			json.NewEncoder(w).Encode(settings)
+		default:
+			servePolicyStatuses(w, r, statuses)
+		}
+	}))
+}
+
+func TestBreakGlass(t *testing.T) {
+	statuses := map[string]types.PolicyStatus{
+		"id-1": types.PolicyStatusEnabled,
+		"id-2": types.PolicyStatusDisabled,
+		"id-3": types.PolicyStatusEnabled,
+		"id-4": types.PolicyStatusDraft,
+	}
+	settings := &types.Settings{
+		StandingAccess: &types.StandingAccess{StandingAccessAvailable: types.Bool(true), SessionMaxDuration: types.Int(4)},
+		MfaCaching:     &types.MfaCaching{IsMfaCachingEnabled: types.Bool(true)},
+	}
+
+	var patches []string
+	ts := breakGlassServer(statuses, settings, &patches)
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	name := filepath.Join(t.TempDir(), "break-glass.json")
+	opts := BreakGlassOptions{
+		Settings: types.Settings{StandingAccess: &types.StandingAccess{StandingAccessAvailable: types.Bool(false)}},
+	}
+
+	result, dpaerr, err := ns.BreakGlass(context.Background(), name, opts)
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("BreakGlass() error = %v, %v", err, dpaerr)
+	}
+	if result.Policies.Succeeded != 2 || len(result.Snapshot.Policies) != 4 {
+		t.Errorf("BreakGlass() = %+v", result.Policies)
+	}
+	for id, status := range statuses {
+		if status == types.PolicyStatusEnabled {
+			t.Errorf("BreakGlass() policy %s is still enabled", id)
+		}
+	}
+	if *settings.StandingAccess.StandingAccessAvailable {
+		t.Errorf("BreakGlass() standing access is still available")
+	}
+
+	snapshot, err := LoadBreakGlassSnapshot(name)
+	if err != nil || snapshot.Policies[0].Status != types.PolicyStatusEnabled || !*snapshot.Settings.StandingAccess.StandingAccessAvailable {
+		t.Errorf("LoadBreakGlassSnapshot() = %+v, error = %v", snapshot, err)
+	}
+
+	// A second break-glass must not overwrite the snapshot
+	if _, _, err := ns.BreakGlass(context.Background(), name, opts); err == nil {
+		t.Errorf("BreakGlass() expected error for existing snapshot")
+	}
+
+	// Someone enabled a policy by hand during the incident and a disabled
+	// policy was deleted
+	statuses["id-2"] = types.PolicyStatusEnabled
+	delete(statuses, "id-3")
+	patches = nil
+
+	result, dpaerr, err = ns.RestoreBreakGlass(context.Background(), name, BulkOptions{})
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("RestoreBreakGlass() error = %v, %v", err, dpaerr)
+	}
+	if result.Policies.Succeeded != 1 || result.Policies.Failed != 1 {
+		t.Errorf("RestoreBreakGlass() = %+v", result.Policies)
+	}
+	for _, r := range result.Policies.Results {
+		if r.PolicyID == "id-3" && !errors.Is(r.Err, ErrNotFound) {
+			t.Errorf("RestoreBreakGlass() deleted policy = %+v", r)
+		}
+	}
+
+	// Only the policies break-glass disabled are enabled, the policy changed
+	// by hand is left alone
+	want := map[string]types.PolicyStatus{
+		"id-1": types.PolicyStatusEnabled,
+		"id-2": types.PolicyStatusEnabled,
+		"id-4": types.PolicyStatusDraft,
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("RestoreBreakGlass() statuses = %v, want %v", statuses, want)
+	}
+	if want := []string{`{"standingAccess":{"standingAccessAvailable":true}}`}; !reflect.DeepEqual(patches, want) {
+		t.Errorf("RestoreBreakGlass() settings sent %v, want %v", patches, want)
+	}
+}
+
+func TestBreakGlassGuardrails(t *testing.T) {
+	statuses := map[string]types.PolicyStatus{"id-1": types.PolicyStatusEnabled, "id-2": types.PolicyStatusEnabled}
+	var patches []string
+	ts := breakGlassServer(statuses, &types.Settings{}, &patches)
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	// id-1 already violates the guardrail
+	g, err := NewGuardrails(Guardrail{Name: "no-id-1", Expression: `policy.policyName != "id-1"`})
+	if err != nil {
+		t.Fatalf("NewGuardrails() error = %v", err)
+	}
+	ns.SetGuardrails(g)
+
+	result, dpaerr, err := ns.BreakGlass(context.Background(), filepath.Join(t.TempDir(), "break-glass.json"), BreakGlassOptions{})
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("BreakGlass() error = %v, %v", err, dpaerr)
+	}
+	if result.Policies.Succeeded != 2 || statuses["id-1"] != types.PolicyStatusDisabled {
+		t.Errorf("BreakGlass() = %+v, id-1 status = %s", result.Policies, statuses["id-1"])
+	}
+
+	// Other changes to a violating policy are still rejected
+	_, _, err = ns.ModifyPolicy(context.Background(), "id-1", func(p *types.Policy) error {
+		p.Description = "changed"
+		return nil
+	})
+	if !errors.Is(err, ErrGuardrailViolation) {
+		t.Errorf("ModifyPolicy() error = %v, want wrapping ErrGuardrailViolation", err)
+	}
+}
+
+func TestSettingsChanges(t *testing.T) {
+	current := types.Settings{
+		StandingAccess:  &types.StandingAccess{StandingAccessAvailable: types.Bool(false), SessionMaxDuration: types.Int(4)},
+		RdpFileTransfer: &types.RdpFileTransfer{Enabled: types.Bool(true)},
+	}
+	want := types.Settings{
+		StandingAccess:  &types.StandingAccess{StandingAccessAvailable: types.Bool(true), SessionMaxDuration: types.Int(4)},
+		RdpFileTransfer: &types.RdpFileTransfer{Enabled: types.Bool(true)},
+		MfaCaching:      &types.MfaCaching{KeyExpirationTimeSec: types.Int(900)},
+	}
+
+	got := settingsChanges(current, want)
+	b, _ := json.Marshal(got)
+	if string(b) != `{"mfaCaching":{"keyExpirationTimeSec":900},"standingAccess":{"standingAccessAvailable":true}}` {
+		t.Errorf("settingsChanges() = %s", b)
+	}
+	if !reflect.DeepEqual(settingsChanges(want, want), types.Settings{}) {
+		t.Errorf("settingsChanges() expected no changes")
+	}
+}
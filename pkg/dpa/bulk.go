@@ -0,0 +1,232 @@
+package dpa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Workers used by bulk operations when BulkOptions.Workers is not set
+const defaultBulkWorkers = 8
+
+// ErrBulkSkipped is the error of bulk results which were not attempted
+// because an earlier operation failed with BulkOptions.StopOnError set.
+// Operations not started before the context is done have the context's
+// error instead.
+var ErrBulkSkipped = errors.New("skipped after an earlier failure")
+
+// Returned when a policy already has the requested status, so that no
+// update is sent
+var errStatusUnchanged = errors.New("status unchanged")
+
+// BulkOptions configures a bulk operation. Workers limits the number of
+// requests in flight and defaults to 8. With StopOnError set no new
+// operations are started once one has failed, operations already in
+// flight are completed.
+type BulkOptions struct {
+	Workers     int
+	StopOnError bool
+}
+
+// BulkResult is the outcome of a bulk operation on one policy. A failed
+// operation has either the ErrorResponse returned by the API or the
+// request error Err. Changed is false when the policy already had the
+// requested status.
+type BulkResult struct {
+	PolicyID string               `json:"policyId"`
+	Changed  bool                 `json:"changed"`
+	Response *types.ErrorResponse `json:"response,omitempty"`
+	Err      error                `json:"-"`
+}
+
+// Succeeded reports whether the operation completed without error
+func (r BulkResult) Succeeded() bool {
+	return r.Err == nil && r.Response.Empty()
+}
+
+// BulkReport holds a result for every requested policy, in the order the
+// policy IDs were provided, and counts of the outcomes.
+type BulkReport struct {
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Skipped   int          `json:"skipped"`
+}
+
+// Err returns the failures of the report joined in a single error, or nil
+// when every operation succeeded.
+func (r *BulkReport) Err() error {
+	var errs []error
+	for _, result := range r.Results {
+		switch {
+		case result.Err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", result.PolicyID, result.Err))
+		case !result.Response.Empty():
+			errs = append(errs, fmt.Errorf("%s: %w", result.PolicyID, result.Response))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EnablePolicies sets the status of every policy to Enabled concurrently.
+// Each policy is updated with ModifyPolicy, so concurrent changes made by
+// others are retried rather than overwritten. Policies which are already
+// enabled are not updated.
+// Returns a BulkReport with the result of every policy. An error is only
+// returned when the input is invalid.
+//
+// Example:
+//
+//	report, err := s.EnablePolicies(context.Background(), ids, dpa.BulkOptions{Workers: 10})
+//	if err != nil {
+//		log.Fatalf("Failed to enable policies. %s", err)
+//		return
+//	}
+//	fmt.Printf("%d enabled, %d failed\n", report.Succeeded, report.Failed)
+func (s *Service) EnablePolicies(ctx context.Context, ids []string, opts BulkOptions) (*BulkReport, error) {
+	return s.setPoliciesStatus(ctx, "enablePolicies", ids, types.PolicyStatusEnabled, opts)
+}
+
+// DisablePolicies sets the status of every policy to Disabled concurrently.
+// See EnablePolicies for details.
+//
+// Example:
+//
+//	report, err := s.DisablePolicies(context.Background(), ids, dpa.BulkOptions{StopOnError: true})
+//	if err != nil {
+//		log.Fatalf("Failed to disable policies. %s", err)
+//		return
+//	}
+//	if err := report.Err(); err != nil {
+//		log.Printf("Some policies were not disabled. %s", err)
+//	}
+func (s *Service) DisablePolicies(ctx context.Context, ids []string, opts BulkOptions) (*BulkReport, error) {
+	return s.setPoliciesStatus(ctx, "disablePolicies", ids, types.PolicyStatusDisabled, opts)
+}
+
+// DeletePolicies deletes every policy concurrently.
+// Returns a BulkReport with the result of every policy. An error is only
+// returned when the input is invalid.
+//
+// Example:
+//
+//	report, err := s.DeletePolicies(context.Background(), ids, dpa.BulkOptions{})
+//	if err != nil {
+//		log.Fatalf("Failed to delete policies. %s", err)
+//		return
+//	}
+//	for _, r := range report.Results {
+//		if !r.Succeeded() {
+//			fmt.Printf("%s was not deleted\n", r.PolicyID)
+//		}
+//	}
+func (s *Service) DeletePolicies(ctx context.Context, ids []string, opts BulkOptions) (*BulkReport, error) {
+	return runBulk(ctx, "deletePolicies", ids, opts, func(ctx context.Context, id string) (bool, *types.ErrorResponse, error) {
+		dpaerr, err := s.DeletePolicy(ctx, id)
+		return true, dpaerr, err
+	})
+}
+
+func (s *Service) setPoliciesStatus(ctx context.Context, op string, ids []string, status types.PolicyStatus, opts BulkOptions) (*BulkReport, error) {
+	return runBulk(ctx, op, ids, opts, func(ctx context.Context, id string) (bool, *types.ErrorResponse, error) {
+		_, dpaerr, err := s.ModifyPolicy(ctx, id, func(p *types.Policy) error {
+			if p.Status == status {
+				return errStatusUnchanged
+			}
+			p.Status = status
+			return nil
+		})
+		if errors.Is(err, errStatusUnchanged) {
+			return false, &types.ErrorResponse{}, nil
+		}
+		return true, dpaerr, err
+	})
+}
+
+// Runs an operation for every policy ID using a bounded pool of workers
+func runBulk(ctx context.Context, op string, ids []string, opts BulkOptions, fn func(context.Context, string) (bool, *types.ErrorResponse, error)) (*BulkReport, error) {
+	if opts.Workers < 0 {
+		return nil, fmt.Errorf("%s: Workers cannot be negative", op)
+	}
+	for i, id := range ids {
+		if len(id) == 0 {
+			return nil, fmt.Errorf("%s: Policy ID %d is empty", op, i)
+		}
+	}
+	workers := opts.Workers
+	if workers == 0 {
+		workers = defaultBulkWorkers
+	}
+
+	report := &BulkReport{Results: make([]BulkResult, len(ids))}
+	for i, id := range ids {
+		report.Results[i] = BulkResult{PolicyID: id, Err: ErrBulkSkipped}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+	)
+	jobs := make(chan int)
+	for w := 0; w < min(workers, len(ids)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				mu.Lock()
+				stop := stopped
+				mu.Unlock()
+				if stop {
+					continue
+				}
+
+				changed, dpaerr, err := fn(ctx, ids[i])
+				result := BulkResult{PolicyID: ids[i], Changed: changed && err == nil && dpaerr.Empty(), Err: err}
+				if !dpaerr.Empty() {
+					result.Response = dpaerr
+				}
+
+				mu.Lock()
+				report.Results[i] = result
+				if !result.Succeeded() && opts.StopOnError {
+					stopped = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range ids {
+		mu.Lock()
+		stop := stopped
+		mu.Unlock()
+		if stop {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(ids); j++ {
+				report.Results[j].Err = err
+			}
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		switch {
+		case errors.Is(result.Err, ErrBulkSkipped):
+			report.Skipped++
+		case result.Succeeded():
+			report.Succeeded++
+		default:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
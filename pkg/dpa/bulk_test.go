@@ -0,0 +1,213 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Returns a server which stores policy statuses and fails requests for
+// the policy IDs in failing
+func bulkServer(statuses map[string]types.PolicyStatus, failing map[string]bool, inFlight *int) *httptest.Server {
+	var mu sync.Mutex
+	current := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := path.Base(r.URL.Path)
+		mu.Lock()
+		current++
+		*inFlight = max(*inFlight, current)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		current--
+
+		w.Header().Set("Content-Type", "application/json")
+		if failing[id] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"DPA_INVALID_VALUE","message":"Invalid policy"}`))
+			return
+		}
+		servePolicyStatuses(w, r, statuses)
+	}))
+}
+
+// Serves policies named by their ID from statuses. Lists are sorted by ID,
+// updates store the new status and deletes remove the policy. Callers
+// serialise requests.
+func servePolicyStatuses(w http.ResponseWriter, r *http.Request, statuses map[string]types.PolicyStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	id := path.Base(r.URL.Path)
+	switch {
+	case id == "access-policies":
+		ids := make([]string, 0, len(statuses))
+		for pid := range statuses {
+			ids = append(ids, pid)
+		}
+		sort.Strings(ids)
+		list := types.ListPolicies{TotalCount: len(ids)}
+		for _, pid := range ids {
+			list.Items = append(list.Items, types.Items{PolicyID: pid, PolicyName: pid, Status: statuses[pid]})
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(types.Policy{PolicyID: id, PolicyName: id, Status: statuses[id]})
+	case r.Method == http.MethodPut:
+		var p types.Policy
+		json.NewDecoder(r.Body).Decode(&p)
+		statuses[id] = p.Status
+		json.NewEncoder(w).Encode(p)
+	case r.Method == http.MethodDelete:
+		delete(statuses, id)
+	}
+}
+
+func TestBulkPolicies(t *testing.T) {
+	var ids []string
+	for i := 0; i < 20; i++ {
+		ids = append(ids, fmt.Sprintf("id-%d", i))
+	}
+
+	var tests = []struct {
+		name          string
+		op            func(*Service, context.Context, []string, BulkOptions) (*BulkReport, error)
+		opts          BulkOptions
+		failing       map[string]bool
+		want          types.PolicyStatus
+		wantSucceeded int
+		wantFailed    int
+		wantChanged   int
+		wantSkipped   bool
+	}{
+		{
+			name:          "Disable Policies",
+			op:            (*Service).DisablePolicies,
+			opts:          BulkOptions{Workers: 4},
+			want:          types.PolicyStatusDisabled,
+			wantSucceeded: 20,
+			wantChanged:   10,
+		},
+		{
+			name:          "Enable Policies With Failures",
+			op:            (*Service).EnablePolicies,
+			opts:          BulkOptions{Workers: 4},
+			failing:       map[string]bool{"id-3": true, "id-11": true},
+			want:          types.PolicyStatusEnabled,
+			wantSucceeded: 18,
+			wantFailed:    2,
+			wantChanged:   8,
+		},
+		{
+			name:          "Delete Policies",
+			op:            (*Service).DeletePolicies,
+			wantSucceeded: 20,
+			wantChanged:   20,
+		},
+		{
+			name:        "Delete Policies Stop On Error",
+			op:          (*Service).DeletePolicies,
+			opts:        BulkOptions{Workers: 1, StopOnError: true},
+			failing:     map[string]bool{"id-2": true},
+			wantFailed:  1,
+			wantSkipped: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Even policies start enabled and odd policies disabled
+			statuses := map[string]types.PolicyStatus{}
+			for i, id := range ids {
+				statuses[id] = types.PolicyStatusEnabled
+				if i%2 == 1 {
+					statuses[id] = types.PolicyStatusDisabled
+				}
+			}
+
+			var inFlight int
+			ts := bulkServer(statuses, tt.failing, &inFlight)
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			report, err := tt.op(ns, context.Background(), ids, tt.opts)
+			if err != nil {
+				t.Fatalf("bulk error = %v", err)
+			}
+			if len(report.Results) != len(ids) {
+				t.Fatalf("bulk results = %d, want %d", len(report.Results), len(ids))
+			}
+
+			changed := 0
+			for i, r := range report.Results {
+				if r.PolicyID != ids[i] {
+					t.Errorf("bulk result %d = %s, want %s", i, r.PolicyID, ids[i])
+				}
+				if r.Changed {
+					changed++
+				}
+				if tt.failing[r.PolicyID] && (r.Succeeded() || r.Response.Code != "DPA_INVALID_VALUE") {
+					t.Errorf("bulk result = %+v, want failure", r)
+				}
+			}
+
+			if tt.wantSkipped {
+				if report.Skipped == 0 || report.Succeeded != 2 || report.Failed != 1 {
+					t.Errorf("bulk report = %d succeeded, %d failed, %d skipped", report.Succeeded, report.Failed, report.Skipped)
+				}
+				if !errors.Is(report.Results[len(ids)-1].Err, ErrBulkSkipped) {
+					t.Errorf("bulk last result = %+v, want skipped", report.Results[len(ids)-1])
+				}
+				return
+			}
+
+			if report.Succeeded != tt.wantSucceeded || report.Failed != tt.wantFailed || report.Skipped != 0 || changed != tt.wantChanged {
+				t.Errorf("bulk report = %d succeeded, %d failed, %d skipped, %d changed", report.Succeeded, report.Failed, report.Skipped, changed)
+			}
+			if (report.Err() != nil) != (tt.wantFailed != 0) {
+				t.Errorf("bulk Err() = %v", report.Err())
+			}
+			limit := tt.opts.Workers
+			if limit == 0 {
+				limit = defaultBulkWorkers
+			}
+			if inFlight > limit || inFlight < 2 {
+				t.Errorf("bulk requests in flight = %d, limit %d", inFlight, limit)
+			}
+			for id, status := range statuses {
+				if !tt.failing[id] && len(tt.want) != 0 && status != tt.want {
+					t.Errorf("bulk %s status = %s, want %s", id, status, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkPoliciesInvalid(t *testing.T) {
+	ns, _ := NewService("http://localhost", "api", false, validToken)
+
+	if _, err := ns.DeletePolicies(context.Background(), []string{"id-1", ""}, BulkOptions{}); err == nil {
+		t.Errorf("DeletePolicies() expected error for empty policy ID")
+	}
+	if _, err := ns.EnablePolicies(context.Background(), []string{"id-1"}, BulkOptions{Workers: -1}); err == nil {
+		t.Errorf("EnablePolicies() expected error for negative workers")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := ns.DisablePolicies(ctx, []string{"id-1", "id-2"}, BulkOptions{})
+	if err != nil || report.Failed != 2 || !errors.Is(report.Results[0].Err, context.Canceled) {
+		t.Errorf("DisablePolicies() cancelled = %+v, error = %v", report, err)
+	}
+}
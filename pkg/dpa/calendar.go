@@ -0,0 +1,282 @@
+package dpa
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// AccessWindow is a concrete interval during which a policy rule allows access
+type AccessWindow struct {
+	PolicyID   string
+	PolicyName string
+	RuleName   string
+	Start      time.Time
+	End        time.Time
+}
+
+// ExpandAccessWindows expands the schedule of a policy rule (DaysOfWeek,
+// FullDays, HoursFrom, HoursTo and TimeZone) into concrete intervals between
+// from and to. Intervals are calculated in the rule time zone, so daylight
+// saving transitions are honoured, and are limited to the policy StartDate
+// and EndDate. Adjacent intervals are merged. The policy status is not
+// considered.
+//
+// Returns a slice of AccessWindow or an error if the schedule is invalid.
+//
+// Example:
+//
+//	// Access windows for the next week
+//	from := time.Now()
+//	windows, err := dpa.ExpandAccessWindows(policy, policy.UserAccessRules[0], from, from.AddDate(0, 0, 7))
+//	if err != nil {
+//		log.Fatalf("Failed to expand access windows. %s", err)
+//		return
+//	}
+func ExpandAccessWindows(p types.Policy, r types.UserAccessRules, from, to time.Time) ([]AccessWindow, error) {
+	ci := r.ConnectionInformation
+	loc, err := loadTimeZone(ci.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("expandAccessWindows: %s", err)
+	}
+
+	// Limit the range to the policy start and end dates
+	if len(p.StartDate) != 0 {
+		start, err := parsePolicyDate(p.StartDate, loc)
+		if err != nil {
+			return nil, fmt.Errorf("expandAccessWindows: %s", err)
+		}
+		if from.Before(start) {
+			from = start
+		}
+	}
+	if len(p.EndDate) != 0 {
+		end, err := parsePolicyDate(p.EndDate, loc)
+		if err != nil {
+			return nil, fmt.Errorf("expandAccessWindows: %s", err)
+		}
+		end = end.AddDate(0, 0, 1)
+		if to.After(end) {
+			to = end
+		}
+	}
+	if !from.Before(to) {
+		return nil, nil
+	}
+
+	fullDays := ci.FullDays || (len(ci.HoursFrom) == 0 && len(ci.HoursTo) == 0)
+	var fromMin, toMin int
+	if !fullDays {
+		if fromMin, err = parseClock(ci.HoursFrom); err != nil {
+			return nil, fmt.Errorf("expandAccessWindows: %s", err)
+		}
+		if toMin, err = parseClock(ci.HoursTo); err != nil {
+			return nil, fmt.Errorf("expandAccessWindows: %s", err)
+		}
+	}
+
+	// Start a day early to include windows which continue past midnight
+	first := from.In(loc).AddDate(0, 0, -1)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+
+	var windows []AccessWindow
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !dayAllowed(ci.DaysOfWeek, day.Weekday()) {
+			continue
+		}
+
+		var start, end time.Time
+		if fullDays {
+			start, end = day, day.AddDate(0, 0, 1)
+		} else {
+			start = time.Date(day.Year(), day.Month(), day.Day(), fromMin/60, fromMin%60, 0, 0, loc)
+			end = time.Date(day.Year(), day.Month(), day.Day(), toMin/60, toMin%60, 0, 0, loc)
+			if toMin <= fromMin {
+				end = end.AddDate(0, 0, 1)
+			}
+		}
+
+		// Clip the window to the requested range
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			continue
+		}
+
+		if n := len(windows); n > 0 && !windows[n-1].End.Before(start) {
+			windows[n-1].End = end
+			continue
+		}
+		windows = append(windows, AccessWindow{
+			PolicyID:   p.PolicyID,
+			PolicyName: p.PolicyName,
+			RuleName:   r.RuleName,
+			Start:      start,
+			End:        end,
+		})
+	}
+	return windows, nil
+}
+
+// AccessOpen reports whether the schedule of a policy rule allows access at
+// the provided time.
+//
+// Example:
+//
+//	open, err := dpa.AccessOpen(policy, policy.UserAccessRules[0], time.Now())
+//	if err != nil {
+//		log.Fatalf("Failed to evaluate access window. %s", err)
+//		return
+//	}
+func AccessOpen(p types.Policy, r types.UserAccessRules, at time.Time) (bool, error) {
+	w, err := NextAccessWindow(p, r, at)
+	if err != nil {
+		return false, err
+	}
+	return w != nil && !w.Start.After(at), nil
+}
+
+// NextAccessWindow returns the access window which is open at, or next opens
+// after, the provided time. If the window is already open its Start is
+// before the provided time.
+//
+// Only a little over two weeks around the provided time are searched. Start
+// is the zero time when the window opened more than a week earlier and End is
+// the zero time when the window does not close within the search, e.g. for
+// rules granting access at any time without a policy end date.
+//
+// Returns nil if the rule never opens again (e.g. the policy has ended).
+//
+// Example:
+//
+//	w, err := dpa.NextAccessWindow(policy, policy.UserAccessRules[0], time.Now())
+//	if err != nil {
+//		log.Fatalf("Failed to find next access window. %s", err)
+//		return
+//	}
+//	switch {
+//	case w == nil:
+//		fmt.Println("Access never opens again")
+//	case w.End.IsZero():
+//		fmt.Printf("Access opens at %s with no end\n", w.Start)
+//	default:
+//		fmt.Printf("Access opens at %s until %s\n", w.Start, w.End)
+//	}
+func NextAccessWindow(p types.Policy, r types.UserAccessRules, after time.Time) (*AccessWindow, error) {
+	// A window may have opened up to a week earlier and policies may only
+	// start in the future, so search a little over two weeks past the later
+	// of the two.
+	from := after.AddDate(0, 0, -8)
+	search := after
+	if len(p.StartDate) != 0 {
+		loc, err := loadTimeZone(r.ConnectionInformation.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("nextAccessWindow: %s", err)
+		}
+		start, err := parsePolicyDate(p.StartDate, loc)
+		if err != nil {
+			return nil, fmt.Errorf("nextAccessWindow: %s", err)
+		}
+		if start.After(search) {
+			search = start
+		}
+	}
+
+	to := search.AddDate(0, 0, 15)
+	windows, err := ExpandAccessWindows(p, r, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("nextAccessWindow: %s", err)
+	}
+	for _, w := range windows {
+		if w.End.After(after) {
+			// Windows clipped to the search range have no known bound
+			if w.Start.Equal(from) {
+				w.Start = time.Time{}
+			}
+			if w.End.Equal(to) {
+				w.End = time.Time{}
+			}
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+// WriteICalendar writes the access windows as an iCalendar (.ics) document
+// containing one event per window.
+//
+// Example:
+//
+//	f, _ := os.Create("access.ics")
+//	defer f.Close()
+//
+//	if err := dpa.WriteICalendar(f, windows); err != nil {
+//		log.Fatalf("Failed to write calendar. %s", err)
+//		return
+//	}
+func WriteICalendar(w io.Writer, windows []AccessWindow) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format(icsTimeFormat)
+
+	writeICalendarLine(bw, "BEGIN:VCALENDAR")
+	writeICalendarLine(bw, "VERSION:2.0")
+	writeICalendarLine(bw, "PRODID:-//strick-j//cybr-dpa "+FullVersionName+"//EN")
+	writeICalendarLine(bw, "CALSCALE:GREGORIAN")
+	for _, aw := range windows {
+		uid := sha1.Sum([]byte(fmt.Sprintf("%s/%s/%d", aw.PolicyID, aw.RuleName, aw.Start.Unix())))
+		summary := aw.PolicyName
+		if len(aw.RuleName) != 0 {
+			summary = fmt.Sprintf("%s - %s", aw.PolicyName, aw.RuleName)
+		}
+
+		writeICalendarLine(bw, "BEGIN:VEVENT")
+		writeICalendarLine(bw, fmt.Sprintf("UID:%x@cybr-dpa", uid))
+		writeICalendarLine(bw, "DTSTAMP:"+stamp)
+		writeICalendarLine(bw, "DTSTART:"+aw.Start.UTC().Format(icsTimeFormat))
+		writeICalendarLine(bw, "DTEND:"+aw.End.UTC().Format(icsTimeFormat))
+		writeICalendarLine(bw, "SUMMARY:"+escapeICalendarText(summary))
+		if len(aw.PolicyID) != 0 {
+			writeICalendarLine(bw, "DESCRIPTION:"+escapeICalendarText("DPA policy "+aw.PolicyID))
+		}
+		writeICalendarLine(bw, "END:VEVENT")
+	}
+	writeICalendarLine(bw, "END:VCALENDAR")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writeICalendar: Failed to write calendar. %s", err)
+	}
+	return nil
+}
+
+const icsTimeFormat = "20060102T150405Z"
+
+// Writes a content line folded at 75 octets as required by RFC 5545
+func writeICalendarLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		// Avoid splitting multi-byte characters
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		limit = 74
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// Escapes text values as required by RFC 5545
+func escapeICalendarText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
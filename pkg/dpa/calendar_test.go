@@ -0,0 +1,231 @@
+package dpa
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Sample policy with a business hours schedule used by the calendar tests
+var calendarPolicy = types.Policy{
+	PolicyID:   "c12f982a-ab1a-12ab-1a31-f221aa31836a",
+	PolicyName: "Business Hours",
+	Status:     "Enabled",
+	StartDate:  "2024-03-01",
+	EndDate:    "2024-03-31",
+	UserAccessRules: []types.UserAccessRules{
+		{
+			RuleName: "Weekdays",
+			ConnectionInformation: types.ConnectionInformation{
+				DaysOfWeek: []types.DayOfWeek{"Mon", "Tue", "Wed", "Thu", "Fri"},
+				HoursFrom:  "09:00",
+				HoursTo:    "17:00",
+				TimeZone:   "America/New_York",
+			},
+		},
+		{
+			RuleName: "Weekend Nights",
+			ConnectionInformation: types.ConnectionInformation{
+				DaysOfWeek: []types.DayOfWeek{"Sat"},
+				HoursFrom:  "22:00",
+				HoursTo:    "02:00",
+				TimeZone:   "UTC",
+			},
+		},
+		{
+			RuleName: "Full Days",
+			ConnectionInformation: types.ConnectionInformation{
+				DaysOfWeek: []types.DayOfWeek{"Sat", "Sun"},
+				FullDays:   true,
+				TimeZone:   "UTC",
+			},
+		},
+	},
+}
+
+func TestExpandAccessWindows(t *testing.T) {
+	var tests = []struct {
+		name      string
+		rule      int
+		from      time.Time
+		to        time.Time
+		wantCount int
+		wantFirst string
+		wantLast  string
+	}{
+		{
+			name: "Daylight Saving Transition",
+			rule: 0,
+			from: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC),
+			// Fri 8th is EST (UTC-5), Mon 11th is EDT (UTC-4)
+			wantCount: 2,
+			wantFirst: "2024-03-08T14:00:00Z",
+			wantLast:  "2024-03-11T13:00:00Z",
+		},
+		{
+			name:      "Overnight Window",
+			rule:      1,
+			from:      time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			wantCount: 1,
+			wantFirst: "2024-03-09T22:00:00Z",
+			wantLast:  "2024-03-09T22:00:00Z",
+		},
+		{
+			name:      "Merged Full Days",
+			rule:      2,
+			from:      time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC),
+			wantCount: 1,
+			wantFirst: "2024-03-09T00:00:00Z",
+			wantLast:  "2024-03-09T00:00:00Z",
+		},
+		{
+			name:      "Clipped To Policy Dates",
+			rule:      2,
+			from:      time.Date(2024, 3, 25, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+			wantCount: 1,
+			wantFirst: "2024-03-30T00:00:00Z",
+			wantLast:  "2024-03-30T00:00:00Z",
+		},
+		{
+			name:      "Outside Policy Dates",
+			rule:      0,
+			from:      time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC),
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandAccessWindows(calendarPolicy, calendarPolicy.UserAccessRules[tt.rule], tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("ExpandAccessWindows() error = %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Fatalf("ExpandAccessWindows() windows = %d, want %d (%v)", len(got), tt.wantCount, got)
+			}
+			if tt.wantCount == 0 {
+				return
+			}
+			if first := got[0].Start.UTC().Format(time.RFC3339); first != tt.wantFirst {
+				t.Errorf("ExpandAccessWindows() first = %s, want %s", first, tt.wantFirst)
+			}
+			if last := got[len(got)-1].Start.UTC().Format(time.RFC3339); last != tt.wantLast {
+				t.Errorf("ExpandAccessWindows() last = %s, want %s", last, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestExpandAccessWindowsInvalid(t *testing.T) {
+	rule := types.UserAccessRules{
+		ConnectionInformation: types.ConnectionInformation{
+			HoursFrom: "9am",
+			HoursTo:   "17:00",
+		},
+	}
+	_, err := ExpandAccessWindows(types.Policy{}, rule, time.Now(), time.Now().AddDate(0, 0, 7))
+	if err == nil {
+		t.Errorf("ExpandAccessWindows() expected error for invalid hours")
+	}
+}
+
+func TestNextAccessWindow(t *testing.T) {
+	rule := calendarPolicy.UserAccessRules[0]
+
+	// Saturday morning, next window is Monday
+	w, err := NextAccessWindow(calendarPolicy, rule, time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NextAccessWindow() error = %v", err)
+	}
+	if w == nil || w.Start.UTC().Format(time.RFC3339) != "2024-03-18T13:00:00Z" {
+		t.Errorf("NextAccessWindow() got %v, want 2024-03-18T13:00:00Z", w)
+	}
+
+	// Before the policy starts
+	w, err = NextAccessWindow(calendarPolicy, rule, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NextAccessWindow() error = %v", err)
+	}
+	if w == nil || w.Start.UTC().Format(time.RFC3339) != "2024-03-01T14:00:00Z" {
+		t.Errorf("NextAccessWindow() got %v, want 2024-03-01T14:00:00Z", w)
+	}
+
+	// After the policy ends
+	w, err = NextAccessWindow(calendarPolicy, rule, time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NextAccessWindow() error = %v", err)
+	}
+	if w != nil {
+		t.Errorf("NextAccessWindow() got %v, want nil", w)
+	}
+
+	// Always open, the window has no known bounds
+	always := types.UserAccessRules{RuleName: "Always", ConnectionInformation: types.ConnectionInformation{FullDays: true, TimeZone: "UTC"}}
+	w, err = NextAccessWindow(types.Policy{}, always, time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NextAccessWindow() error = %v", err)
+	}
+	if w == nil || !w.Start.IsZero() || !w.End.IsZero() {
+		t.Errorf("NextAccessWindow() got %v, want zero start and end", w)
+	}
+
+	// Always open until the policy ends
+	w, err = NextAccessWindow(types.Policy{StartDate: "2024-03-15", EndDate: "2024-03-20"}, always, time.Date(2024, 3, 16, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NextAccessWindow() error = %v", err)
+	}
+	if w == nil || w.Start.Format(time.RFC3339) != "2024-03-15T00:00:00Z" || w.End.Format(time.RFC3339) != "2024-03-21T00:00:00Z" {
+		t.Errorf("NextAccessWindow() got %v, want 2024-03-15T00:00:00Z to 2024-03-21T00:00:00Z", w)
+	}
+
+	open, err := AccessOpen(calendarPolicy, rule, time.Date(2024, 3, 18, 15, 0, 0, 0, time.UTC))
+	if err != nil || !open {
+		t.Errorf("AccessOpen() = %v, %v, want true", open, err)
+	}
+	open, err = AccessOpen(calendarPolicy, rule, time.Date(2024, 3, 18, 23, 0, 0, 0, time.UTC))
+	if err != nil || open {
+		t.Errorf("AccessOpen() = %v, %v, want false", open, err)
+	}
+	open, err = AccessOpen(types.Policy{}, always, time.Date(2024, 3, 18, 23, 0, 0, 0, time.UTC))
+	if err != nil || !open {
+		t.Errorf("AccessOpen() = %v, %v, want true", open, err)
+	}
+}
+
+func TestWriteICalendar(t *testing.T) {
+	windows, err := ExpandAccessWindows(calendarPolicy, calendarPolicy.UserAccessRules[0],
+		time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ExpandAccessWindows() error = %v", err)
+	}
+	windows[0].PolicyName = strings.Repeat("Long, Policy; Name ", 6)
+
+	var buf bytes.Buffer
+	if err := WriteICalendar(&buf, windows); err != nil {
+		t.Fatalf("WriteICalendar() error = %v", err)
+	}
+	out := buf.String()
+
+	if got := strings.Count(out, "BEGIN:VEVENT"); got != 5 {
+		t.Errorf("WriteICalendar() events = %d, want 5", got)
+	}
+	if !strings.Contains(out, "DTSTART:20240311T130000Z\r\n") {
+		t.Errorf("WriteICalendar() missing DTSTART for first window")
+	}
+	if !strings.Contains(out, `Long\, Policy\; Name`) {
+		t.Errorf("WriteICalendar() summary not escaped")
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("WriteICalendar() line not folded: %q", line)
+		}
+	}
+}
@@ -26,6 +26,7 @@ var (
 	ErrUserAccessDenied = errors.New("you do not have access to the requested resource")
 	ErrNotFound         = errors.New("the requested resource not found")
 	ErrTooManyRequests  = errors.New("you have exceeded throttle")
+	ErrConflict         = errors.New("the requested resource was modified concurrently")
 )
 
 func NewClient(httpClient *http.Client, options Options) *Client {
@@ -208,6 +209,8 @@ func (c *Client) do(r *http.Request) (*http.Response, bool, error) {
 	switch resp.StatusCode {
 	case http.StatusTooManyRequests:
 		return nil, false, ErrTooManyRequests
+	case http.StatusConflict:
+		return nil, false, ErrConflict
 	}
 
 	return nil, false, fmt.Errorf("failed to do request, %d status code received", resp.StatusCode)
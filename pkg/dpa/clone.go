@@ -0,0 +1,206 @@
+package dpa
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// PolicyMapping describes how a policy is transformed when it is cloned.
+// Each map replaces values equal to a key with the key's value, values
+// without a key are kept.
+//
+//	AccountIDs - AWS account IDs, Azure subscriptions and GCP projects
+//	Regions    - Regions of every provider
+//	VpcIDs     - AWS and GCP VPC IDs and Azure VNet IDs
+//	Roles      - Names of the roles of every rule
+//	TagValues  - Values of AWS and Azure tags and GCP labels
+//	NamePrefix - Prepended to the policy name
+//	NameSuffix - Appended to the policy name
+type PolicyMapping struct {
+	AccountIDs map[string]string `json:"accountIds,omitempty"`
+	Regions    map[string]string `json:"regions,omitempty"`
+	VpcIDs     map[string]string `json:"vpcIds,omitempty"`
+	Roles      map[string]string `json:"roles,omitempty"`
+	TagValues  map[string]string `json:"tagValues,omitempty"`
+	NamePrefix string            `json:"namePrefix,omitempty"`
+	NameSuffix string            `json:"nameSuffix,omitempty"`
+}
+
+// Substitution is a value replaced by a PolicyMapping. Field is the path of
+// the value in the policy JSON, e.g. providersData.AWS.accountIds[0].
+type Substitution struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ClonedPolicy is the outcome of ClonePolicy. SourceID is the ID of the
+// cloned policy and PolicyID the ID of the policy created from it.
+type ClonedPolicy struct {
+	SourceID      string         `json:"sourceId"`
+	PolicyID      string         `json:"policyId"`
+	Policy        types.Policy   `json:"policy"`
+	Substitutions []Substitution `json:"substitutions"`
+}
+
+// ClonePolicy copies a policy, for example to promote it from a staging to
+// a production tenant. The policy is fetched, its ID is removed, the
+// mapping is applied and the result is added with target, or with the
+// same Service when target is nil. The guardrails of target apply.
+// Returns a ClonedPolicy reporting every substitution made or
+// types.ErrorResponse based on the response from the API.
+//
+// Example:
+//
+//	prod, err := dpa.NewService("https://prod.dpa.cyberark.cloud", "api", false, prodToken)
+//	if err != nil {
+//		log.Fatalf("Failed to create service. %s", err)
+//		return
+//	}
+//
+//	clone, dpaerr, err := staging.ClonePolicy(context.Background(), policyID, prod, dpa.PolicyMapping{
+//		AccountIDs: map[string]string{"111111111111": "222222222222"},
+//		Roles:      map[string]string{"Staging Ops": "Prod Ops"},
+//		TagValues:  map[string]string{"staging": "prod"},
+//		NameSuffix: " (prod)",
+//	})
+//	if err != nil {
+//		log.Fatalf("Failed to clone policy. %s", err)
+//		return
+//	}
+//	for _, sub := range clone.Substitutions {
+//		fmt.Printf("%s: %s -> %s\n", sub.Field, sub.From, sub.To)
+//	}
+func (s *Service) ClonePolicy(ctx context.Context, policyID string, target *Service, mapping PolicyMapping) (*ClonedPolicy, *types.ErrorResponse, error) {
+	if len(policyID) == 0 {
+		return nil, nil, fmt.Errorf("clonePolicy: Policy id cannot be empty")
+	}
+	if target == nil {
+		target = s
+	}
+
+	source, dpaerr, err := s.GetPolicy(ctx, policyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("clonePolicy: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	policy, subs := ApplyPolicyMapping(*source, mapping)
+	policy.PolicyID = ""
+	policy.UpdatedOn = ""
+
+	added, dpaerr, err := target.AddPolicy(ctx, policy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("clonePolicy: %w", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	policy.PolicyID = added.PolicyID
+	return &ClonedPolicy{SourceID: policyID, PolicyID: added.PolicyID, Policy: policy, Substitutions: subs}, &types.ErrorResponse{}, nil
+}
+
+// ApplyPolicyMapping returns a copy of the policy transformed by the mapping
+// and the substitutions made. The policy passed in is not modified.
+//
+// Example:
+//
+//	policy, subs := dpa.ApplyPolicyMapping(policy, dpa.PolicyMapping{
+//		Regions: map[string]string{"us-east-1": "eu-west-1"},
+//	})
+func ApplyPolicyMapping(p types.Policy, m PolicyMapping) (types.Policy, []Substitution) {
+	subs := []Substitution{}
+	if len(m.NamePrefix) != 0 || len(m.NameSuffix) != 0 {
+		name := m.NamePrefix + p.PolicyName + m.NameSuffix
+		subs = append(subs, Substitution{Field: "policyName", From: p.PolicyName, To: name})
+		p.PolicyName = name
+	}
+
+	pd := &p.ProvidersData
+	if pd.Aws != nil {
+		aws := *pd.Aws
+		aws.AccountIds = mapValues("providersData.AWS.accountIds", aws.AccountIds, m.AccountIDs, &subs)
+		aws.Regions = mapValues("providersData.AWS.regions", aws.Regions, m.Regions, &subs)
+		aws.VpcIds = mapValues("providersData.AWS.vpcIds", aws.VpcIds, m.VpcIDs, &subs)
+		aws.Tags = mapTags("providersData.AWS.tags", aws.Tags, m.TagValues, &subs)
+		pd.Aws = &aws
+	}
+	if pd.Azure != nil {
+		azure := *pd.Azure
+		azure.Subscriptions = mapValues("providersData.Azure.subscriptions", azure.Subscriptions, m.AccountIDs, &subs)
+		azure.Regions = mapValues("providersData.Azure.regions", azure.Regions, m.Regions, &subs)
+		azure.VnetIds = mapValues("providersData.Azure.vnetIds", azure.VnetIds, m.VpcIDs, &subs)
+		azure.Tags = mapTags("providersData.Azure.tags", azure.Tags, m.TagValues, &subs)
+		pd.Azure = &azure
+	}
+	if pd.Gcp != nil {
+		gcp := *pd.Gcp
+		gcp.Projects = mapValues("providersData.GCP.projects", gcp.Projects, m.AccountIDs, &subs)
+		gcp.Regions = mapValues("providersData.GCP.regions", gcp.Regions, m.Regions, &subs)
+		gcp.VpcIds = mapValues("providersData.GCP.vpc_ids", gcp.VpcIds, m.VpcIDs, &subs)
+		if gcp.Labels != nil {
+			labels := make([]types.Tags, len(gcp.Labels))
+			for i, l := range gcp.Labels {
+				labels[i] = types.Tags(l)
+			}
+			gcp.Labels = make([]types.Labels, len(labels))
+			for i, l := range mapTags("providersData.GCP.labels", labels, m.TagValues, &subs) {
+				gcp.Labels[i] = types.Labels(l)
+			}
+		}
+		pd.Gcp = &gcp
+	}
+
+	if p.UserAccessRules != nil {
+		rules := make([]types.UserAccessRules, len(p.UserAccessRules))
+		for i, r := range p.UserAccessRules {
+			if r.UserData.Roles != nil {
+				roles := make([]types.Roles, len(r.UserData.Roles))
+				for j, role := range r.UserData.Roles {
+					if to, ok := m.Roles[role.Name]; ok && to != role.Name {
+						subs = append(subs, Substitution{Field: fmt.Sprintf("userAccessRules[%d].userData.roles[%d].name", i, j), From: role.Name, To: to})
+						role.Name = to
+					}
+					roles[j] = role
+				}
+				r.UserData.Roles = roles
+			}
+			rules[i] = r
+		}
+		p.UserAccessRules = rules
+	}
+	return p, subs
+}
+
+// Returns a copy of values with the mapped values replaced
+func mapValues(field string, values []string, m map[string]string, subs *[]Substitution) []string {
+	if values == nil {
+		return nil
+	}
+	mapped := make([]string, len(values))
+	for i, v := range values {
+		if to, ok := m[v]; ok && to != v {
+			*subs = append(*subs, Substitution{Field: fmt.Sprintf("%s[%d]", field, i), From: v, To: to})
+			v = to
+		}
+		mapped[i] = v
+	}
+	return mapped
+}
+
+// Returns a copy of tags with the mapped values replaced
+func mapTags(field string, tags []types.Tags, m map[string]string, subs *[]Substitution) []types.Tags {
+	if tags == nil {
+		return nil
+	}
+	mapped := make([]types.Tags, len(tags))
+	for i, t := range tags {
+		mapped[i] = types.Tags{Key: t.Key, Value: mapValues(fmt.Sprintf("%s[%d].Value", field, i), t.Value, m, subs)}
+	}
+	return mapped
+}
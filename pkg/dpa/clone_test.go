@@ -0,0 +1,144 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Returns a staging policy with a value for each mapping
+func clonePolicy() types.Policy {
+	p := validPolicy()
+	p.ProvidersData = types.ProvidersData{
+		Aws: &types.Aws{
+			AccountIds: []string{"111111111111", "333333333333"},
+			Regions:    []string{"us-east-1"},
+			VpcIds:     []string{"vpc-staging"},
+			Tags:       []types.Tags{{Key: "env", Value: []string{"staging", "shared"}}},
+		},
+		Gcp: &types.Gcp{
+			Projects: []string{"111111111111"},
+			Labels:   []types.Labels{{Key: "env", Value: []string{"staging"}}},
+		},
+	}
+	p.UserAccessRules[0].UserData.Roles = []types.Roles{{Name: "Staging Ops", Source: "IDENTITY"}, {Name: "Auditors"}}
+	return p
+}
+
+var cloneMapping = PolicyMapping{
+	AccountIDs: map[string]string{"111111111111": "222222222222"},
+	Regions:    map[string]string{"us-east-1": "eu-west-1"},
+	VpcIDs:     map[string]string{"vpc-staging": "vpc-prod"},
+	Roles:      map[string]string{"Staging Ops": "Prod Ops"},
+	TagValues:  map[string]string{"staging": "prod"},
+	NamePrefix: "Prod ",
+}
+
+func TestApplyPolicyMapping(t *testing.T) {
+	source := clonePolicy()
+	got, subs := ApplyPolicyMapping(source, cloneMapping)
+
+	want := []Substitution{
+		{Field: "policyName", From: "Ops", To: "Prod Ops"},
+		{Field: "providersData.AWS.accountIds[0]", From: "111111111111", To: "222222222222"},
+		{Field: "providersData.AWS.regions[0]", From: "us-east-1", To: "eu-west-1"},
+		{Field: "providersData.AWS.vpcIds[0]", From: "vpc-staging", To: "vpc-prod"},
+		{Field: "providersData.AWS.tags[0].Value[0]", From: "staging", To: "prod"},
+		{Field: "providersData.GCP.projects[0]", From: "111111111111", To: "222222222222"},
+		{Field: "providersData.GCP.labels[0].Value[0]", From: "staging", To: "prod"},
+		{Field: "userAccessRules[0].userData.roles[0].name", From: "Staging Ops", To: "Prod Ops"},
+	}
+	if !reflect.DeepEqual(subs, want) {
+		t.Errorf("ApplyPolicyMapping() substitutions = %+v, want %+v", subs, want)
+	}
+	if got.ProvidersData.Aws.AccountIds[1] != "333333333333" || got.ProvidersData.Aws.Tags[0].Value[1] != "shared" ||
+		got.UserAccessRules[0].UserData.Roles[1].Name != "Auditors" || got.UserAccessRules[0].UserData.Roles[0].Source != "IDENTITY" {
+		t.Errorf("ApplyPolicyMapping() changed unmapped values = %+v", got)
+	}
+
+	// The source policy is not modified
+	if !reflect.DeepEqual(source, clonePolicy()) {
+		t.Errorf("ApplyPolicyMapping() modified the source policy = %+v", source)
+	}
+
+	if got, subs := ApplyPolicyMapping(source, PolicyMapping{}); len(subs) != 0 || !reflect.DeepEqual(got, source) {
+		t.Errorf("ApplyPolicyMapping() empty mapping = %+v, %+v", got, subs)
+	}
+}
+
+// Returns a server serving the policy and recording added policies
+func cloneServer(policy *types.Policy, added *[]types.Policy) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && policy != nil && r.URL.Path == "/api/access-policies/"+policy.PolicyID:
+			json.NewEncoder(w).Encode(policy)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/access-policies":
+			var p types.Policy
+			json.NewDecoder(r.Body).Decode(&p)
+			*added = append(*added, p)
+			w.Write([]byte(`{"policyId": "new-id"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"DPA_NOT_FOUND","message":"Policy not found"}`))
+		}
+	}))
+}
+
+func TestClonePolicy(t *testing.T) {
+	source := clonePolicy()
+	var stagingAdded, prodAdded []types.Policy
+	staging := cloneServer(&source, &stagingAdded)
+	defer staging.Close()
+	prod := cloneServer(nil, &prodAdded)
+	defer prod.Close()
+
+	// Valid Services using httptest New Server URLs
+	ss, _ := NewService(staging.URL, "api", false, validToken)
+	ps, _ := NewService(prod.URL, "api", false, validToken)
+
+	got, dpaerr, err := ss.ClonePolicy(context.Background(), "id-1", ps, cloneMapping)
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("ClonePolicy() error = %v, %v", err, dpaerr)
+	}
+	if got.SourceID != "id-1" || got.PolicyID != "new-id" || got.Policy.PolicyID != "new-id" || len(got.Substitutions) != 8 {
+		t.Errorf("ClonePolicy() = %+v", got)
+	}
+	if len(stagingAdded) != 0 || len(prodAdded) != 1 {
+		t.Fatalf("ClonePolicy() added %d policies to staging and %d to prod", len(stagingAdded), len(prodAdded))
+	}
+	if p := prodAdded[0]; p.PolicyID != "" || p.UpdatedOn != "" || p.PolicyName != "Prod Ops" || p.ProvidersData.Aws.AccountIds[0] != "222222222222" {
+		t.Errorf("ClonePolicy() added %+v", p)
+	}
+
+	// Without a target the policy is cloned in the same tenant
+	if _, _, err := ss.ClonePolicy(context.Background(), "id-1", nil, PolicyMapping{NameSuffix: " (copy)"}); err != nil {
+		t.Fatalf("ClonePolicy() error = %v", err)
+	}
+	if len(stagingAdded) != 1 || stagingAdded[0].PolicyName != "Ops (copy)" {
+		t.Errorf("ClonePolicy() added %+v", stagingAdded)
+	}
+
+	if _, dpaerr, err := ss.ClonePolicy(context.Background(), "missing", ps, cloneMapping); err != nil || dpaerr.Empty() {
+		t.Errorf("ClonePolicy() expected error response, got %v, %v", err, dpaerr)
+	}
+	if _, _, err := ss.ClonePolicy(context.Background(), "", ps, cloneMapping); err == nil {
+		t.Errorf("ClonePolicy() expected error for empty id")
+	}
+
+	// The guardrails of the target apply
+	g, err := NewGuardrails(Guardrail{Name: "no-prod-ops", Expression: `!policy.policyName.startsWith("Prod")`})
+	if err != nil {
+		t.Fatalf("NewGuardrails() error = %v", err)
+	}
+	ps.SetGuardrails(g)
+	if _, _, err := ss.ClonePolicy(context.Background(), "id-1", ps, cloneMapping); !errors.Is(err, ErrGuardrailViolation) {
+		t.Errorf("ClonePolicy() error = %v, want guardrail violation", err)
+	}
+}
@@ -3,32 +3,23 @@ package dpa
 import (
 	"context"
 	"fmt"
-	"reflect"
-	"slices"
+	"strings"
 	"time"
 
 	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
 )
 
-var (
-	generateScriptResponse types.GenerateScriptResponse
-	errorResponse          types.ErrorResponse
-)
-
 // GenerateScript generates a request for a connector setup script
-// Body is optional, if nothing is provided a default script will be generated
-// The default script will be for a linux connector in AWS
+// Expects a types.GenerateScriptRequest with a valid ConnectorOS and
+// ConnectorType
 // Returns a GenerateScriptResponse or error if failed
 //
 // Example:
 //
 //	// Create Body for GenerateScript Request
-//	generateScriptRequest := struct {
-//		ConnectorOS   string `json:"connectorOs,omitempty"`
-//		ConnectorType string `json:"connectorType,omitempty"`
-//	}{
-//		"linux",
-//		"AWS"
+//	generateScriptRequest := types.GenerateScriptRequest{
+//		ConnectorOS:   types.ConnectorOSLinux,
+//		ConnectorType: types.ConnectorTypeAWS,
 //	}
 //
 //	// Generate Script using existing Service and Client
@@ -37,7 +28,7 @@ var (
 //		log.Fatalf("Failed to generate connector script. %s", err)
 //		return
 //	}
-func (s *Service) GenerateScript(ctx context.Context, p interface{}) (*types.GenerateScriptResponse, *types.ErrorResponse, error) {
+func (s *Service) GenerateScript(ctx context.Context, p types.GenerateScriptRequest) (*types.GenerateScriptResponse, *types.ErrorResponse, error) {
 	// Set a timeout for the request
 	ctx, cancelCtx := context.WithTimeout(ctx, 10000*time.Millisecond)
 
@@ -47,6 +38,8 @@ func (s *Service) GenerateScript(ctx context.Context, p interface{}) (*types.Gen
 	}
 
 	// Make request for connector setup script via service client
+	var generateScriptResponse types.GenerateScriptResponse
+	var errorResponse types.ErrorResponse
 	if err := s.client.Post(ctx, "/connectors/setup-script", p, &generateScriptResponse, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("generateScript: Failed to retrieve script. %s", err)
@@ -57,34 +50,15 @@ func (s *Service) GenerateScript(ctx context.Context, p interface{}) (*types.Gen
 }
 
 // Validates proper parameters were passed for the GenerateScript API endpoint
-func parameterValidation(p interface{}) error {
-	// Validate provided type
-	val := reflect.ValueOf(p)
-	if val.Kind() != reflect.Struct {
-		return fmt.Errorf("parameterValidation: Invalid type provided %s. Must be a struct", val.Kind())
-	}
-
-	// Validate provided fields
-	field1 := val.FieldByName("ConnectorOS")
-	field2 := val.FieldByName("ConnectorType")
-	if !field1.IsValid() || !field2.IsValid() {
-		return fmt.Errorf("parameterValidation: Invalid fields provided %s, %s. Must be ConnectorOS and ConnectorType", val.Field(0).String(), val.Field(1).String())
-	}
-
-	// Validate provided values
-	validOS := []string{"linux", "windows", "darwin"}
-	validType := []string{"AWS", "AZURE", "GCP", "ON-PREMISE"}
-
-	// Validate provided  Connector OS
-	containsOs := slices.Contains(validOS, val.FieldByName("ConnectorOS").String())
-	if !containsOs {
-		return fmt.Errorf("parameterValidation: Invalid Connector OS provided %s. Valid options are linux, windows, darwin", val.FieldByName("ConnectorOS").String())
+func parameterValidation(p types.GenerateScriptRequest) error {
+	// Validate provided Connector OS
+	if !p.ConnectorOS.Valid() {
+		return fmt.Errorf("parameterValidation: Invalid Connector OS provided %s. Valid options are %s", p.ConnectorOS, strings.Join(enumNames(types.ConnectorOSes), ", "))
 	}
 
 	// Validate provided Connector Type
-	containsType := slices.Contains(validType, val.FieldByName("ConnectorType").String())
-	if !containsType {
-		return fmt.Errorf("parameterValidation: Invalid Connector Type provided %s. Valid options are AWS, AZURE, GCP, ON-PREMISE", val.FieldByName("ConnectorType").String())
+	if !p.ConnectorType.Valid() {
+		return fmt.Errorf("parameterValidation: Invalid Connector Type provided %s. Valid options are %s", p.ConnectorType, strings.Join(enumNames(types.ConnectorTypes), ", "))
 	}
 
 	return nil
@@ -4,83 +4,35 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
 	"golang.org/x/oauth2"
 )
 
-// Both tests test the validation of the field names of the input struct
-// Expect error for both tests
-func TestParameterValidation_FieldNameValidation(t *testing.T) {
-	var tests = []struct {
-		name    string
-		input   interface{}
-		want    string
-		wantErr bool
-	}{
-		{
-			name: "Valid Field Names",
-			input: struct{ ConnectorOS, ConnectorType string }{
-				ConnectorOS:   "linux",
-				ConnectorType: "AWS",
-			},
-			wantErr: false,
-		},
-		{
-			name: "Not Valid Field Name 1",
-			input: struct{ OS, ConnectorType string }{
-				OS:            "linux",
-				ConnectorType: "AWS",
-			},
-			wantErr: true,
-		},
-		{
-			name: "Not Valid Field Name 2",
-			input: struct{ ConnectorOS, Type string }{
-				ConnectorOS: "linux",
-				Type:        "AWS",
-			},
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := parameterValidation(tt.input)
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("GenerateScript() error = %v, wantErr %v", err, tt.wantErr)
-				}
-			} else {
-				if err != nil {
-					t.Errorf("GenerateScript() error = %v, wantErr %v", err, tt.wantErr)
-				}
-			}
-		})
-	}
-}
-
 // All tests test the validation of the field values of the input struct
 // Expect error for all tests
 func TestParameterValidation_FieldValueValidation(t *testing.T) {
 	var tests = []struct {
 		name    string
-		input   interface{}
+		input   types.GenerateScriptRequest
 		want    string
 		wantErr bool
 	}{
 		{
 			name: "Not Valid Field Value 1",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "ubuntu",
 				ConnectorType: "AWS",
 			},
+			want:    "Valid options are linux, windows, darwin",
 			wantErr: true,
 		},
 		{
 			name: "Not Valid Field Value 2",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows10",
 				ConnectorType: "AWS",
 			},
@@ -88,15 +40,16 @@ func TestParameterValidation_FieldValueValidation(t *testing.T) {
 		},
 		{
 			name: "Not Valid Field Value 3",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "OCI",
 			},
+			want:    "Valid options are AWS, AZURE, GCP, ON-PREMISE",
 			wantErr: true,
 		},
 		{
 			name: "Valid Values",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "AWS",
 			},
@@ -108,8 +61,8 @@ func TestParameterValidation_FieldValueValidation(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			err := parameterValidation(tt.input)
 			if tt.wantErr {
-				if err == nil {
-					t.Errorf("GenerateScript() error = %v, wantErr %v", err, tt.wantErr)
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("GenerateScript() error = %v, want %q", err, tt.want)
 				}
 			} else {
 				if err != nil {
@@ -123,7 +76,7 @@ func TestParameterValidation_FieldValueValidation(t *testing.T) {
 func TestGenerateScript(t *testing.T) {
 	var tests = []struct {
 		name     string
-		input    interface{}
+		input    types.GenerateScriptRequest
 		header   http.ConnState
 		sleep    time.Duration
 		response string
@@ -132,28 +85,20 @@ func TestGenerateScript(t *testing.T) {
 	}{
 		{
 			name: "Not Valid Field Values",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "ubuntu",
 				ConnectorType: "AWS",
 			},
 			wantErr: true,
 		},
 		{
-			name: "Not Valid Field Name",
-			input: struct{ OS, ConnectorType string }{
-				OS:            "linux",
-				ConnectorType: "AWS",
-			},
-			wantErr: true,
-		},
-		{
-			name:    "Not Valid Type",
-			input:   "test",
+			name:    "Empty Request",
+			input:   types.GenerateScriptRequest{},
 			wantErr: true,
 		},
 		{
 			name: "Valid Values",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "AWS",
 			},
@@ -164,7 +109,7 @@ func TestGenerateScript(t *testing.T) {
 		},
 		{
 			name: "Status Bad Request",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "AWS",
 			},
@@ -175,7 +120,7 @@ func TestGenerateScript(t *testing.T) {
 		},
 		{
 			name: "Timeout",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "AWS",
 			},
@@ -186,7 +131,7 @@ func TestGenerateScript(t *testing.T) {
 		},
 		{
 			name: "Status Not Found",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "AWS",
 			},
@@ -196,7 +141,7 @@ func TestGenerateScript(t *testing.T) {
 		},
 		{
 			name: "Status Forbidden",
-			input: struct{ ConnectorOS, ConnectorType string }{
+			input: types.GenerateScriptRequest{
 				ConnectorOS:   "windows",
 				ConnectorType: "AWS",
 			},
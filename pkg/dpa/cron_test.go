@@ -0,0 +1,101 @@
+package dpa
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	var tests = []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 22 * * FRI"},
+		{expr: "*/15 8-18 * * mon-fri"},
+		{expr: "0 0 1,15 JAN-jun 0"},
+		{expr: "30 6 * * 7"},
+		{expr: "@daily"},
+		{expr: "5/20 * * * *"},
+		{expr: "0 22 * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "0 18-8 * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "0 0 0 * *", wantErr: true},
+		{expr: "0 0 * * FRIDAY", wantErr: true},
+		{expr: "@fortnightly", wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := ParseCron(tt.expr); (err != nil) != tt.wantErr {
+			t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	// Friday
+	from := time.Date(2024, 5, 3, 21, 15, 30, 0, berlin)
+
+	var tests = []struct {
+		expr     string
+		from     time.Time
+		wantNext time.Time
+		wantPrev time.Time
+	}{
+		{
+			expr:     "0 22 * * FRI",
+			from:     from,
+			wantNext: time.Date(2024, 5, 3, 22, 0, 0, 0, berlin),
+			wantPrev: time.Date(2024, 4, 26, 22, 0, 0, 0, berlin),
+		},
+		{
+			expr:     "*/20 8-18 * * mon-fri",
+			from:     from,
+			wantNext: time.Date(2024, 5, 6, 8, 0, 0, 0, berlin),
+			wantPrev: time.Date(2024, 5, 3, 18, 40, 0, 0, berlin),
+		},
+		{
+			// Either day field matches when both are restricted
+			expr:     "0 0 1 * SUN",
+			from:     from,
+			wantNext: time.Date(2024, 5, 5, 0, 0, 0, 0, berlin),
+			wantPrev: time.Date(2024, 5, 1, 0, 0, 0, 0, berlin),
+		},
+		{
+			expr:     "@yearly",
+			from:     from,
+			wantNext: time.Date(2025, 1, 1, 0, 0, 0, 0, berlin),
+			wantPrev: time.Date(2024, 1, 1, 0, 0, 0, 0, berlin),
+		},
+		{
+			// 02:30 does not exist when daylight saving time starts
+			expr:     "30 2 * * *",
+			from:     time.Date(2024, 3, 30, 12, 0, 0, 0, berlin),
+			wantNext: time.Date(2024, 4, 1, 2, 30, 0, 0, berlin),
+			wantPrev: time.Date(2024, 3, 30, 2, 30, 0, 0, berlin),
+		},
+		{
+			expr:     "0 0 30 2 *",
+			from:     from,
+			wantNext: time.Time{},
+			wantPrev: time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+			if got := c.Next(tt.from); !got.Equal(tt.wantNext) {
+				t.Errorf("Next() = %s, want %s", got, tt.wantNext)
+			}
+			if got := c.prev(tt.from, tt.from.AddDate(-1, 0, -1)); !got.Equal(tt.wantPrev) {
+				t.Errorf("prev() = %s, want %s", got, tt.wantPrev)
+			}
+		})
+	}
+}
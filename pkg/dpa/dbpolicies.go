@@ -0,0 +1,276 @@
+package dpa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Path of the database access policies API
+const databasePoliciesPath = "/access-policies/db"
+
+// ListDatabasePolicies returns all of the configured database policies.
+// Further pages are requested when TotalCount is larger than the items
+// returned.
+// Returns types.ListDatabasePolicies or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	resp, dpaerr, err := s.ListDatabasePolicies(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to list database policies. %s", err)
+//		return
+//	}
+func (s *Service) ListDatabasePolicies(ctx context.Context) (*types.ListDatabasePolicies, *types.ErrorResponse, error) {
+	items, dpaerr, err := listAllPages(ctx, s, "listDatabasePolicies", databasePoliciesPath, nil, func(i types.DatabasePolicyItem) string { return i.PolicyID })
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	return &types.ListDatabasePolicies{Items: items, TotalCount: len(items)}, dpaerr, nil
+}
+
+// GetDatabasePolicy returns the details of a database policy
+// Returns types.DatabasePolicy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	resp, dpaerr, err := s.GetDatabasePolicy(context.Background(), "c12f982a-ab1a-12ab-1a31-f221aa31836b")
+//	if err != nil {
+//		log.Fatalf("Failed to get database policy. %s", err)
+//		return
+//	}
+func (s *Service) GetDatabasePolicy(ctx context.Context, i string) (*types.DatabasePolicy, *types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	// Check if policy id is empty
+	if len(i) == 0 {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("getDatabasePolicy: Policy id cannot be empty")
+	}
+
+	path := fmt.Sprintf("%s/%s", databasePoliciesPath, i)
+	var policy types.DatabasePolicy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Get(ctx, path, &policy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("getDatabasePolicy: Failed to get database policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &policy, &errorResponse, nil
+}
+
+// AddDatabasePolicy creates a new database policy
+// Returns types.AddPolicy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure.
+//
+// Example:
+//
+//	policy := types.DatabasePolicy{
+//		PolicyName: "Payments Database Access",
+//		Status:     types.PolicyStatusEnabled,
+//		ProvidersData: types.DatabaseProvidersData{
+//			PostgreSQL: &types.DatabaseResources{Resources: []string{"payments-db"}},
+//		},
+//		UserAccessRules: []types.DatabaseAccessRule{
+//			{
+//				RuleName: "Payments Engineers",
+//				UserData: types.UserData{Roles: []types.Roles{{Name: "Payments Engineers"}}},
+//				ConnectionInformation: types.DatabaseConnectionInformation{
+//					ConnectAs: types.DatabaseConnectAs{
+//						DBAuth: []types.DatabaseRoleAuth{{Roles: []string{"readonly"}, ApplyTo: []string{"payments-db"}}},
+//					},
+//					GrantAccess: 2,
+//					FullDays:    true,
+//					TimeZone:    "UTC",
+//				},
+//			},
+//		},
+//	}
+//
+//	resp, dpaerr, err := s.AddDatabasePolicy(context.Background(), policy)
+//	if err != nil {
+//		log.Fatalf("Failed to add database policy. %s", err)
+//		return
+//	}
+func (s *Service) AddDatabasePolicy(ctx context.Context, p types.DatabasePolicy) (*types.AddPolicy, *types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	var addPolicy types.AddPolicy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Post(ctx, databasePoliciesPath, p, &addPolicy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("addDatabasePolicy: Failed to add database policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &addPolicy, &errorResponse, nil
+}
+
+// UpdateDatabasePolicy replaces an existing database policy using a PUT
+// request. The policy id in the request body must match the policy id in
+// the path, a mismatch is rejected before the request is sent.
+// Returns types.DatabasePolicy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure, wrapping
+// ErrConflict when the policy was modified concurrently.
+//
+// Example:
+//
+//	policy.Status = types.PolicyStatusDisabled
+//	resp, dpaerr, err := s.UpdateDatabasePolicy(context.Background(), policy, policy.PolicyID)
+//	if err != nil {
+//		log.Fatalf("Failed to update database policy. %s", err)
+//		return
+//	}
+func (s *Service) UpdateDatabasePolicy(ctx context.Context, p types.DatabasePolicy, i string) (*types.DatabasePolicy, *types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	if len(i) == 0 {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updateDatabasePolicy: Policy id cannot be empty")
+	}
+	if p.PolicyID != i {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updateDatabasePolicy: Policy id in the request body must match policy id %s", i)
+	}
+
+	path := fmt.Sprintf("%s/%s", databasePoliciesPath, i)
+	var policy types.DatabasePolicy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Put(ctx, path, p, &policy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updateDatabasePolicy: Failed to update database policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &policy, &errorResponse, nil
+}
+
+// DeleteDatabasePolicy deletes a database policy
+// Returns no response if succesfull or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure.
+//
+// Example:
+//
+//	dpaerr, err := s.DeleteDatabasePolicy(context.Background(), "c12f982a-ab1a-12ab-1a31-f221aa31836a")
+//	if err != nil {
+//		log.Fatalf("Failed to delete database policy. %s", err)
+//		return
+//	}
+func (s *Service) DeleteDatabasePolicy(ctx context.Context, i string) (*types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	if len(i) == 0 {
+		defer cancelCtx()
+		return nil, fmt.Errorf("deleteDatabasePolicy: Policy id cannot be empty")
+	}
+
+	path := fmt.Sprintf("%s/%s", databasePoliciesPath, i)
+	var deletePolicy string
+	var errorResponse types.ErrorResponse
+	if err := s.client.Delete(ctx, path, nil, &deletePolicy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, fmt.Errorf("deleteDatabasePolicy: Failed to delete database policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &errorResponse, nil
+}
+
+// ValidateDatabasePolicy checks a database policy is complete before it is
+// sent to the API. Besides the checks of ValidatePolicy, every rule needs
+// at least one connect as method, ephemeral user profiles need roles, and
+// the databases a method applies to must be covered by the policy.
+// All problems found are returned joined in a single error.
+//
+// Example:
+//
+//	if err := dpa.ValidateDatabasePolicy(policy); err != nil {
+//		log.Fatalf("Invalid database policy. %s", err)
+//		return
+//	}
+func ValidateDatabasePolicy(p types.DatabasePolicy) error {
+	var errs validationErrors
+	errs.policy(p.PolicyName, p.Status, p.StartDate, p.EndDate)
+
+	resources := databaseResources(p.ProvidersData)
+	if len(resources) == 0 {
+		errs.add("providersData must include at least one database engine with resources")
+	}
+
+	if len(p.UserAccessRules) == 0 {
+		errs.add("userAccessRules must include at least one rule")
+	}
+	names := map[string]bool{}
+	for i, r := range p.UserAccessRules {
+		path := fmt.Sprintf("userAccessRules[%d]", i)
+		errs.rule(path, r.RuleName, r.UserData, names)
+
+		ci := r.ConnectionInformation
+		ca := ci.ConnectAs
+		if len(ca.DBAuth) == 0 && len(ca.LdapAuth) == 0 && ca.RdsIamUserAuth == nil {
+			errs.add("%s.connectionInformation.connectAs must include dbAuth, ldapAuth or rdsIamUserAuth", path)
+		}
+		for j, a := range ca.DBAuth {
+			authPath := fmt.Sprintf("%s.connectionInformation.connectAs.dbAuth[%d]", path, j)
+			if len(a.Roles) == 0 {
+				errs.add("%s.roles must include at least one role", authPath)
+			}
+			errs.applyTo(authPath, a.ApplyTo, resources)
+		}
+		for j, a := range ca.LdapAuth {
+			authPath := fmt.Sprintf("%s.connectionInformation.connectAs.ldapAuth[%d]", path, j)
+			if len(a.AssignGroups) == 0 {
+				errs.add("%s.assignGroups must include at least one group", authPath)
+			}
+			errs.applyTo(authPath, a.ApplyTo, resources)
+		}
+		if a := ca.RdsIamUserAuth; a != nil {
+			authPath := path + ".connectionInformation.connectAs.rdsIamUserAuth"
+			if len(a.User) == 0 {
+				errs.add("%s.user cannot be empty", authPath)
+			}
+			errs.applyTo(authPath, a.ApplyTo, resources)
+		}
+		errs.schedule(path+".connectionInformation", ci.GrantAccess, ci.TimeZone, ci.FullDays, ci.HoursFrom, ci.HoursTo)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Checks the databases a connect as method applies to are in the policy
+func (v *validationErrors) applyTo(path string, applyTo, resources []string) {
+	if len(applyTo) == 0 {
+		v.add("%s.applyTo must include at least one database", path)
+	}
+	if slices.Contains(resources, "*") {
+		return
+	}
+	for _, name := range applyTo {
+		if !slices.Contains(resources, name) {
+			v.add("%s.applyTo database %q is not in providersData", path, name)
+		}
+	}
+}
+
+// Returns the resources of every database engine in the policy
+func databaseResources(pd types.DatabaseProvidersData) []string {
+	var resources []string
+	v := reflect.ValueOf(pd)
+	for i := 0; i < v.NumField(); i++ {
+		if r, ok := v.Field(i).Interface().(*types.DatabaseResources); ok && r != nil {
+			resources = append(resources, r.Resources...)
+		}
+	}
+	return resources
+}
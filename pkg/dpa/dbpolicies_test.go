@@ -0,0 +1,271 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func validDatabasePolicy() types.DatabasePolicy {
+	return types.DatabasePolicy{
+		PolicyID:   "c12f982a-ab1a-12ab-1a31-f221aa31836a",
+		PolicyName: "Payments Database Access",
+		Status:     types.PolicyStatusEnabled,
+		ProvidersData: types.DatabaseProvidersData{
+			PostgreSQL: &types.DatabaseResources{Resources: []string{"payments-db"}},
+			MSSQL:      &types.DatabaseResources{Resources: []string{"ledger-db"}},
+		},
+		UserAccessRules: []types.DatabaseAccessRule{
+			{
+				RuleName: "Payments Engineers",
+				UserData: types.UserData{Roles: []types.Roles{{Name: "Payments Engineers"}}},
+				ConnectionInformation: types.DatabaseConnectionInformation{
+					ConnectAs: types.DatabaseConnectAs{
+						DBAuth:   []types.DatabaseRoleAuth{{Roles: []string{"readonly"}, ApplyTo: []string{"payments-db"}}},
+						LdapAuth: []types.DatabaseLdapAuth{{AssignGroups: []string{"ledger-readers"}, ApplyTo: []string{"ledger-db"}}},
+					},
+					GrantAccess: 2,
+					DaysOfWeek:  []types.DayOfWeek{types.Monday},
+					HoursFrom:   "08:00",
+					HoursTo:     "17:00",
+					TimeZone:    "UTC",
+				},
+			},
+		},
+	}
+}
+
+func TestDatabasePolicies(t *testing.T) {
+	policy := validDatabasePolicy()
+	policyJSON, _ := json.Marshal(policy)
+
+	var tests = []struct {
+		name       string
+		call       func(*Service) (interface{}, *types.ErrorResponse, error)
+		header     int
+		response   string
+		wantMethod string
+		wantPath   string
+		wantDpa    bool
+		wantErr    bool
+		wantIs     error
+	}{
+		{
+			name: "List Database Policies",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.ListDatabasePolicies(context.Background())
+			},
+			header:     http.StatusOK,
+			response:   `{"items": [{"policyId": "id-1", "policyName": "Payments", "providers": ["postgres", "mssql"]}], "totalCount": 1}`,
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/access-policies/db",
+		},
+		{
+			name: "Get Database Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.GetDatabasePolicy(context.Background(), policy.PolicyID)
+			},
+			header:     http.StatusOK,
+			response:   string(policyJSON),
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/access-policies/db/" + policy.PolicyID,
+		},
+		{
+			name: "Get Database Policy Not Found",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.GetDatabasePolicy(context.Background(), policy.PolicyID)
+			},
+			header:     http.StatusNotFound,
+			response:   `{"code":"DPA_NOT_FOUND","message":"Policy not found"}`,
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/access-policies/db/" + policy.PolicyID,
+			wantDpa:    true,
+		},
+		{
+			name: "Add Database Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.AddDatabasePolicy(context.Background(), policy)
+			},
+			header:     http.StatusCreated,
+			response:   `{"policyId": "id-new"}`,
+			wantMethod: http.MethodPost,
+			wantPath:   "/api/access-policies/db",
+		},
+		{
+			name: "Update Database Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.UpdateDatabasePolicy(context.Background(), policy, policy.PolicyID)
+			},
+			header:     http.StatusOK,
+			response:   string(policyJSON),
+			wantMethod: http.MethodPut,
+			wantPath:   "/api/access-policies/db/" + policy.PolicyID,
+		},
+		{
+			name: "Update Database Policy Conflict",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.UpdateDatabasePolicy(context.Background(), policy, policy.PolicyID)
+			},
+			header:     http.StatusConflict,
+			wantMethod: http.MethodPut,
+			wantErr:    true,
+			wantIs:     ErrConflict,
+		},
+		{
+			name: "Update Database Policy Mismatched ID",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.UpdateDatabasePolicy(context.Background(), policy, "another-id")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Delete Database Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				dpaerr, err := s.DeleteDatabasePolicy(context.Background(), policy.PolicyID)
+				return nil, dpaerr, err
+			},
+			header:     http.StatusOK,
+			wantMethod: http.MethodDelete,
+			wantPath:   "/api/access-policies/db/" + policy.PolicyID,
+		},
+		{
+			name: "Delete Database Policy Empty ID",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				dpaerr, err := s.DeleteDatabasePolicy(context.Background(), "")
+				return nil, dpaerr, err
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path string
+			var body []byte
+
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, path = r.Method, r.URL.Path
+				body, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.header)
+				w.Write([]byte(tt.response))
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			_, dpaerr, err := tt.call(ns)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+					t.Errorf("error = %v, want wrapping %v", err, tt.wantIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if dpaerr.Empty() == tt.wantDpa {
+				t.Errorf("error response = %+v, wantDpa %v", dpaerr, tt.wantDpa)
+			}
+			if method != tt.wantMethod || path != tt.wantPath {
+				t.Errorf("request = %s %s, want %s %s", method, path, tt.wantMethod, tt.wantPath)
+			}
+			if method == http.MethodPost && !strings.Contains(string(body), `"postgres":{"resources":["payments-db"]}`) {
+				t.Errorf("request body = %s", body)
+			}
+		})
+	}
+}
+
+func TestDatabasePolicyEnumValidation(t *testing.T) {
+	var item types.DatabasePolicyItem
+	if err := json.Unmarshal([]byte(`{"providers": ["postgres", "sybase"]}`), &item); err == nil {
+		t.Errorf("Unmarshal() expected error for unknown database engine")
+	}
+
+	var enumErr *types.EnumError
+	p := validDatabasePolicy()
+	p.Status = "Paused"
+	if _, err := json.Marshal(p); !errors.As(err, &enumErr) {
+		t.Errorf("Marshal() error = %v, want EnumError", err)
+	}
+}
+
+func TestValidateDatabasePolicy(t *testing.T) {
+	var tests = []struct {
+		name    string
+		edit    func(*types.DatabasePolicy)
+		wantErr bool
+	}{
+		{
+			name: "Valid Policy",
+			edit: func(p *types.DatabasePolicy) {},
+		},
+		{
+			name: "Wildcard Resources",
+			edit: func(p *types.DatabasePolicy) {
+				p.ProvidersData = types.DatabaseProvidersData{MySQL: &types.DatabaseResources{Resources: []string{"*"}}}
+			},
+		},
+		{
+			name:    "Missing Engine",
+			edit:    func(p *types.DatabasePolicy) { p.ProvidersData = types.DatabaseProvidersData{} },
+			wantErr: true,
+		},
+		{
+			name: "Missing Connect As",
+			edit: func(p *types.DatabasePolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs = types.DatabaseConnectAs{}
+			},
+			wantErr: true,
+		},
+		{
+			name: "Profile Without Roles",
+			edit: func(p *types.DatabasePolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.DBAuth[0].Roles = nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "Apply To Unknown Database",
+			edit: func(p *types.DatabasePolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.DBAuth[0].ApplyTo = []string{"orders-db"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "IAM User Without User",
+			edit: func(p *types.DatabasePolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.RdsIamUserAuth = &types.DatabaseIamUserAuth{ApplyTo: []string{"payments-db"}}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Schedule",
+			edit:    func(p *types.DatabasePolicy) { p.UserAccessRules[0].ConnectionInformation.GrantAccess = 48 },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validDatabasePolicy()
+			tt.edit(&p)
+			if err := ValidateDatabasePolicy(p); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateDatabasePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package dpa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// PolicyDifference is a single value which differs between two policies.
+// Path uses the JSON field names, for example
+// "userAccessRules[0].userData.roles[1].name". Before or After is empty
+// when the value is missing from that policy.
+type PolicyDifference struct {
+	Path   string `json:"path"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// DiffPolicies compares two policies as they would be sent to the API and
+// returns the differences ordered by path. PolicyID and UpdatedOn are
+// ignored so a local policy can be compared with the tenant's copy.
+//
+// Example:
+//
+//	for _, d := range dpa.DiffPolicies(current, desired) {
+//		fmt.Printf("%s: %s -> %s\n", d.Path, d.Before, d.After)
+//	}
+func DiffPolicies(a, b types.Policy) []PolicyDifference {
+	a.PolicyID, a.UpdatedOn = "", ""
+	b.PolicyID, b.UpdatedOn = "", ""
+
+	var diffs []PolicyDifference
+	diffValues("", jsonValue(a), jsonValue(b), &diffs)
+	sort.SliceStable(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+// WriteDiffText writes differences as human readable lines
+//
+//	userAccessRules[0].userData.roles[0].name: "Ops" -> "DevOps"
+func WriteDiffText(w io.Writer, diffs []PolicyDifference) error {
+	for _, d := range diffs {
+		before, after := d.Before, d.After
+		if len(before) == 0 {
+			before = "(none)"
+		}
+		if len(after) == 0 {
+			after = "(none)"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s -> %s\n", d.Path, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the generic JSON representation of a value
+func jsonValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	json.Unmarshal(b, &out)
+	return out
+}
+
+// Recursively compares two generic JSON values
+func diffValues(path string, a, b interface{}, diffs *[]PolicyDifference) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range keys {
+			child := k
+			if len(path) != 0 {
+				child = path + "." + k
+			}
+			diffValues(child, am[k], bm[k], diffs)
+		}
+		return
+	}
+
+	as, aIsSlice := a.([]interface{})
+	bs, bIsSlice := b.([]interface{})
+	if aIsSlice && bIsSlice {
+		for i := 0; i < max(len(as), len(bs)); i++ {
+			var av, bv interface{}
+			if i < len(as) {
+				av = as[i]
+			}
+			if i < len(bs) {
+				bv = bs[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), av, bv, diffs)
+		}
+		return
+	}
+
+	before, after := describeValue(a), describeValue(b)
+	if before != after {
+		*diffs = append(*diffs, PolicyDifference{Path: path, Before: before, After: after})
+	}
+}
+
+// Returns the compact JSON of a value, or an empty string when missing
+func describeValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -10,11 +10,6 @@ import (
 	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
 )
 
-var (
-	targetSetActivityResponse types.TargetSetActivityResponse
-	listTargetSetResponse     types.ListTargetSetResponse
-)
-
 // ListTargetSets returns a list of target sets
 // Query parameters can be used to filter the results and are optional
 // Valid query parameter keys are:
@@ -66,6 +61,8 @@ func (s *Service) ListTargetSets(ctx context.Context, query interface{}) (*types
 		path = "/discovery/targetsets"
 	}
 
+	var listTargetSetResponse types.ListTargetSetResponse
+	var errorResponse types.ErrorResponse
 	if err := s.client.Get(ctx, path, &listTargetSetResponse, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("getTargetSet: Failed to retrieve Target Sets. %s", err)
@@ -75,6 +72,44 @@ func (s *Service) ListTargetSets(ctx context.Context, query interface{}) (*types
 	return &listTargetSetResponse, &errorResponse, nil
 }
 
+// FetchTargetSets returns every target set, requesting further pages
+// while the response includes a b64_last_evaluated_key.
+// Returns types.TargetSetMapping or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	targetSets, dpaerr, err := s.FetchTargetSets(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to fetch target sets. %s", err)
+//		return
+//	}
+func (s *Service) FetchTargetSets(ctx context.Context) (*types.TargetSetMapping, *types.ErrorResponse, error) {
+	var targetSets types.TargetSetMapping
+	seen := map[string]bool{}
+	var query interface{}
+	for {
+		resp, dpaerr, err := s.ListTargetSets(ctx, query)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fetchTargetSets: %s", err)
+		}
+		if !dpaerr.Empty() {
+			return nil, dpaerr, nil
+		}
+		targetSets.TargetSets = append(targetSets.TargetSets, resp.TargetSets...)
+
+		// Stop at the last page, or if the API repeats a page key
+		key := resp.B64LastEvaluatedKey
+		if len(key) == 0 || seen[key] {
+			break
+		}
+		seen[key] = true
+		query = map[string]string{"b64StartKey": key}
+	}
+
+	return &targetSets, &types.ErrorResponse{}, nil
+}
+
 // AddTargetSet adds a target set or multiple target sets
 // The request body should be a struct containing an array of target sets
 // Struct is defined in pkg/cybr/dpa/types/dicovery.go as TargetSetMapping
@@ -115,6 +150,8 @@ func (s *Service) AddTargetSet(ctx context.Context, p interface{}) (*types.Targe
 	}
 
 	// Make request to add policy via service client
+	var targetSetActivityResponse types.TargetSetActivityResponse
+	var errorResponse types.ErrorResponse
 	if err := s.client.Post(ctx, "/discovery/targetsets", p, &targetSetActivityResponse, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("addTargetSet: Failed to add Target Set. %s", err)
@@ -156,6 +193,8 @@ func (s *Service) DeleteTargetSet(ctx context.Context, p interface{}) (*types.Ta
 
 	// Make request to delete target set(s) via service client
 	path := "/discovery/targetsets/bulk"
+	var targetSetActivityResponse types.TargetSetActivityResponse
+	var errorResponse types.ErrorResponse
 	if err := s.client.Delete(ctx, path, p, &targetSetActivityResponse, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("deleteTargetSet: Failed to delete target set. %s", err)
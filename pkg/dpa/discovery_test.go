@@ -172,7 +172,7 @@ func TestAddTargetSet(t *testing.T) {
 					{
 						Name:                        "test.com",
 						ProvisionFormat:             "<user>-<session-guid>",
-						EnableCertificateValidation: true,
+						EnableCertificateValidation: types.Bool(true),
 						SecretType:                  "PCloudAccount",
 						SecretID:                    "1239-809e-45ab-abef-d424244cc810e",
 						Type:                        "Domain",
@@ -0,0 +1,206 @@
+package dpa
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// TemporaryAccessTag starts the Description of every policy created by
+// GrantTemporaryAccess. The expiry time follows the tag, for example
+//
+//	dpa-temporary-access expires=2024-03-05T18:00:00Z
+const TemporaryAccessTag = "dpa-temporary-access"
+
+// Longest session a temporary grant allows, in hours
+const maxGrantAccessHours = 24
+
+// Longest temporary grant. A grant spans at most seven UTC days so that the
+// day of the week of each of its rules is unique.
+const maxGrantDuration = 6 * 24 * time.Hour
+
+// Returns the current time, replaced in tests
+var grantClock = time.Now
+
+// TemporaryGrant describes a policy created by GrantTemporaryAccess
+type TemporaryGrant struct {
+	PolicyID   string    `json:"policyId"`
+	PolicyName string    `json:"policyName"`
+	Expires    time.Time `json:"expires"`
+}
+
+// GrantTemporaryAccess creates an enabled policy giving a single user,
+// group or role access to the provided scope for a limited time, at most
+// six days. The policy has a rule for each UTC day of the grant whose
+// hours only allow connections between the grant time and its expiry, to
+// the minute. Its Description is tagged with TemporaryAccessTag and the
+// exact expiry, which SweepTemporaryAccess uses to delete the policy once
+// it has expired. The expired policy and sessions started before the expiry
+// remain until then, so SweepTemporaryAccess must still run on a schedule.
+// Returns a TemporaryGrant or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	identity := dpa.Principal{Kind: dpa.PrincipalUser, Name: "alice@example.com", Source: "IDENTITY"}
+//	scope := types.ProvidersData{Aws: &types.Aws{AccountIds: []string{"123456789012"}}}
+//	connectAs := types.ConnectAs{Aws: &types.ConnectAsAws{SSH: "ec2-user"}}
+//
+//	grant, dpaerr, err := s.GrantTemporaryAccess(context.Background(), identity, scope, connectAs, 4*time.Hour)
+//	if err != nil {
+//		log.Fatalf("Failed to grant access. %s", err)
+//		return
+//	}
+func (s *Service) GrantTemporaryAccess(ctx context.Context, identity Principal, scope types.ProvidersData, connectAs types.ConnectAs, duration time.Duration) (*TemporaryGrant, *types.ErrorResponse, error) {
+	if err := validatePrincipal(identity); err != nil {
+		return nil, nil, fmt.Errorf("grantTemporaryAccess: %s", err)
+	}
+	if duration < time.Minute || duration > maxGrantDuration {
+		return nil, nil, fmt.Errorf("grantTemporaryAccess: Duration must be between one minute and %s", maxGrantDuration)
+	}
+	if scope == (types.ProvidersData{}) {
+		return nil, nil, fmt.Errorf("grantTemporaryAccess: Scope must include at least one provider")
+	}
+
+	start := grantClock().UTC().Truncate(time.Minute)
+	policy := temporaryAccessPolicy(identity, scope, connectAs, start, duration)
+
+	added, dpaerr, err := s.AddPolicy(ctx, policy)
+	if err != nil {
+		return nil, nil, fmt.Errorf("grantTemporaryAccess: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	return &TemporaryGrant{
+		PolicyID:   added.PolicyID,
+		PolicyName: policy.PolicyName,
+		Expires:    start.Add(duration),
+	}, dpaerr, nil
+}
+
+// SweepTemporaryAccess deletes every policy created by GrantTemporaryAccess
+// which expired at or before the provided time. Policies without the
+// TemporaryAccessTag are never deleted.
+// Returns the deleted grants or types.ErrorResponse based on the response
+// from the API. On failure the grants deleted so far are returned with the
+// error.
+//
+// Example:
+//
+//	deleted, dpaerr, err := s.SweepTemporaryAccess(context.Background(), time.Now())
+//	if err != nil {
+//		log.Fatalf("Failed to sweep temporary access. %s", err)
+//		return
+//	}
+func (s *Service) SweepTemporaryAccess(ctx context.Context, at time.Time) ([]TemporaryGrant, *types.ErrorResponse, error) {
+	list, dpaerr, err := s.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sweepTemporaryAccess: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	var deleted []TemporaryGrant
+	for _, item := range list.Items {
+		expires, ok := parseTemporaryAccess(item.Description)
+		if !ok || expires.After(at) {
+			continue
+		}
+		dpaerr, err := s.DeletePolicy(ctx, item.PolicyID)
+		if err != nil {
+			return deleted, nil, fmt.Errorf("sweepTemporaryAccess: %s", err)
+		}
+		if !dpaerr.Empty() {
+			return deleted, dpaerr, nil
+		}
+		deleted = append(deleted, TemporaryGrant{PolicyID: item.PolicyID, PolicyName: item.PolicyName, Expires: expires})
+	}
+
+	return deleted, &types.ErrorResponse{}, nil
+}
+
+// Builds the policy created for a temporary grant. Each UTC day of the
+// grant has a rule limited to that day of the week, allowing the hours of
+// the day between start and the expiry, and sessions up to the length of
+// the grant.
+func temporaryAccessPolicy(identity Principal, scope types.ProvidersData, connectAs types.ConnectAs, start time.Time, duration time.Duration) types.Policy {
+	expires := start.Add(duration)
+	end := expires.Truncate(time.Minute)
+
+	var userData types.UserData
+	switch identity.Kind {
+	case PrincipalUser:
+		userData.Users = []types.Users{{Name: identity.Name, Source: identity.Source}}
+	case PrincipalGroup:
+		userData.Groups = []types.Groups{{Name: identity.Name, Source: identity.Source}}
+	case PrincipalRole:
+		userData.Roles = []types.Roles{{Name: identity.Name, Source: identity.Source}}
+	}
+
+	hours := int(math.Ceil(duration.Hours()))
+	hours = max(1, min(hours, maxGrantAccessHours))
+
+	var rules []types.UserAccessRules
+	var lastDay time.Time
+	for day := start.Truncate(24 * time.Hour); day.Before(end); day = day.AddDate(0, 0, 1) {
+		from, to := day, day.AddDate(0, 0, 1)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		ci := types.ConnectionInformation{
+			ConnectAs:   connectAs,
+			GrantAccess: hours,
+			DaysOfWeek:  []types.DayOfWeek{shortWeekday(day.Weekday())},
+			TimeZone:    "UTC",
+		}
+		if to.Sub(from) == 24*time.Hour {
+			ci.FullDays = true
+		} else {
+			// A window ending at midnight is written as 00:00 of the next day
+			ci.HoursFrom, ci.HoursTo = from.Format("15:04"), to.Format("15:04")
+		}
+		rules = append(rules, types.UserAccessRules{
+			RuleName:              "Temporary Access " + day.Format("2006-01-02"),
+			UserData:              userData,
+			ConnectionInformation: ci,
+		})
+		lastDay = day
+	}
+
+	return types.Policy{
+		PolicyName:      fmt.Sprintf("Temporary access %s %s", identity.Name, start.Format("20060102T150405Z")),
+		Status:          types.PolicyStatusEnabled,
+		Description:     fmt.Sprintf("%s expires=%s", TemporaryAccessTag, expires.Format(time.RFC3339)),
+		ProvidersData:   scope,
+		StartDate:       start.Format("2006-01-02"),
+		EndDate:         lastDay.Format("2006-01-02"),
+		UserAccessRules: rules,
+	}
+}
+
+// Returns the expiry of a temporary grant from a policy description
+func parseTemporaryAccess(description string) (time.Time, bool) {
+	rest, ok := strings.CutPrefix(description, TemporaryAccessTag+" expires=")
+	if !ok {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	expires, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expires, true
+}
@@ -0,0 +1,220 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestGrantTemporaryAccess(t *testing.T) {
+	defer func() { grantClock = time.Now }()
+
+	scope := types.ProvidersData{Aws: &types.Aws{AccountIds: []string{"123456789012"}}}
+	connectAs := types.ConnectAs{Aws: &types.ConnectAsAws{SSH: "ec2-user"}}
+
+	var tests = []struct {
+		name      string
+		now       time.Time
+		identity  Principal
+		scope     types.ProvidersData
+		duration  time.Duration
+		header    http.ConnState
+		response  string
+		wantDates string
+		wantRules []string
+		wantDpa   bool
+		wantErr   bool
+	}{
+		{
+			name:      "Valid Grant Across Midnight",
+			now:       time.Date(2024, 3, 5, 22, 30, 15, 0, time.UTC),
+			identity:  Principal{Kind: PrincipalUser, Name: "alice@example.com", Source: "IDENTITY"},
+			scope:     scope,
+			duration:  4 * time.Hour,
+			header:    http.StatusCreated,
+			response:  `{"policyId":"c12f982a-ab1a-12ab-1a31-f221aa31836a"}`,
+			wantDates: "2024-03-05 to 2024-03-06",
+			wantRules: []string{"Tue 22:30-00:00", "Wed 00:00-02:30"},
+		},
+		{
+			name:      "Valid Grant Within A Day",
+			now:       time.Date(2024, 3, 5, 0, 30, 0, 0, time.UTC),
+			identity:  Principal{Kind: PrincipalUser, Name: "alice@example.com", Source: "IDENTITY"},
+			scope:     scope,
+			duration:  time.Hour,
+			header:    http.StatusCreated,
+			response:  `{"policyId":"c12f982a-ab1a-12ab-1a31-f221aa31836a"}`,
+			wantDates: "2024-03-05 to 2024-03-05",
+			wantRules: []string{"Tue 00:30-01:30"},
+		},
+		{
+			name:      "Valid Grant Over Days",
+			now:       time.Date(2024, 3, 5, 22, 30, 0, 0, time.UTC),
+			identity:  Principal{Kind: PrincipalUser, Name: "alice@example.com", Source: "IDENTITY"},
+			scope:     scope,
+			duration:  49*time.Hour + 30*time.Minute,
+			header:    http.StatusCreated,
+			response:  `{"policyId":"c12f982a-ab1a-12ab-1a31-f221aa31836a"}`,
+			wantDates: "2024-03-05 to 2024-03-07",
+			wantRules: []string{"Tue 22:30-00:00", "Wed full", "Thu full"},
+		},
+		{
+			name:     "Invalid Status Bad Request",
+			identity: Principal{Kind: PrincipalGroup, Name: "Operators"},
+			scope:    scope,
+			duration: time.Hour,
+			header:   http.StatusBadRequest,
+			response: `{"code":"DPA_INVALID_VALUE","message":"Invalid policy"}`,
+			wantDpa:  true,
+		},
+		{
+			name:     "Invalid Duration",
+			identity: Principal{Kind: PrincipalUser, Name: "alice@example.com"},
+			scope:    scope,
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid Duration Too Long",
+			identity: Principal{Kind: PrincipalUser, Name: "alice@example.com"},
+			scope:    scope,
+			duration: 7 * 24 * time.Hour,
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid Empty Scope",
+			identity: Principal{Kind: PrincipalUser, Name: "alice@example.com"},
+			duration: time.Hour,
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid Identity",
+			identity: Principal{Kind: PrincipalUser},
+			scope:    scope,
+			duration: time.Hour,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grantClock = func() time.Time { return tt.now }
+			var sent types.Policy
+
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&sent)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(int(tt.header))
+				w.Write([]byte(tt.response))
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			got, dpaerr, err := ns.GrantTemporaryAccess(context.Background(), tt.identity, tt.scope, connectAs, tt.duration)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GrantTemporaryAccess() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GrantTemporaryAccess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantDpa {
+				if dpaerr.Empty() {
+					t.Errorf("GrantTemporaryAccess() expected error response")
+				}
+				return
+			}
+
+			expires := tt.now.Truncate(time.Minute).Add(tt.duration)
+			if got.PolicyID != "c12f982a-ab1a-12ab-1a31-f221aa31836a" || !got.Expires.Equal(expires) {
+				t.Errorf("GrantTemporaryAccess() = %+v", got)
+			}
+			if dates := sent.StartDate + " to " + sent.EndDate; dates != tt.wantDates {
+				t.Errorf("GrantTemporaryAccess() dates = %s, want %s", dates, tt.wantDates)
+			}
+			if sent.Description != TemporaryAccessTag+" expires="+expires.Format(time.RFC3339) {
+				t.Errorf("GrantTemporaryAccess() description = %s", sent.Description)
+			}
+
+			// Each rule allows one day of the week, within the grant hours
+			var rules []string
+			var windows []AccessWindow
+			for _, rule := range sent.UserAccessRules {
+				ci := rule.ConnectionInformation
+				if len(rule.UserData.Users) != 1 || ci.TimeZone != "UTC" || len(ci.DaysOfWeek) != 1 || ci.GrantAccess != min(int(math.Ceil(tt.duration.Hours())), 24) {
+					t.Errorf("GrantTemporaryAccess() rule = %+v", rule)
+				}
+				if ci.FullDays {
+					rules = append(rules, string(ci.DaysOfWeek[0])+" full")
+				} else {
+					rules = append(rules, fmt.Sprintf("%s %s-%s", ci.DaysOfWeek[0], ci.HoursFrom, ci.HoursTo))
+				}
+				w, err := ExpandAccessWindows(sent, rule, tt.now.AddDate(0, 0, -1), expires.AddDate(0, 0, 8))
+				if err != nil {
+					t.Fatalf("ExpandAccessWindows() error = %v", err)
+				}
+				windows = append(windows, w...)
+			}
+			if !slices.Equal(rules, tt.wantRules) {
+				t.Errorf("GrantTemporaryAccess() rules = %v, want %v", rules, tt.wantRules)
+			}
+			if n := len(windows); n == 0 || !windows[0].Start.Equal(tt.now.Truncate(time.Minute)) || !windows[n-1].End.Equal(expires) {
+				t.Fatalf("GrantTemporaryAccess() windows = %+v", windows)
+			}
+			for i := 1; i < len(windows); i++ {
+				if !windows[i].Start.Equal(windows[i-1].End) {
+					t.Errorf("GrantTemporaryAccess() windows are not contiguous = %+v", windows)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepTemporaryAccess(t *testing.T) {
+	var deleted []string
+
+	// Mock Response
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, path.Base(r.URL.Path))
+			return
+		}
+		w.Write([]byte(`{
+			"items": [
+				{"policyId": "id-1", "policyName": "Expired", "description": "dpa-temporary-access expires=2024-03-05T12:00:00Z"},
+				{"policyId": "id-2", "policyName": "Active", "description": "dpa-temporary-access expires=2024-03-06T12:00:00Z"},
+				{"policyId": "id-3", "policyName": "Standing", "description": "Production access"},
+				{"policyId": "id-4", "policyName": "Malformed", "description": "dpa-temporary-access expires=soon"}
+			],
+			"totalCount": 4
+		}`))
+	}))
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	got, dpaerr, err := ns.SweepTemporaryAccess(context.Background(), time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC))
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("SweepTemporaryAccess() error = %v, %v", err, dpaerr)
+	}
+	if len(got) != 1 || got[0].PolicyID != "id-1" || strings.Join(deleted, ",") != "id-1" {
+		t.Errorf("SweepTemporaryAccess() = %+v, deleted %v", got, deleted)
+	}
+}
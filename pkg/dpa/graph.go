@@ -0,0 +1,366 @@
+package dpa
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// GraphNodeKind is the kind of an access graph node
+type GraphNodeKind string
+
+const (
+	GraphIdentity GraphNodeKind = "identity"
+	GraphRule     GraphNodeKind = "rule"
+	GraphScope    GraphNodeKind = "scope"
+)
+
+// GraphNode is an identity, a policy rule or a provider scope. Details
+// holds the lines shown below the label, the schedule of a rule or the
+// targets of a scope. Identical identities and scopes share a node.
+type GraphNode struct {
+	ID      string        `json:"id"`
+	Kind    GraphNodeKind `json:"kind"`
+	Label   string        `json:"label"`
+	Details []string      `json:"details,omitempty"`
+}
+
+// GraphEdge connects an identity to a rule, or a rule to a scope. Edges to
+// scopes are labelled with the connect as users of the provider.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+// AccessGraph shows which identities reach which provider scopes through
+// policy rules
+type AccessGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphOptions filters the access graph. Identities keeps the rules
+// assigned to any of the principals, a principal without a Kind matches
+// every kind. Providers keeps the scopes of the providers listed. Empty
+// filters keep everything.
+type GraphOptions struct {
+	Identities []Principal      `json:"identities,omitempty"`
+	Providers  []types.Provider `json:"providers,omitempty"`
+}
+
+// BuildAccessGraph returns the access graph of the policies. Rules left
+// without an identity or a scope by the filters are omitted.
+//
+// Example:
+//
+//	g := dpa.BuildAccessGraph(policies, dpa.GraphOptions{
+//		Identities: []dpa.Principal{{Kind: dpa.PrincipalRole, Name: "DevOps"}},
+//		Providers:  []types.Provider{types.ProviderAWS},
+//	})
+//	if err := dpa.WriteGraphDOT(os.Stdout, g); err != nil {
+//		log.Fatalf("Failed to write graph. %s", err)
+//		return
+//	}
+func BuildAccessGraph(policies []types.Policy, opts GraphOptions) *AccessGraph {
+	g := &AccessGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	nodes := map[string]bool{}
+	addNode := func(n GraphNode) {
+		if !nodes[n.ID] {
+			nodes[n.ID] = true
+			g.Nodes = append(g.Nodes, n)
+		}
+	}
+
+	for _, p := range policies {
+		policyKey := p.PolicyID
+		if len(policyKey) == 0 {
+			policyKey = p.PolicyName
+		}
+
+		var scopes []GraphNode
+		for _, provider := range graphProviders(p.ProvidersData) {
+			if len(opts.Providers) != 0 && !slices.Contains(opts.Providers, provider) {
+				continue
+			}
+			details := scopeDetails(policyScope(p, provider))
+			scopes = append(scopes, GraphNode{
+				ID:      fmt.Sprintf("scope:%s:%s", provider, strings.Join(details, ";")),
+				Kind:    GraphScope,
+				Label:   string(provider),
+				Details: details,
+			})
+		}
+		if len(scopes) == 0 {
+			continue
+		}
+
+		for i, r := range p.UserAccessRules {
+			identities := graphIdentities(r.UserData, opts.Identities)
+			if len(identities) == 0 {
+				continue
+			}
+
+			ci := r.ConnectionInformation
+			details := []string{describeSchedule(ci)}
+			if ci.GrantAccess != 0 {
+				details = append(details, fmt.Sprintf("grant %dh", ci.GrantAccess))
+			}
+			if p.Status != types.PolicyStatusEnabled && len(p.Status) != 0 {
+				details = append(details, strings.ToLower(string(p.Status)))
+			}
+			rule := GraphNode{
+				ID:      fmt.Sprintf("rule:%s:%d", policyKey, i),
+				Kind:    GraphRule,
+				Label:   fmt.Sprintf("%s / %s", p.PolicyName, r.RuleName),
+				Details: details,
+			}
+			for _, id := range identities {
+				addNode(id)
+				g.Edges = append(g.Edges, GraphEdge{From: id.ID, To: rule.ID})
+			}
+			addNode(rule)
+			for _, s := range scopes {
+				addNode(s)
+				g.Edges = append(g.Edges, GraphEdge{
+					From:  rule.ID,
+					To:    s.ID,
+					Label: strings.Join(connectAsUsers(ci.ConnectAs, types.Provider(s.Label)), ", "),
+				})
+			}
+		}
+	}
+	return g
+}
+
+// WriteGraphDOT writes the access graph in the Graphviz DOT language.
+// Identities are ellipses, rules boxes and scopes folders.
+//
+// Example:
+//
+//	if err := dpa.WriteGraphDOT(f, g); err != nil {
+//		log.Fatalf("Failed to write graph. %s", err)
+//		return
+//	}
+func WriteGraphDOT(w io.Writer, g *AccessGraph) error {
+	shapes := map[GraphNodeKind]string{GraphIdentity: "ellipse", GraphRule: "box", GraphScope: "folder"}
+	ids := graphNodeIDs(g)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph access {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	for _, n := range g.Nodes {
+		label := strings.Join(append([]string{n.Label}, n.Details...), "\n")
+		fmt.Fprintf(bw, "\t%s [label=%s, shape=%s];\n", ids[n.ID], dotQuote(label), shapes[n.Kind])
+	}
+	for _, e := range g.Edges {
+		if len(e.Label) == 0 {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", ids[e.From], ids[e.To])
+			continue
+		}
+		fmt.Fprintf(bw, "\t%s -> %s [label=%s];\n", ids[e.From], ids[e.To], dotQuote(e.Label))
+	}
+	fmt.Fprintln(bw, "}")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writeGraphDOT: Failed to write graph. %s", err)
+	}
+	return nil
+}
+
+// WriteGraphMermaid writes the access graph as a Mermaid flowchart.
+// Identities are stadiums, rules rectangles and scopes hexagons.
+//
+// Example:
+//
+//	if err := dpa.WriteGraphMermaid(f, g); err != nil {
+//		log.Fatalf("Failed to write graph. %s", err)
+//		return
+//	}
+func WriteGraphMermaid(w io.Writer, g *AccessGraph) error {
+	shapes := map[GraphNodeKind][2]string{GraphIdentity: {"([", "])"}, GraphRule: {"[", "]"}, GraphScope: {"{{", "}}"}}
+	ids := graphNodeIDs(g)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "flowchart LR")
+	for _, n := range g.Nodes {
+		label := strings.Join(append([]string{n.Label}, n.Details...), "<br/>")
+		shape := shapes[n.Kind]
+		fmt.Fprintf(bw, "\t%s%s%s%s\n", ids[n.ID], shape[0], mermaidQuote(label), shape[1])
+	}
+	for _, e := range g.Edges {
+		if len(e.Label) == 0 {
+			fmt.Fprintf(bw, "\t%s --> %s\n", ids[e.From], ids[e.To])
+			continue
+		}
+		fmt.Fprintf(bw, "\t%s -->|%s| %s\n", ids[e.From], mermaidQuote(e.Label), ids[e.To])
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writeGraphMermaid: Failed to write graph. %s", err)
+	}
+	return nil
+}
+
+// Returns the providers present in the policy in a stable order
+func graphProviders(pd types.ProvidersData) []types.Provider {
+	var providers []types.Provider
+	if pd.Aws != nil {
+		providers = append(providers, types.ProviderAWS)
+	}
+	if pd.Azure != nil {
+		providers = append(providers, types.ProviderAzure)
+	}
+	if pd.Gcp != nil {
+		providers = append(providers, types.ProviderGCP)
+	}
+	if pd.OnPrem != nil {
+		providers = append(providers, types.ProviderOnPrem)
+	}
+	return providers
+}
+
+// Returns the identity nodes of a rule which match the filter
+func graphIdentities(u types.UserData, filter []Principal) []GraphNode {
+	var nodes []GraphNode
+	add := func(kind PrincipalKind, name string) {
+		if len(filter) != 0 && !slices.ContainsFunc(filter, func(f Principal) bool {
+			return (len(f.Kind) == 0 || f.Kind == kind) && strings.EqualFold(f.Name, name)
+		}) {
+			return
+		}
+		nodes = append(nodes, GraphNode{
+			ID:    fmt.Sprintf("identity:%s:%s", kind, strings.ToLower(name)),
+			Kind:  GraphIdentity,
+			Label: fmt.Sprintf("%s: %s", kind, name),
+		})
+	}
+	for _, r := range u.Roles {
+		add(PrincipalRole, r.Name)
+	}
+	for _, g := range u.Groups {
+		add(PrincipalGroup, g.Name)
+	}
+	for _, user := range u.Users {
+		add(PrincipalUser, user.Name)
+	}
+	return nodes
+}
+
+// Describes the targets of a provider scope, one dimension per line
+func scopeDetails(s providerScope) []string {
+	var details []string
+	for _, dim := range sortedKeys(s.dims) {
+		if len(s.dims[dim]) != 0 {
+			details = append(details, fmt.Sprintf("%s: %s", dim, strings.Join(s.dims[dim], ", ")))
+		}
+	}
+	for _, key := range sortedKeys(s.tags) {
+		details = append(details, fmt.Sprintf("tag %s: %s", key, strings.Join(s.tags[key], ", ")))
+	}
+	for _, f := range s.fqdn {
+		operator, rest, _ := strings.Cut(f, "|")
+		pattern, domain, _ := strings.Cut(rest, "|")
+		details = append(details, describeFqdnRule(operator, pattern, domain))
+	}
+	if len(details) == 0 {
+		details = append(details, "all machines")
+	}
+	return details
+}
+
+// Describes an FQDN rule, e.g. "computer names starting with prod in
+// example.local"
+func describeFqdnRule(operator, pattern, domain string) string {
+	var d string
+	switch operator {
+	case "EXACTLY":
+		d = "computer name " + pattern
+	case "WILDCARD":
+		d = "computer names matching " + pattern
+	case "PREFIX":
+		d = "computer names starting with " + pattern
+	case "SUFFIX":
+		d = "computer names ending with " + pattern
+	case "CONTAINS":
+		d = "computer names containing " + pattern
+	default:
+		d = fmt.Sprintf("computer names %s %s", strings.ToLower(operator), pattern)
+	}
+	if len(domain) != 0 {
+		d += " in " + domain
+	}
+	return d
+}
+
+// Describes the connect as users of a provider
+func connectAsUsers(ca types.ConnectAs, provider types.Provider) []string {
+	var ssh string
+	var rdp *types.Rdp
+	switch provider {
+	case types.ProviderAWS:
+		ssh, rdp = deref(ca.Aws).SSH, deref(ca.Aws).Rdp
+	case types.ProviderAzure:
+		ssh, rdp = deref(ca.Azure).SSH, deref(ca.Azure).Rdp
+	case types.ProviderGCP:
+		ssh, rdp = deref(ca.Gcp).SSH, deref(ca.Gcp).Rdp
+	case types.ProviderOnPrem:
+		ssh, rdp = deref(ca.OnPrem).SSH, deref(ca.OnPrem).Rdp
+	}
+
+	var users []string
+	if len(ssh) != 0 {
+		users = append(users, "ssh "+ssh)
+	}
+	switch {
+	case rdp == nil:
+	case rdp.DomainEphemeralUser != nil:
+		groups := append(slices.Clone(rdp.DomainEphemeralUser.AssignGroups), rdp.DomainEphemeralUser.AssignDomainGroups...)
+		users = append(users, describeEphemeral("rdp domain ephemeral user", groups))
+	case len(rdp.User) != 0:
+		users = append(users, "rdp "+rdp.User)
+	default:
+		users = append(users, describeEphemeral("rdp ephemeral user", deref(rdp.LocalEphemeralUser).AssignGroups))
+	}
+	return users
+}
+
+func describeEphemeral(s string, groups []string) string {
+	if len(groups) == 0 {
+		return s
+	}
+	return fmt.Sprintf("%s (%s)", s, strings.Join(groups, ", "))
+}
+
+// Returns the keys of the map in sorted order so scope details are stable
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns short identifiers for the graph nodes, n0, n1 and so on
+func graphNodeIDs(g *AccessGraph) map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,115 @@
+package dpa
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestBuildAccessGraph(t *testing.T) {
+	var tests = []struct {
+		name      string
+		opts      GraphOptions
+		wantNodes int
+		wantEdges int
+	}{
+		{
+			name:      "All Policies",
+			wantNodes: 9,
+			wantEdges: 6,
+		},
+		{
+			name:      "Filter Provider",
+			opts:      GraphOptions{Providers: []types.Provider{types.ProviderOnPrem}},
+			wantNodes: 3,
+			wantEdges: 2,
+		},
+		{
+			name:      "Filter Identity Any Kind",
+			opts:      GraphOptions{Identities: []Principal{{Name: "operators"}}},
+			wantNodes: 3,
+			wantEdges: 2,
+		},
+		{
+			name:      "Filter Identity Wrong Kind",
+			opts:      GraphOptions{Identities: []Principal{{Kind: PrincipalRole, Name: "Operators"}}},
+			wantNodes: 0,
+			wantEdges: 0,
+		},
+		{
+			name: "Filter Identity And Provider",
+			opts: GraphOptions{
+				Identities: []Principal{{Kind: PrincipalUser, Name: "alice@example.com"}},
+				Providers:  []types.Provider{types.ProviderAWS},
+			},
+			wantNodes: 0,
+			wantEdges: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := BuildAccessGraph(simulatorPolicies, tt.opts)
+			if len(g.Nodes) != tt.wantNodes || len(g.Edges) != tt.wantEdges {
+				t.Errorf("BuildAccessGraph() = %d nodes %d edges, want %d nodes %d edges", len(g.Nodes), len(g.Edges), tt.wantNodes, tt.wantEdges)
+			}
+		})
+	}
+}
+
+func TestAccessGraphSharedNodes(t *testing.T) {
+	p := simulatorPolicies[0]
+	p.PolicyID, p.PolicyName = "copy", "AWS Copy"
+
+	// The same identity and scope in another policy share the nodes
+	g := BuildAccessGraph([]types.Policy{simulatorPolicies[0], p}, GraphOptions{})
+	if len(g.Nodes) != 4 || len(g.Edges) != 4 {
+		t.Errorf("BuildAccessGraph() = %+v", g)
+	}
+}
+
+func TestWriteGraph(t *testing.T) {
+	g := BuildAccessGraph(simulatorPolicies, GraphOptions{Providers: []types.Provider{types.ProviderAWS}})
+
+	var dot bytes.Buffer
+	if err := WriteGraphDOT(&dot, g); err != nil {
+		t.Fatalf("WriteGraphDOT() error = %v", err)
+	}
+	wantDOT := `digraph access {
+	rankdir=LR;
+	n0 [label="role: DevOps", shape=ellipse];
+	n1 [label="AWS Business Hours / DevOps SSH\nMon,Tue,Wed,Thu,Fri 08:00-18:00 America/New_York", shape=box];
+	n2 [label="AWS\naccount: 123456789012\nregion: us-east-1\ntag env: prod, dev", shape=folder];
+	n0 -> n1;
+	n1 -> n2 [label="ssh ec2-user"];
+}
+`
+	if dot.String() != wantDOT {
+		t.Errorf("WriteGraphDOT() =\n%s\nwant\n%s", dot.String(), wantDOT)
+	}
+
+	var mermaid bytes.Buffer
+	if err := WriteGraphMermaid(&mermaid, g); err != nil {
+		t.Fatalf("WriteGraphMermaid() error = %v", err)
+	}
+	wantMermaid := `flowchart LR
+	n0(["role: DevOps"])
+	n1["AWS Business Hours / DevOps SSH<br/>Mon,Tue,Wed,Thu,Fri 08:00-18:00 America/New_York"]
+	n2{{"AWS<br/>account: 123456789012<br/>region: us-east-1<br/>tag env: prod, dev"}}
+	n0 --> n1
+	n1 -->|"ssh ec2-user"| n2
+`
+	if mermaid.String() != wantMermaid {
+		t.Errorf("WriteGraphMermaid() =\n%s\nwant\n%s", mermaid.String(), wantMermaid)
+	}
+}
+
+func TestGraphQuote(t *testing.T) {
+	if got := dotQuote("a \"b\"\nc\\"); got != `"a \"b\"\nc\\"` {
+		t.Errorf("dotQuote() = %s", got)
+	}
+	if got := mermaidQuote(`say "hi"`); got != `"say #quot;hi#quot;"` {
+		t.Errorf("mermaidQuote() = %s", got)
+	}
+}
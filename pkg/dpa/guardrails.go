@@ -0,0 +1,382 @@
+package dpa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrGuardrailViolation is wrapped by the errors of policies rejected by a
+// guardrail
+var ErrGuardrailViolation = errors.New("policy violates a guardrail")
+
+// Guardrail is an organisational rule evaluated against every policy.
+// Expression is a CEL expression over the variable policy which returns
+// true when the policy is allowed. Fields are named as in the policy JSON
+// and every field is present, unset providers are null. For example:
+//
+//	policy.userAccessRules.all(r, r.connectionInformation.connectAs.AWS == null ||
+//	    r.connectionInformation.connectAs.AWS.ssh != "root")
+//
+// Message is returned when the expression is false.
+type Guardrail struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	Message    string `json:"message,omitempty"`
+}
+
+// GuardrailViolation is a policy which failed a guardrail. Source is the
+// file the policy was read from when checking files.
+type GuardrailViolation struct {
+	Guardrail  string `json:"guardrail"`
+	PolicyID   string `json:"policyId,omitempty"`
+	PolicyName string `json:"policyName,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Message    string `json:"message"`
+}
+
+func (v *GuardrailViolation) Error() string {
+	return fmt.Sprintf("policy %q violates guardrail %s: %s", v.PolicyName, v.Guardrail, v.Message)
+}
+
+func (v *GuardrailViolation) Is(target error) bool {
+	return target == ErrGuardrailViolation
+}
+
+// Guardrails is a set of compiled guardrails. It is safe for concurrent use.
+type Guardrails struct {
+	rules []guardrailProgram
+}
+
+type guardrailProgram struct {
+	Guardrail
+	program cel.Program
+}
+
+// NewGuardrails compiles the guardrails. Names must be unique and each
+// expression must return a bool.
+//
+// Example:
+//
+//	g, err := dpa.NewGuardrails(dpa.Guardrail{
+//		Name:       "max-grant-access",
+//		Expression: `policy.userAccessRules.all(r, r.connectionInformation.grantAccess <= 4) || policy.description.contains("break-glass")`,
+//		Message:    "GrantAccess may not exceed 4 hours unless the policy is tagged break-glass",
+//	})
+//	if err != nil {
+//		log.Fatalf("Failed to compile guardrails. %s", err)
+//		return
+//	}
+func NewGuardrails(guardrails ...Guardrail) (*Guardrails, error) {
+	env, err := cel.NewEnv(cel.Variable("policy", cel.DynType))
+	if err != nil {
+		return nil, fmt.Errorf("newGuardrails: Failed to create environment. %s", err)
+	}
+
+	g := &Guardrails{}
+	names := map[string]bool{}
+	for _, gr := range guardrails {
+		if len(strings.TrimSpace(gr.Name)) == 0 {
+			return nil, fmt.Errorf("newGuardrails: Guardrail name cannot be empty")
+		}
+		if names[gr.Name] {
+			return nil, fmt.Errorf("newGuardrails: Duplicate guardrail %s", gr.Name)
+		}
+		names[gr.Name] = true
+
+		ast, iss := env.Compile(gr.Expression)
+		if err := iss.Err(); err != nil {
+			return nil, fmt.Errorf("newGuardrails: Failed to compile guardrail %s. %s", gr.Name, err)
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return nil, fmt.Errorf("newGuardrails: Guardrail %s must return a bool, not %s", gr.Name, t)
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("newGuardrails: Failed to compile guardrail %s. %s", gr.Name, err)
+		}
+		if len(gr.Message) == 0 {
+			gr.Message = fmt.Sprintf("expression %s is false", gr.Expression)
+		}
+		g.rules = append(g.rules, guardrailProgram{Guardrail: gr, program: program})
+	}
+	return g, nil
+}
+
+// ReadGuardrails reads and compiles a guardrails document formatted as
+// YAML or JSON. Unknown fields are rejected.
+//
+//	guardrails:
+//	  - name: no-root-ssh
+//	    expression: policy.userAccessRules.all(r, r.connectionInformation.connectAs.AWS == null || r.connectionInformation.connectAs.AWS.ssh != "root")
+//	    message: Policies may not grant SSH as root
+//
+// Example:
+//
+//	g, err := dpa.ReadGuardrails(os.Stdin)
+//	if err != nil {
+//		log.Fatalf("Failed to read guardrails. %s", err)
+//		return
+//	}
+func ReadGuardrails(r io.Reader) (*Guardrails, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("readGuardrails: Failed to read guardrails. %s", err)
+	}
+
+	var doc struct {
+		Guardrails []Guardrail `json:"guardrails"`
+	}
+	if err := yaml.UnmarshalStrict(b, &doc); err != nil {
+		return nil, fmt.Errorf("readGuardrails: Failed to parse guardrails. %s", err)
+	}
+	return NewGuardrails(doc.Guardrails...)
+}
+
+// LoadGuardrailsFile reads and compiles guardrails from a YAML or JSON file.
+// See ReadGuardrails for the format.
+//
+// Example:
+//
+//	g, err := dpa.LoadGuardrailsFile("guardrails.yaml")
+//	if err != nil {
+//		log.Fatalf("Failed to load guardrails. %s", err)
+//		return
+//	}
+func LoadGuardrailsFile(name string) (*Guardrails, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadGuardrailsFile: Failed to open guardrails file. %s", err)
+	}
+	defer f.Close()
+
+	g, err := ReadGuardrails(f)
+	if err != nil {
+		return nil, fmt.Errorf("loadGuardrailsFile: %s: %s", name, err)
+	}
+	return g, nil
+}
+
+// Guardrails returns the guardrails of the set
+func (g *Guardrails) Guardrails() []Guardrail {
+	guardrails := make([]Guardrail, 0, len(g.rules))
+	for _, r := range g.rules {
+		guardrails = append(guardrails, r.Guardrail)
+	}
+	return guardrails
+}
+
+// Check evaluates every guardrail against the policy. The violations are
+// returned as *GuardrailViolation errors, joined with any evaluation
+// failures. The error wraps ErrGuardrailViolation when a guardrail failed.
+//
+// Example:
+//
+//	if err := g.Check(policy); err != nil {
+//		log.Fatalf("Policy rejected. %s", err)
+//		return
+//	}
+func (g *Guardrails) Check(p types.Policy) error {
+	violations, err := g.evaluate(p)
+	errs := make([]error, 0, len(violations)+1)
+	for i := range violations {
+		errs = append(errs, &violations[i])
+	}
+	return errors.Join(append(errs, err)...)
+}
+
+// CheckPolicies evaluates every guardrail against the policies and returns
+// the violations found. Evaluation failures are returned joined in the
+// error, the remaining guardrails are still evaluated.
+//
+// Example:
+//
+//	violations, err := g.CheckPolicies(policies)
+//	if err != nil {
+//		log.Fatalf("Failed to check policies. %s", err)
+//		return
+//	}
+func (g *Guardrails) CheckPolicies(policies []types.Policy) ([]GuardrailViolation, error) {
+	var violations []GuardrailViolation
+	var errs []error
+	for _, p := range policies {
+		v, err := g.evaluate(p)
+		violations = append(violations, v...)
+		errs = append(errs, err)
+	}
+	return violations, errors.Join(errs...)
+}
+
+// CheckFiles evaluates every guardrail against the policies exported to
+// the files. Violations carry the file name in Source. An error is
+// returned when a file cannot be read, along with any evaluation failures.
+//
+// Example:
+//
+//	violations, err := g.CheckFiles("prod.json", "dev.json")
+//	if err != nil {
+//		log.Fatalf("Failed to check policy files. %s", err)
+//		return
+//	}
+//	for _, v := range violations {
+//		fmt.Printf("%s: %s\n", v.Source, v.Message)
+//	}
+func (g *Guardrails) CheckFiles(names ...string) ([]GuardrailViolation, error) {
+	var violations []GuardrailViolation
+	var errs []error
+	for _, name := range names {
+		policies, err := LoadPolicyFile(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v, err := g.CheckPolicies(policies)
+		for i := range v {
+			v[i].Source = name
+		}
+		violations = append(violations, v...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return violations, fmt.Errorf("checkFiles: %w", err)
+	}
+	return violations, nil
+}
+
+// SetGuardrails enables checking of the policies sent by AddPolicy and
+// UpdatePolicy, and the operations built on them. A policy which violates
+// a guardrail is rejected before the request is sent with an error wrapping
+// ErrGuardrailViolation. Passing nil disables the checks.
+//
+// Example:
+//
+//	g, err := dpa.LoadGuardrailsFile("guardrails.yaml")
+//	if err != nil {
+//		log.Fatalf("Failed to load guardrails. %s", err)
+//		return
+//	}
+//	s.SetGuardrails(g)
+func (s *Service) SetGuardrails(g *Guardrails) {
+	s.guardrails.Store(g)
+}
+
+// Checks a policy against the guardrails set on the Service
+func (s *Service) checkGuardrails(p interface{}) error {
+	g := s.guardrails.Load()
+	if g == nil {
+		return nil
+	}
+	policy, err := guardrailPolicy(p)
+	if err != nil {
+		return fmt.Errorf("Failed to read policy. %s", err)
+	}
+	return g.Check(policy)
+}
+
+// Returns the guardrails the policy violates
+func (g *Guardrails) evaluate(p types.Policy) ([]GuardrailViolation, error) {
+	input := map[string]interface{}{"policy": celValue(reflect.ValueOf(p))}
+
+	var violations []GuardrailViolation
+	var errs []error
+	for _, r := range g.rules {
+		out, _, err := r.program.Eval(input)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("guardrail %s on policy %q: %s", r.Name, p.PolicyName, err))
+			continue
+		}
+		allowed, ok := out.Value().(bool)
+		if !ok {
+			errs = append(errs, fmt.Errorf("guardrail %s on policy %q: Expected a bool result, got %s", r.Name, p.PolicyName, out.Type()))
+			continue
+		}
+		if !allowed {
+			violations = append(violations, GuardrailViolation{
+				Guardrail:  r.Name,
+				PolicyID:   p.PolicyID,
+				PolicyName: p.PolicyName,
+				Message:    r.Message,
+			})
+		}
+	}
+	return violations, errors.Join(errs...)
+}
+
+// Returns the CEL value of a policy field. Structs become maps keyed by
+// their JSON names with every field present, so expressions need no has()
+// checks, and nil pointers become null.
+func celValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return celValue(v.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if len(name) == 0 {
+				name = f.Name
+			}
+			m[name] = celValue(v.Field(i))
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		l := make([]interface{}, v.Len())
+		for i := range l {
+			l[i] = celValue(v.Index(i))
+		}
+		return l
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = celValue(iter.Value())
+		}
+		return m
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return nil
+}
+
+// Returns the policy sent to AddPolicy or UpdatePolicy as a types.Policy
+func guardrailPolicy(p interface{}) (types.Policy, error) {
+	switch p := p.(type) {
+	case types.Policy:
+		return p, nil
+	case *types.Policy:
+		return *p, nil
+	}
+
+	var policy types.Policy
+	b, err := json.Marshal(p)
+	if err != nil {
+		return policy, err
+	}
+	err = json.Unmarshal(b, &policy)
+	return policy, err
+}
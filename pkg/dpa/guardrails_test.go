@@ -0,0 +1,239 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+const sampleGuardrails = `
+guardrails:
+  - name: no-root-ssh
+    expression: >-
+      policy.userAccessRules.all(r,
+        [r.connectionInformation.connectAs.AWS, r.connectionInformation.connectAs.Azure,
+         r.connectionInformation.connectAs.GCP, r.connectionInformation.connectAs.OnPrem]
+        .all(ca, ca == null || ca.ssh != "root"))
+    message: Policies may not grant SSH as root
+  - name: prod-requires-role
+    expression: >-
+      policy.providersData.AWS == null ||
+      !policy.providersData.AWS.accountIds.exists(a, a == "111111111111") ||
+      policy.userAccessRules.all(r, size(r.userData.users) == 0 && size(r.userData.groups) == 0)
+    message: Production AWS accounts must be granted to roles
+  - name: max-grant-access
+    expression: >-
+      policy.userAccessRules.all(r, r.connectionInformation.grantAccess <= 4) ||
+      policy.description.contains("break-glass")
+    message: GrantAccess may not exceed 4 hours unless the policy is tagged break-glass
+`
+
+func TestGuardrailsCheck(t *testing.T) {
+	g, err := ReadGuardrails(strings.NewReader(sampleGuardrails))
+	if err != nil {
+		t.Fatalf("ReadGuardrails() error = %v", err)
+	}
+
+	var tests = []struct {
+		name string
+		edit func(*types.Policy)
+		want []string
+	}{
+		{
+			name: "Allowed",
+			edit: func(p *types.Policy) {},
+		},
+		{
+			name: "Root SSH",
+			edit: func(p *types.Policy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Gcp = &types.ConnectAsGcp{SSH: "root"}
+			},
+			want: []string{"no-root-ssh"},
+		},
+		{
+			name: "Production User",
+			edit: func(p *types.Policy) {
+				p.UserAccessRules[0].UserData.Users = []types.Users{{Name: "alice@example.com"}}
+			},
+			want: []string{"prod-requires-role"},
+		},
+		{
+			name: "Non Production User",
+			edit: func(p *types.Policy) {
+				p.ProvidersData.Aws.AccountIds = []string{"222222222222"}
+				p.UserAccessRules[0].UserData.Users = []types.Users{{Name: "alice@example.com"}}
+			},
+		},
+		{
+			name: "Long Grant",
+			edit: func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.GrantAccess = 8 },
+			want: []string{"max-grant-access"},
+		},
+		{
+			name: "Long Grant Break Glass",
+			edit: func(p *types.Policy) {
+				p.Description = "break-glass access for incidents"
+				p.UserAccessRules[0].ConnectionInformation.GrantAccess = 8
+			},
+		},
+		{
+			name: "Multiple Violations",
+			edit: func(p *types.Policy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Aws.SSH = "root"
+				p.UserAccessRules[0].ConnectionInformation.GrantAccess = 12
+			},
+			want: []string{"no-root-ssh", "max-grant-access"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validPolicy()
+			tt.edit(&p)
+
+			err := g.Check(p)
+			if (err != nil) != (len(tt.want) != 0) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.want)
+			}
+			if err != nil && !errors.Is(err, ErrGuardrailViolation) {
+				t.Errorf("Check() error = %v, want wrapping ErrGuardrailViolation", err)
+			}
+			for _, name := range tt.want {
+				if !strings.Contains(err.Error(), "violates guardrail "+name) {
+					t.Errorf("Check() error = %v, want guardrail %s", err, name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewGuardrails(t *testing.T) {
+	var tests = []struct {
+		name      string
+		guardrail Guardrail
+		wantErr   bool
+	}{
+		{
+			name:      "Valid",
+			guardrail: Guardrail{Name: "enabled", Expression: `policy.status == "Enabled"`},
+		},
+		{
+			name:      "Missing Name",
+			guardrail: Guardrail{Expression: "true"},
+			wantErr:   true,
+		},
+		{
+			name:      "Syntax Error",
+			guardrail: Guardrail{Name: "broken", Expression: "policy.status =="},
+			wantErr:   true,
+		},
+		{
+			name:      "Not A Bool",
+			guardrail: Guardrail{Name: "count", Expression: "size(policy.userAccessRules)"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGuardrails(tt.guardrail); (err != nil) != tt.wantErr {
+				t.Errorf("NewGuardrails() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewGuardrails(Guardrail{Name: "a", Expression: "true"}, Guardrail{Name: "a", Expression: "true"}); err == nil {
+		t.Errorf("NewGuardrails() expected error for duplicate names")
+	}
+	if _, err := ReadGuardrails(strings.NewReader("guardrails:\n  - name: a\n    expr: true\n")); err == nil {
+		t.Errorf("ReadGuardrails() expected error for unknown field")
+	}
+
+	// Runtime failures are reported as errors, not violations
+	g, _ := NewGuardrails(Guardrail{Name: "dyn", Expression: `policy.missing == "x"`})
+	if err := g.Check(validPolicy()); err == nil || errors.Is(err, ErrGuardrailViolation) {
+		t.Errorf("Check() error = %v, want evaluation failure", err)
+	}
+}
+
+func TestGuardrailsCheckFiles(t *testing.T) {
+	g, err := ReadGuardrails(strings.NewReader(sampleGuardrails))
+	if err != nil {
+		t.Fatalf("ReadGuardrails() error = %v", err)
+	}
+
+	allowed := validPolicy()
+	denied := validPolicy()
+	denied.PolicyID, denied.PolicyName = "id-2", "Root Access"
+	denied.UserAccessRules[0].ConnectionInformation.ConnectAs.Aws.SSH = "root"
+
+	dir := t.TempDir()
+	b, _ := json.Marshal([]types.Policy{allowed, denied})
+	prod := filepath.Join(dir, "prod.json")
+	os.WriteFile(prod, b, 0o600)
+
+	violations, err := g.CheckFiles(prod)
+	if err != nil {
+		t.Fatalf("CheckFiles() error = %v", err)
+	}
+	if len(violations) != 1 || violations[0].PolicyID != "id-2" || violations[0].Source != prod || violations[0].Guardrail != "no-root-ssh" {
+		t.Errorf("CheckFiles() = %+v", violations)
+	}
+
+	violations, err = g.CheckFiles(prod, filepath.Join(dir, "missing.json"))
+	if err == nil || len(violations) != 1 {
+		t.Errorf("CheckFiles() = %+v, error = %v, want error for missing file", violations, err)
+	}
+}
+
+func TestServiceGuardrails(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"policyId": "id-1"}`))
+	}))
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+	g, err := ReadGuardrails(strings.NewReader(sampleGuardrails))
+	if err != nil {
+		t.Fatalf("ReadGuardrails() error = %v", err)
+	}
+
+	denied := validPolicy()
+	denied.UserAccessRules[0].ConnectionInformation.GrantAccess = 8
+
+	// Guardrails are opt-in
+	if _, _, err := ns.AddPolicy(context.Background(), denied); err != nil || requests != 1 {
+		t.Fatalf("AddPolicy() error = %v, requests = %d", err, requests)
+	}
+
+	ns.SetGuardrails(g)
+	if _, _, err := ns.AddPolicy(context.Background(), denied); !errors.Is(err, ErrGuardrailViolation) {
+		t.Errorf("AddPolicy() error = %v, want wrapping ErrGuardrailViolation", err)
+	}
+	if _, _, err := ns.UpdatePolicy(context.Background(), &denied, denied.PolicyID); !errors.Is(err, ErrGuardrailViolation) {
+		t.Errorf("UpdatePolicy() error = %v, want wrapping ErrGuardrailViolation", err)
+	}
+	if requests != 1 {
+		t.Errorf("rejected policies sent %d requests", requests-1)
+	}
+	if _, _, err := ns.UpdatePolicy(context.Background(), validPolicy(), "id-1"); err != nil || requests != 2 {
+		t.Errorf("UpdatePolicy() error = %v, requests = %d", err, requests)
+	}
+
+	ns.SetGuardrails(nil)
+	if _, _, err := ns.AddPolicy(context.Background(), denied); err != nil || requests != 3 {
+		t.Errorf("AddPolicy() error = %v, requests = %d", err, requests)
+	}
+}
@@ -0,0 +1,413 @@
+package dpa
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Returns the time a version is observed, replaced in tests
+var historyClock = time.Now
+
+// HistoryStore keeps every observed version of each policy in a directory.
+// Versions are stored once under objects/ named by the SHA-256 of their
+// JSON, and policies/<policyId>.json lists the versions of a policy in the
+// order they were observed.
+type HistoryStore struct {
+	dir string
+}
+
+// PolicyVersion is a recorded version of a policy. Hash identifies the
+// stored policy and ObservedAt is when it was recorded. UpdatedOn is the
+// policy's last modification time reported by the API, if any.
+type PolicyVersion struct {
+	Hash       string    `json:"hash"`
+	PolicyID   string    `json:"policyId"`
+	PolicyName string    `json:"policyName"`
+	ObservedAt time.Time `json:"observedAt"`
+	UpdatedOn  string    `json:"updatedOn,omitempty"`
+}
+
+// RollbackResult describes a policy restored by RollbackPolicy. Recreated
+// is true when the policy no longer existed and was added again, in which
+// case PolicyID is the ID of the new policy.
+type RollbackResult struct {
+	PolicyID  string        `json:"policyId"`
+	Version   PolicyVersion `json:"version"`
+	Recreated bool          `json:"recreated"`
+}
+
+// OpenHistoryStore opens the history store in the directory, creating it
+// when it does not exist.
+//
+// Example:
+//
+//	h, err := dpa.OpenHistoryStore("policy-history")
+//	if err != nil {
+//		log.Fatalf("Failed to open history. %s", err)
+//		return
+//	}
+func OpenHistoryStore(dir string) (*HistoryStore, error) {
+	for _, d := range []string{filepath.Join(dir, "objects"), filepath.Join(dir, "policies")} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return nil, fmt.Errorf("openHistoryStore: Failed to create directory. %s", err)
+		}
+	}
+	return &HistoryStore{dir: dir}, nil
+}
+
+// Record stores a policy version. A version is only added to the policy's
+// history when it differs from the last recorded version, and the bool
+// reports whether it was added.
+//
+// Example:
+//
+//	version, added, err := h.Record(*policy)
+//	if err != nil {
+//		log.Fatalf("Failed to record policy. %s", err)
+//		return
+//	}
+func (h *HistoryStore) Record(p types.Policy) (PolicyVersion, bool, error) {
+	if err := validHistoryID(p.PolicyID); err != nil {
+		return PolicyVersion{}, false, fmt.Errorf("record: %s", err)
+	}
+
+	updatedOn := p.UpdatedOn
+	p.UpdatedOn = ""
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return PolicyVersion{}, false, fmt.Errorf("record: Failed to marshal policy. %s", err)
+	}
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+
+	versions, err := h.History(p.PolicyID)
+	if err != nil {
+		return PolicyVersion{}, false, fmt.Errorf("record: %s", err)
+	}
+	if n := len(versions); n != 0 && versions[n-1].Hash == hash {
+		return versions[n-1], false, nil
+	}
+
+	object := h.objectPath(hash)
+	if _, err := os.Stat(object); errors.Is(err, os.ErrNotExist) {
+		if err := writeFileAtomic(object, b); err != nil {
+			return PolicyVersion{}, false, fmt.Errorf("record: Failed to store policy. %s", err)
+		}
+	}
+
+	v := PolicyVersion{
+		Hash:       hash,
+		PolicyID:   p.PolicyID,
+		PolicyName: p.PolicyName,
+		ObservedAt: historyClock().UTC(),
+		UpdatedOn:  updatedOn,
+	}
+	index, err := json.MarshalIndent(append(versions, v), "", "  ")
+	if err != nil {
+		return PolicyVersion{}, false, fmt.Errorf("record: Failed to marshal history. %s", err)
+	}
+	if err := writeFileAtomic(h.indexPath(p.PolicyID), index); err != nil {
+		return PolicyVersion{}, false, fmt.Errorf("record: Failed to store history. %s", err)
+	}
+	return v, true, nil
+}
+
+// History returns the recorded versions of a policy, oldest first. A
+// policy without history returns an empty slice.
+func (h *HistoryStore) History(policyID string) ([]PolicyVersion, error) {
+	if err := validHistoryID(policyID); err != nil {
+		return nil, fmt.Errorf("history: %s", err)
+	}
+	b, err := os.ReadFile(h.indexPath(policyID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("history: Failed to read history. %s", err)
+	}
+	var versions []PolicyVersion
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return nil, fmt.Errorf("history: Failed to parse history of %s. %s", policyID, err)
+	}
+	return versions, nil
+}
+
+// Policies returns the IDs of every policy with recorded history, including
+// policies which have since been deleted.
+func (h *HistoryStore) Policies() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(h.dir, "policies"))
+	if err != nil {
+		return nil, fmt.Errorf("policies: Failed to read history. %s", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Load returns a stored policy version. The hash may be shortened to any
+// unique prefix of at least 7 characters.
+func (h *HistoryStore) Load(hash string) (types.Policy, error) {
+	full, err := h.resolveHash(hash)
+	if err != nil {
+		return types.Policy{}, fmt.Errorf("load: %s", err)
+	}
+	b, err := os.ReadFile(h.objectPath(full))
+	if err != nil {
+		return types.Policy{}, fmt.Errorf("load: Failed to read version. %s", err)
+	}
+	if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != full {
+		return types.Policy{}, fmt.Errorf("load: Version %s is corrupt", full)
+	}
+	var p types.Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return types.Policy{}, fmt.Errorf("load: Failed to parse version %s. %s", full, err)
+	}
+	return p, nil
+}
+
+// Diff returns the differences between two stored versions
+//
+// Example:
+//
+//	versions, _ := h.History(policyID)
+//	diffs, err := h.Diff(versions[0].Hash, versions[len(versions)-1].Hash)
+//	if err != nil {
+//		log.Fatalf("Failed to diff versions. %s", err)
+//		return
+//	}
+//	dpa.WriteDiffText(os.Stdout, diffs)
+func (h *HistoryStore) Diff(from, to string) ([]PolicyDifference, error) {
+	a, err := h.Load(from)
+	if err != nil {
+		return nil, fmt.Errorf("diff: %s", err)
+	}
+	b, err := h.Load(to)
+	if err != nil {
+		return nil, fmt.Errorf("diff: %s", err)
+	}
+	return DiffPolicies(a, b), nil
+}
+
+// SnapshotPolicy fetches a policy with GetPolicy and records it in the
+// history store.
+// Returns the recorded PolicyVersion or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	version, dpaerr, err := s.SnapshotPolicy(context.Background(), h, "c12f982a-ab1a-12ab-1a31-f221aa31836a")
+//	if err != nil {
+//		log.Fatalf("Failed to snapshot policy. %s", err)
+//		return
+//	}
+func (s *Service) SnapshotPolicy(ctx context.Context, h *HistoryStore, policyID string) (*PolicyVersion, *types.ErrorResponse, error) {
+	p, dpaerr, err := s.GetPolicy(ctx, policyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshotPolicy: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	if len(p.PolicyID) == 0 {
+		p.PolicyID = policyID
+	}
+	v, _, err := h.Record(*p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshotPolicy: %s", err)
+	}
+	return &v, dpaerr, nil
+}
+
+// SnapshotPolicies fetches every policy and records it in the history
+// store.
+// Returns the versions which were not recorded before or
+// types.ErrorResponse based on the response from the API.
+//
+// Example:
+//
+//	changed, dpaerr, err := s.SnapshotPolicies(context.Background(), h)
+//	if err != nil {
+//		log.Fatalf("Failed to snapshot policies. %s", err)
+//		return
+//	}
+func (s *Service) SnapshotPolicies(ctx context.Context, h *HistoryStore) ([]PolicyVersion, *types.ErrorResponse, error) {
+	policies, dpaerr, err := s.FetchPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshotPolicies: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	var changed []PolicyVersion
+	for _, p := range policies {
+		v, added, err := h.Record(p)
+		if err != nil {
+			return changed, nil, fmt.Errorf("snapshotPolicies: %s", err)
+		}
+		if added {
+			changed = append(changed, v)
+		}
+	}
+	return changed, dpaerr, nil
+}
+
+// RollbackPolicy restores a policy to a recorded version. When the policy
+// still exists it is replaced with UpdatePolicy, otherwise the version is
+// added again with AddPolicy. The restored policy is not recorded, take a
+// new snapshot to record it.
+// Returns a RollbackResult or types.ErrorResponse based on the response
+// from the API. An error is returned on request failure
+//
+// Example:
+//
+//	versions, _ := h.History(policyID)
+//	result, dpaerr, err := s.RollbackPolicy(context.Background(), h, policyID, versions[0].Hash)
+//	if err != nil {
+//		log.Fatalf("Failed to roll back policy. %s", err)
+//		return
+//	}
+func (s *Service) RollbackPolicy(ctx context.Context, h *HistoryStore, policyID, hash string) (*RollbackResult, *types.ErrorResponse, error) {
+	versions, err := h.History(policyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rollbackPolicy: %s", err)
+	}
+	full, err := h.resolveHash(hash)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rollbackPolicy: %s", err)
+	}
+	var version *PolicyVersion
+	for i := range versions {
+		if versions[i].Hash == full {
+			version = &versions[i]
+		}
+	}
+	if version == nil {
+		return nil, nil, fmt.Errorf("rollbackPolicy: Version %s is not in the history of policy %s", hash, policyID)
+	}
+	p, err := h.Load(full)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rollbackPolicy: %s", err)
+	}
+
+	list, dpaerr, err := s.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rollbackPolicy: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	exists := false
+	for _, item := range list.Items {
+		if item.PolicyID == policyID {
+			exists = true
+			break
+		}
+	}
+
+	result := &RollbackResult{PolicyID: policyID, Version: *version}
+	if exists {
+		p.PolicyID = policyID
+		_, dpaerr, err := s.UpdatePolicy(ctx, p, policyID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rollbackPolicy: %s", err)
+		}
+		if !dpaerr.Empty() {
+			return nil, dpaerr, nil
+		}
+		return result, dpaerr, nil
+	}
+
+	p.PolicyID = ""
+	added, dpaerr, err := s.AddPolicy(ctx, p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rollbackPolicy: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	result.PolicyID = added.PolicyID
+	result.Recreated = true
+	return result, dpaerr, nil
+}
+
+// Returns the full hash of a stored version from a unique prefix
+func (h *HistoryStore) resolveHash(hash string) (string, error) {
+	hash = strings.ToLower(hash)
+	if len(hash) < 7 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("Invalid version %q", hash)
+	}
+	if len(hash) == sha256.Size*2 {
+		return hash, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(h.dir, "objects"))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read history. %s", err)
+	}
+	var matches []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && strings.HasPrefix(name, hash) {
+			matches = append(matches, name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("Version %s does not exist", hash)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("Version %s is ambiguous", hash)
+}
+
+func (h *HistoryStore) objectPath(hash string) string {
+	return filepath.Join(h.dir, "objects", hash+".json")
+}
+
+func (h *HistoryStore) indexPath(policyID string) string {
+	return filepath.Join(h.dir, "policies", policyID+".json")
+}
+
+// Policy IDs are used as file names so must not contain paths
+func validHistoryID(policyID string) error {
+	if len(policyID) == 0 {
+		return fmt.Errorf("Policy ID cannot be empty")
+	}
+	if policyID != filepath.Base(policyID) || strings.ContainsAny(policyID, `/\`) || policyID == "." || policyID == ".." {
+		return fmt.Errorf("Invalid policy ID %q", policyID)
+	}
+	return nil
+}
+
+// Writes a file by renaming a temporary file so readers never see a
+// partial write
+func writeFileAtomic(name string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
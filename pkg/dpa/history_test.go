@@ -0,0 +1,223 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestHistoryStore(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	historyClock = func() time.Time { now = now.Add(time.Hour); return now }
+	defer func() { historyClock = time.Now }()
+
+	h, err := OpenHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenHistoryStore() error = %v", err)
+	}
+
+	v1 := types.Policy{PolicyID: "id-1", PolicyName: "Example Policy", Description: "First", UpdatedOn: "2024-03-05T10:00:00"}
+	v2 := v1
+	v2.Description = "Second"
+
+	for i, tt := range []struct {
+		policy    types.Policy
+		wantAdded bool
+	}{
+		{policy: v1, wantAdded: true},
+		{policy: v1, wantAdded: false},
+		{policy: v2, wantAdded: true},
+		{policy: v1, wantAdded: true},
+	} {
+		if _, added, err := h.Record(tt.policy); err != nil || added != tt.wantAdded {
+			t.Fatalf("Record() %d added = %v, error = %v", i, added, err)
+		}
+	}
+
+	versions, err := h.History("id-1")
+	if err != nil || len(versions) != 3 {
+		t.Fatalf("History() = %+v, error = %v", versions, err)
+	}
+	if versions[0].Hash != versions[2].Hash || versions[0].Hash == versions[1].Hash {
+		t.Errorf("History() hashes = %s, %s, %s", versions[0].Hash, versions[1].Hash, versions[2].Hash)
+	}
+	if !versions[1].ObservedAt.After(versions[0].ObservedAt) || versions[0].UpdatedOn != "2024-03-05T10:00:00" {
+		t.Errorf("History() = %+v", versions)
+	}
+
+	objects, _ := os.ReadDir(filepath.Join(h.dir, "objects"))
+	if len(objects) != 2 {
+		t.Errorf("Record() stored %d objects, want 2", len(objects))
+	}
+
+	diffs, err := h.Diff(versions[0].Hash[:7], versions[1].Hash)
+	if err != nil || len(diffs) != 1 || diffs[0].Path != "description" {
+		t.Errorf("Diff() = %+v, error = %v", diffs, err)
+	}
+
+	if ids, err := h.Policies(); err != nil || len(ids) != 1 || ids[0] != "id-1" {
+		t.Errorf("Policies() = %v, error = %v", ids, err)
+	}
+	if versions, err := h.History("id-2"); err != nil || len(versions) != 0 {
+		t.Errorf("History() unknown policy = %v, error = %v", versions, err)
+	}
+
+	var invalid = []struct {
+		name string
+		fn   func() error
+	}{
+		{
+			name: "Empty Policy ID",
+			fn:   func() error { _, _, err := h.Record(types.Policy{}); return err },
+		},
+		{
+			name: "Path Policy ID",
+			fn:   func() error { _, err := h.History("../id-1"); return err },
+		},
+		{
+			name: "Short Hash",
+			fn:   func() error { _, err := h.Load("abc"); return err },
+		},
+		{
+			name: "Unknown Hash",
+			fn:   func() error { _, err := h.Load("0000000"); return err },
+		},
+		{
+			name: "Corrupt Version",
+			fn: func() error {
+				os.WriteFile(h.objectPath(versions[1].Hash), []byte(`{}`), 0o600)
+				_, err := h.Load(versions[1].Hash)
+				return err
+			},
+		},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(); err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestRollbackPolicy(t *testing.T) {
+	h, _ := OpenHistoryStore(t.TempDir())
+	old := types.Policy{PolicyID: "id-1", PolicyName: "Example Policy", Description: "Known good"}
+	version, _, _ := h.Record(old)
+
+	var tests = []struct {
+		name          string
+		list          string
+		hash          string
+		wantMethod    string
+		wantRecreated bool
+		wantErr       bool
+	}{
+		{
+			name:       "Existing Policy",
+			list:       `{"items": [{"policyId": "id-1"}], "totalCount": 1}`,
+			hash:       version.Hash,
+			wantMethod: http.MethodPut,
+		},
+		{
+			name:          "Deleted Policy",
+			list:          `{"items": [], "totalCount": 0}`,
+			hash:          version.Hash[:12],
+			wantMethod:    http.MethodPost,
+			wantRecreated: true,
+		},
+		{
+			name:    "Unknown Version",
+			hash:    "0123456789abcdef",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method string
+			var sent types.Policy
+
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.Method {
+				case http.MethodGet:
+					w.Write([]byte(tt.list))
+				case http.MethodPost:
+					method = r.Method
+					json.NewDecoder(r.Body).Decode(&sent)
+					w.WriteHeader(http.StatusCreated)
+					w.Write([]byte(`{"policyId": "id-new"}`))
+				case http.MethodPut:
+					method = r.Method
+					json.NewDecoder(r.Body).Decode(&sent)
+					json.NewEncoder(w).Encode(sent)
+				}
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			got, dpaerr, err := ns.RollbackPolicy(context.Background(), h, "id-1", tt.hash)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("RollbackPolicy() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !dpaerr.Empty() {
+				t.Fatalf("RollbackPolicy() error = %v, %v", err, dpaerr)
+			}
+			if method != tt.wantMethod || got.Recreated != tt.wantRecreated || sent.Description != "Known good" {
+				t.Errorf("RollbackPolicy() = %+v, sent %s %+v", got, method, sent)
+			}
+			if tt.wantRecreated && (got.PolicyID != "id-new" || len(sent.PolicyID) != 0) {
+				t.Errorf("RollbackPolicy() = %+v, sent %+v", got, sent)
+			}
+		})
+	}
+}
+
+func TestSnapshotPolicies(t *testing.T) {
+	h, _ := OpenHistoryStore(t.TempDir())
+	description := "First"
+
+	// Mock Response
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if filepath.Base(r.URL.Path) == "access-policies" {
+			w.Write([]byte(`{"items": [{"policyId": "id-1"}, {"policyId": "id-2"}], "totalCount": 2}`))
+			return
+		}
+		json.NewEncoder(w).Encode(types.Policy{PolicyID: filepath.Base(r.URL.Path), Description: description})
+	}))
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	for _, want := range []int{2, 0} {
+		got, dpaerr, err := ns.SnapshotPolicies(context.Background(), h)
+		if err != nil || !dpaerr.Empty() || len(got) != want {
+			t.Fatalf("SnapshotPolicies() = %+v, error = %v, %v, want %d", got, err, dpaerr, want)
+		}
+	}
+
+	description = "Second"
+	got, dpaerr, err := ns.SnapshotPolicy(context.Background(), h, "id-2")
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("SnapshotPolicy() error = %v, %v", err, dpaerr)
+	}
+	if versions, _ := h.History("id-2"); len(versions) != 2 || versions[1].Hash != got.Hash {
+		t.Errorf("SnapshotPolicy() = %+v, history %+v", got, versions)
+	}
+}
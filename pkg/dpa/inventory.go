@@ -0,0 +1,211 @@
+package dpa
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Host is a machine from a local inventory. The embedded Target holds the
+// attributes evaluated against policy scopes.
+type Host struct {
+	Name string `json:"name,omitempty"`
+	Target
+}
+
+// PolicyCoverage lists the inventory hosts within the scope of a policy
+type PolicyCoverage struct {
+	PolicyID   string
+	PolicyName string
+	Status     types.PolicyStatus
+	Hosts      []Host
+	ByProvider map[types.Provider][]Host
+}
+
+// CoverageReport is the result of evaluating policy scopes against an inventory
+type CoverageReport struct {
+	Policies  []PolicyCoverage
+	Uncovered []Host
+}
+
+// LoadInventoryFile reads an inventory from a JSON or CSV file. The format
+// is selected using the file extension (.json or .csv).
+//
+// Returns a slice of Host or an error if the file could not be read.
+//
+// Example:
+//
+//	hosts, err := dpa.LoadInventoryFile("inventory.csv")
+//	if err != nil {
+//		log.Fatalf("Failed to load inventory. %s", err)
+//		return
+//	}
+func LoadInventoryFile(name string) ([]Host, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadInventoryFile: Failed to open inventory. %s", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return ReadInventoryJSON(f)
+	case ".csv":
+		return ReadInventoryCSV(f)
+	}
+	return nil, fmt.Errorf("loadInventoryFile: Unsupported inventory format %s. Valid options are .json, .csv", filepath.Ext(name))
+}
+
+// ReadInventoryJSON reads an inventory formatted as a JSON array of hosts
+//
+//	[
+//		{
+//			"name": "web01",
+//			"provider": "AWS",
+//			"account": "123456789012",
+//			"region": "us-east-1",
+//			"network": "vpc-0a1b2c3d",
+//			"tags": {"env": "prod"}
+//		},
+//		{"name": "db01", "provider": "OnPrem", "fqdn": "db01.example.local"}
+//	]
+func ReadInventoryJSON(r io.Reader) ([]Host, error) {
+	var hosts []Host
+	if err := json.NewDecoder(r).Decode(&hosts); err != nil {
+		return nil, fmt.Errorf("readInventoryJSON: Failed to parse inventory. %s", err)
+	}
+
+	for i, h := range hosts {
+		if err := validateTarget(h.Target); err != nil {
+			return nil, fmt.Errorf("readInventoryJSON: Invalid host %d. %s", i, err)
+		}
+	}
+	return hosts, nil
+}
+
+// ReadInventoryCSV reads an inventory formatted as CSV with a header row.
+// Valid columns are name, provider, account, region, network, resourceGroup,
+// fqdn and tags. Tags are written as semicolon separated key=value pairs.
+//
+//	name,provider,account,region,network,tags,fqdn
+//	web01,AWS,123456789012,us-east-1,vpc-0a1b2c3d,env=prod;team=web,
+//	db01,OnPrem,,,,,db01.example.local
+func ReadInventoryCSV(r io.Reader) ([]Host, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("readInventoryCSV: Failed to parse inventory. %s", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	for _, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "name", "provider", "account", "region", "network", "resourcegroup", "fqdn", "tags":
+		default:
+			return nil, fmt.Errorf("readInventoryCSV: Invalid column %s", col)
+		}
+	}
+
+	hosts := make([]Host, 0, len(records)-1)
+	for i, record := range records[1:] {
+		var h Host
+		for j, value := range record {
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(header[j])) {
+			case "name":
+				h.Name = value
+			case "provider":
+				h.Provider = types.Provider(value)
+			case "account":
+				h.Account = value
+			case "region":
+				h.Region = value
+			case "network":
+				h.Network = value
+			case "resourcegroup":
+				h.ResourceGroup = value
+			case "fqdn":
+				h.FQDN = value
+			case "tags":
+				tags, err := parseInventoryTags(value)
+				if err != nil {
+					return nil, fmt.Errorf("readInventoryCSV: Invalid host on line %d. %s", i+2, err)
+				}
+				h.Tags = tags
+			}
+		}
+
+		if err := validateTarget(h.Target); err != nil {
+			return nil, fmt.Errorf("readInventoryCSV: Invalid host on line %d. %s", i+2, err)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// Parses semicolon separated key=value pairs
+func parseInventoryTags(s string) (map[string]string, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	tags := map[string]string{}
+	for _, pair := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || len(strings.TrimSpace(k)) == 0 {
+			return nil, fmt.Errorf("Invalid tag %q. Expected key=value", pair)
+		}
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return tags, nil
+}
+
+// EvaluateCoverage determines which inventory hosts fall within the scope
+// (ProvidersData) of each policy. Status, identities and schedules are not
+// considered. Hosts within the scope of no policy are reported as uncovered.
+//
+// Returns a CoverageReport.
+//
+// Example:
+//
+//	report := dpa.EvaluateCoverage(policies, hosts)
+//	for _, h := range report.Uncovered {
+//		fmt.Printf("%s is not covered by any policy\n", h.Name)
+//	}
+func EvaluateCoverage(policies []types.Policy, hosts []Host) *CoverageReport {
+	report := &CoverageReport{}
+	covered := make([]bool, len(hosts))
+
+	for _, p := range policies {
+		pc := PolicyCoverage{
+			PolicyID:   p.PolicyID,
+			PolicyName: p.PolicyName,
+			Status:     p.Status,
+			ByProvider: map[types.Provider][]Host{},
+		}
+		for i, h := range hosts {
+			if len(scopeReasons(p, h.Target)) != 0 {
+				continue
+			}
+			covered[i] = true
+			pc.Hosts = append(pc.Hosts, h)
+			pc.ByProvider[h.Provider] = append(pc.ByProvider[h.Provider], h)
+		}
+		report.Policies = append(report.Policies, pc)
+	}
+
+	for i, h := range hosts {
+		if !covered[i] {
+			report.Uncovered = append(report.Uncovered, h)
+		}
+	}
+	return report
+}
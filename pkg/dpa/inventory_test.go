@@ -0,0 +1,130 @@
+package dpa
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestReadInventoryCSV(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "Valid Inventory",
+			input: `name,provider,account,region,network,tags,fqdn
+web01,AWS,123456789012,us-east-1,vpc-0a1b2c3d,env=prod;team=web,
+db-01,OnPrem,,,,,db-01.example.local`,
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name: "Invalid Column",
+			input: `name,cloud
+web01,AWS`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid Provider",
+			input: `name,provider
+web01,Oracle`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid Tags",
+			input: `name,provider,tags
+web01,AWS,env`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadInventoryCSV(strings.NewReader(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ReadInventoryCSV() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadInventoryCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ReadInventoryCSV() hosts = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadInventoryFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "inventory.json")
+	os.WriteFile(valid, []byte(`[{"name":"web01","provider":"AWS","region":"us-east-1","tags":{"env":"prod"}}]`), 0600)
+	invalid := filepath.Join(dir, "inventory.yaml")
+	os.WriteFile(invalid, []byte(`- name: web01`), 0600)
+
+	hosts, err := LoadInventoryFile(valid)
+	if err != nil {
+		t.Fatalf("LoadInventoryFile() error = %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Tags["env"] != "prod" {
+		t.Errorf("LoadInventoryFile() got %v", hosts)
+	}
+
+	if _, err := LoadInventoryFile(invalid); err == nil {
+		t.Errorf("LoadInventoryFile() expected error for unsupported format")
+	}
+}
+
+func TestEvaluateCoverage(t *testing.T) {
+	hosts, err := ReadInventoryCSV(strings.NewReader(`name,provider,account,region,tags,fqdn
+web01,AWS,123456789012,us-east-1,env=prod,
+web02,AWS,123456789012,us-west-2,env=prod,
+dev01,AWS,123456789012,us-east-1,env=qa,
+db-01,OnPrem,,,,db-01.example.local
+app01,OnPrem,,,,app01.example.local
+vm01,GCP,my-project,us-central1,,
+vm02,Azure,sub-1,eastus,,`))
+	if err != nil {
+		t.Fatalf("ReadInventoryCSV() error = %v", err)
+	}
+
+	report := EvaluateCoverage(simulatorPolicies, hosts)
+	if len(report.Policies) != len(simulatorPolicies) {
+		t.Fatalf("EvaluateCoverage() policies = %d, want %d", len(report.Policies), len(simulatorPolicies))
+	}
+
+	var want = map[string][]string{
+		"AWS Business Hours": {"web01"},
+		"OnPrem Night Shift": {"db-01"},
+		"Disabled GCP":       {"vm01"},
+	}
+	for _, pc := range report.Policies {
+		var names []string
+		for _, h := range pc.Hosts {
+			names = append(names, h.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(want[pc.PolicyName], ",") {
+			t.Errorf("EvaluateCoverage() %s hosts = %v, want %v", pc.PolicyName, names, want[pc.PolicyName])
+		}
+	}
+
+	var uncovered []string
+	for _, h := range report.Uncovered {
+		uncovered = append(uncovered, h.Name)
+	}
+	if strings.Join(uncovered, ",") != "web02,dev01,app01,vm02" {
+		t.Errorf("EvaluateCoverage() uncovered = %v", uncovered)
+	}
+
+	if got := report.Policies[0].ByProvider[types.ProviderAWS]; len(got) != 1 {
+		t.Errorf("EvaluateCoverage() AWS hosts = %d, want 1", len(got))
+	}
+}
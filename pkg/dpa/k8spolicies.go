@@ -0,0 +1,281 @@
+package dpa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Path of the Kubernetes access policies API
+const kubernetesPoliciesPath = "/access-policies/k8s"
+
+// ListKubernetesPolicies returns all of the configured Kubernetes policies.
+// Further pages are requested when TotalCount is larger than the items
+// returned.
+// Returns types.ListKubernetesPolicies or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	resp, dpaerr, err := s.ListKubernetesPolicies(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to list Kubernetes policies. %s", err)
+//		return
+//	}
+func (s *Service) ListKubernetesPolicies(ctx context.Context) (*types.ListKubernetesPolicies, *types.ErrorResponse, error) {
+	items, dpaerr, err := listAllPages(ctx, s, "listKubernetesPolicies", kubernetesPoliciesPath, nil, func(i types.KubernetesPolicyItem) string { return i.PolicyID })
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	return &types.ListKubernetesPolicies{Items: items, TotalCount: len(items)}, dpaerr, nil
+}
+
+// GetKubernetesPolicy returns the details of a Kubernetes policy
+// Returns types.KubernetesPolicy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	resp, dpaerr, err := s.GetKubernetesPolicy(context.Background(), "c12f982a-ab1a-12ab-1a31-f221aa31836b")
+//	if err != nil {
+//		log.Fatalf("Failed to get Kubernetes policy. %s", err)
+//		return
+//	}
+func (s *Service) GetKubernetesPolicy(ctx context.Context, i string) (*types.KubernetesPolicy, *types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	// Check if policy id is empty
+	if len(i) == 0 {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("getKubernetesPolicy: Policy id cannot be empty")
+	}
+
+	path := fmt.Sprintf("%s/%s", kubernetesPoliciesPath, i)
+	var policy types.KubernetesPolicy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Get(ctx, path, &policy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("getKubernetesPolicy: Failed to get Kubernetes policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &policy, &errorResponse, nil
+}
+
+// AddKubernetesPolicy creates a new Kubernetes policy
+// Returns types.AddPolicy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure.
+//
+// Example:
+//
+//	policy := types.KubernetesPolicy{
+//		PolicyName: "Payments Cluster Access",
+//		Status:     types.PolicyStatusEnabled,
+//		ProvidersData: types.KubernetesProvidersData{
+//			EKS: &types.KubernetesClusters{
+//				ClusterNames: []string{"payments-prod"},
+//				Namespaces:   []string{"payments"},
+//			},
+//		},
+//		UserAccessRules: []types.KubernetesAccessRule{
+//			{
+//				RuleName: "Payments Engineers",
+//				UserData: types.UserData{Roles: []types.Roles{{Name: "Payments Engineers"}}},
+//				ConnectionInformation: types.KubernetesConnectionInformation{
+//					ConnectAs: types.KubernetesConnectAs{
+//						Roles: []types.KubernetesRole{{Name: "edit", Namespace: "payments"}},
+//					},
+//					GrantAccess: 2,
+//					FullDays:    true,
+//					TimeZone:    "UTC",
+//				},
+//			},
+//		},
+//	}
+//
+//	resp, dpaerr, err := s.AddKubernetesPolicy(context.Background(), policy)
+//	if err != nil {
+//		log.Fatalf("Failed to add Kubernetes policy. %s", err)
+//		return
+//	}
+func (s *Service) AddKubernetesPolicy(ctx context.Context, p types.KubernetesPolicy) (*types.AddPolicy, *types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	var addPolicy types.AddPolicy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Post(ctx, kubernetesPoliciesPath, p, &addPolicy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("addKubernetesPolicy: Failed to add Kubernetes policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &addPolicy, &errorResponse, nil
+}
+
+// UpdateKubernetesPolicy replaces an existing Kubernetes policy using a PUT
+// request. The policy id in the request body must match the policy id in
+// the path, a mismatch is rejected before the request is sent.
+// Returns types.KubernetesPolicy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure, wrapping
+// ErrConflict when the policy was modified concurrently.
+//
+// Example:
+//
+//	policy.Status = types.PolicyStatusDisabled
+//	resp, dpaerr, err := s.UpdateKubernetesPolicy(context.Background(), policy, policy.PolicyID)
+//	if err != nil {
+//		log.Fatalf("Failed to update Kubernetes policy. %s", err)
+//		return
+//	}
+func (s *Service) UpdateKubernetesPolicy(ctx context.Context, p types.KubernetesPolicy, i string) (*types.KubernetesPolicy, *types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	if len(i) == 0 {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updateKubernetesPolicy: Policy id cannot be empty")
+	}
+	if p.PolicyID != i {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updateKubernetesPolicy: Policy id in the request body must match policy id %s", i)
+	}
+
+	path := fmt.Sprintf("%s/%s", kubernetesPoliciesPath, i)
+	var policy types.KubernetesPolicy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Put(ctx, path, p, &policy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updateKubernetesPolicy: Failed to update Kubernetes policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &policy, &errorResponse, nil
+}
+
+// DeleteKubernetesPolicy deletes a Kubernetes policy
+// Returns no response if succesfull or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure.
+//
+// Example:
+//
+//	dpaerr, err := s.DeleteKubernetesPolicy(context.Background(), "c12f982a-ab1a-12ab-1a31-f221aa31836a")
+//	if err != nil {
+//		log.Fatalf("Failed to delete Kubernetes policy. %s", err)
+//		return
+//	}
+func (s *Service) DeleteKubernetesPolicy(ctx context.Context, i string) (*types.ErrorResponse, error) {
+	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
+
+	if len(i) == 0 {
+		defer cancelCtx()
+		return nil, fmt.Errorf("deleteKubernetesPolicy: Policy id cannot be empty")
+	}
+
+	path := fmt.Sprintf("%s/%s", kubernetesPoliciesPath, i)
+	var deletePolicy string
+	var errorResponse types.ErrorResponse
+	if err := s.client.Delete(ctx, path, nil, &deletePolicy, &errorResponse); err != nil {
+		defer cancelCtx()
+		return nil, fmt.Errorf("deleteKubernetesPolicy: Failed to delete Kubernetes policy. %w", err)
+	}
+
+	defer cancelCtx()
+	return &errorResponse, nil
+}
+
+// ValidateKubernetesPolicy checks a Kubernetes policy is complete before
+// it is sent to the API. Besides the checks of ValidatePolicy, every
+// platform must select clusters by name or label, every rule needs a group
+// or role to connect as, and namespaces must be valid and covered by the
+// policy.
+// All problems found are returned joined in a single error.
+//
+// Example:
+//
+//	if err := dpa.ValidateKubernetesPolicy(policy); err != nil {
+//		log.Fatalf("Invalid Kubernetes policy. %s", err)
+//		return
+//	}
+func ValidateKubernetesPolicy(p types.KubernetesPolicy) error {
+	var errs validationErrors
+	errs.policy(p.PolicyName, p.Status, p.StartDate, p.EndDate)
+
+	// Namespaces the rules may use, nil when a platform allows every namespace
+	namespaces := []string{}
+	platforms := 0
+	v := reflect.ValueOf(p.ProvidersData)
+	for i := 0; i < v.NumField(); i++ {
+		c, ok := v.Field(i).Interface().(*types.KubernetesClusters)
+		if !ok || c == nil {
+			continue
+		}
+		platforms++
+		path := "providersData." + v.Type().Field(i).Name
+		if len(c.ClusterNames) == 0 && len(c.Labels) == 0 {
+			errs.add("%s must select clusters by clusterNames or labels", path)
+		}
+		for _, ns := range c.Namespaces {
+			errs.namespace(path+".namespaces", ns)
+		}
+		if len(c.Namespaces) == 0 {
+			namespaces = nil
+		} else if namespaces != nil {
+			namespaces = append(namespaces, c.Namespaces...)
+		}
+	}
+	if platforms == 0 {
+		errs.add("providersData must include at least one platform")
+	}
+
+	if len(p.UserAccessRules) == 0 {
+		errs.add("userAccessRules must include at least one rule")
+	}
+	names := map[string]bool{}
+	for i, r := range p.UserAccessRules {
+		path := fmt.Sprintf("userAccessRules[%d]", i)
+		errs.rule(path, r.RuleName, r.UserData, names)
+
+		ci := r.ConnectionInformation
+		ca := ci.ConnectAs
+		if len(ca.Groups) == 0 && len(ca.ClusterRoles) == 0 && len(ca.Roles) == 0 {
+			errs.add("%s.connectionInformation.connectAs must include groups, clusterRoles or roles", path)
+		}
+		for j, role := range ca.Roles {
+			rolePath := fmt.Sprintf("%s.connectionInformation.connectAs.roles[%d]", path, j)
+			if len(role.Name) == 0 {
+				errs.add("%s.name cannot be empty", rolePath)
+			}
+			// Roles are namespaced so the namespace is required
+			switch {
+			case len(role.Namespace) == 0:
+				errs.add("%s.namespace is required", rolePath)
+			default:
+				errs.namespace(rolePath+".namespace", role.Namespace)
+				if namespaces != nil && !slices.Contains(namespaces, role.Namespace) {
+					errs.add("%s.namespace %q is not in providersData", rolePath, role.Namespace)
+				}
+			}
+		}
+		errs.schedule(path+".connectionInformation", ci.GrantAccess, ci.TimeZone, ci.FullDays, ci.HoursFrom, ci.HoursTo)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Kubernetes namespace names are RFC 1123 labels
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Checks a Kubernetes namespace name is valid
+func (v *validationErrors) namespace(path, ns string) {
+	if len(ns) > 63 || !namespacePattern.MatchString(ns) {
+		v.add("%s %q is not a valid namespace", path, ns)
+	}
+}
@@ -0,0 +1,277 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func validKubernetesPolicy() types.KubernetesPolicy {
+	return types.KubernetesPolicy{
+		PolicyID:   "c12f982a-ab1a-12ab-1a31-f221aa31836a",
+		PolicyName: "Payments Cluster Access",
+		Status:     types.PolicyStatusEnabled,
+		ProvidersData: types.KubernetesProvidersData{
+			EKS: &types.KubernetesClusters{ClusterNames: []string{"payments-prod"}, Namespaces: []string{"payments"}},
+			SelfManaged: &types.KubernetesClusters{
+				Labels:     []types.Labels{{Key: "team", Value: []string{"payments"}}},
+				Namespaces: []string{"payments-batch"},
+			},
+		},
+		UserAccessRules: []types.KubernetesAccessRule{
+			{
+				RuleName: "Payments Engineers",
+				UserData: types.UserData{Roles: []types.Roles{{Name: "Payments Engineers"}}},
+				ConnectionInformation: types.KubernetesConnectionInformation{
+					ConnectAs: types.KubernetesConnectAs{
+						Groups: []string{"payments-developers"},
+						Roles:  []types.KubernetesRole{{Name: "edit", Namespace: "payments"}, {Name: "view", Namespace: "payments-batch"}},
+					},
+					GrantAccess: 2,
+					FullDays:    true,
+					TimeZone:    "UTC",
+				},
+			},
+		},
+	}
+}
+
+func TestKubernetesPolicies(t *testing.T) {
+	policy := validKubernetesPolicy()
+	policyJSON, _ := json.Marshal(policy)
+
+	var tests = []struct {
+		name       string
+		call       func(*Service) (interface{}, *types.ErrorResponse, error)
+		header     int
+		response   string
+		wantMethod string
+		wantPath   string
+		wantDpa    bool
+		wantErr    bool
+		wantIs     error
+	}{
+		{
+			name: "List Kubernetes Policies",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.ListKubernetesPolicies(context.Background())
+			},
+			header:     http.StatusOK,
+			response:   `{"items": [{"policyId": "id-1", "policyName": "Payments", "platforms": ["EKS", "SelfManaged"]}], "totalCount": 1}`,
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/access-policies/k8s",
+		},
+		{
+			name: "Get Kubernetes Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.GetKubernetesPolicy(context.Background(), policy.PolicyID)
+			},
+			header:     http.StatusOK,
+			response:   string(policyJSON),
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/access-policies/k8s/" + policy.PolicyID,
+		},
+		{
+			name: "Get Kubernetes Policy Not Found",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.GetKubernetesPolicy(context.Background(), policy.PolicyID)
+			},
+			header:     http.StatusNotFound,
+			response:   `{"code":"DPA_NOT_FOUND","message":"Policy not found"}`,
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/access-policies/k8s/" + policy.PolicyID,
+			wantDpa:    true,
+		},
+		{
+			name: "Add Kubernetes Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.AddKubernetesPolicy(context.Background(), policy)
+			},
+			header:     http.StatusCreated,
+			response:   `{"policyId": "id-new"}`,
+			wantMethod: http.MethodPost,
+			wantPath:   "/api/access-policies/k8s",
+		},
+		{
+			name: "Update Kubernetes Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.UpdateKubernetesPolicy(context.Background(), policy, policy.PolicyID)
+			},
+			header:     http.StatusOK,
+			response:   string(policyJSON),
+			wantMethod: http.MethodPut,
+			wantPath:   "/api/access-policies/k8s/" + policy.PolicyID,
+		},
+		{
+			name: "Update Kubernetes Policy Conflict",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.UpdateKubernetesPolicy(context.Background(), policy, policy.PolicyID)
+			},
+			header:     http.StatusConflict,
+			wantMethod: http.MethodPut,
+			wantErr:    true,
+			wantIs:     ErrConflict,
+		},
+		{
+			name: "Update Kubernetes Policy Mismatched ID",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				return s.UpdateKubernetesPolicy(context.Background(), policy, "another-id")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Delete Kubernetes Policy",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				dpaerr, err := s.DeleteKubernetesPolicy(context.Background(), policy.PolicyID)
+				return nil, dpaerr, err
+			},
+			header:     http.StatusOK,
+			wantMethod: http.MethodDelete,
+			wantPath:   "/api/access-policies/k8s/" + policy.PolicyID,
+		},
+		{
+			name: "Delete Kubernetes Policy Empty ID",
+			call: func(s *Service) (interface{}, *types.ErrorResponse, error) {
+				dpaerr, err := s.DeleteKubernetesPolicy(context.Background(), "")
+				return nil, dpaerr, err
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path string
+			var body []byte
+
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, path = r.Method, r.URL.Path
+				body, _ = io.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.header)
+				w.Write([]byte(tt.response))
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			_, dpaerr, err := tt.call(ns)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+					t.Errorf("error = %v, want wrapping %v", err, tt.wantIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if dpaerr.Empty() == tt.wantDpa {
+				t.Errorf("error response = %+v, wantDpa %v", dpaerr, tt.wantDpa)
+			}
+			if method != tt.wantMethod || path != tt.wantPath {
+				t.Errorf("request = %s %s, want %s %s", method, path, tt.wantMethod, tt.wantPath)
+			}
+			if method == http.MethodPost && !strings.Contains(string(body), `"EKS":{"clusterNames":["payments-prod"],"namespaces":["payments"]}`) {
+				t.Errorf("request body = %s", body)
+			}
+		})
+	}
+}
+
+func TestKubernetesPolicyEnumValidation(t *testing.T) {
+	var item types.KubernetesPolicyItem
+	if err := json.Unmarshal([]byte(`{"platforms": ["EKS", "OpenShift"]}`), &item); err == nil {
+		t.Errorf("Unmarshal() expected error for unknown Kubernetes platform")
+	}
+}
+
+func TestValidateKubernetesPolicy(t *testing.T) {
+	var tests = []struct {
+		name    string
+		edit    func(*types.KubernetesPolicy)
+		wantErr bool
+		wantMsg string
+	}{
+		{
+			name: "Valid Policy",
+			edit: func(p *types.KubernetesPolicy) {},
+		},
+		{
+			name: "All Namespaces",
+			edit: func(p *types.KubernetesPolicy) {
+				p.ProvidersData.GKE = &types.KubernetesClusters{ClusterNames: []string{"analytics"}}
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Roles[0].Namespace = "analytics"
+			},
+		},
+		{
+			name:    "Missing Platform",
+			edit:    func(p *types.KubernetesPolicy) { p.ProvidersData = types.KubernetesProvidersData{} },
+			wantErr: true,
+		},
+		{
+			name:    "Missing Cluster Selector",
+			edit:    func(p *types.KubernetesPolicy) { p.ProvidersData.AKS = &types.KubernetesClusters{} },
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Namespace",
+			edit:    func(p *types.KubernetesPolicy) { p.ProvidersData.EKS.Namespaces = []string{"Payments_Prod"} },
+			wantErr: true,
+		},
+		{
+			name: "Missing Connect As",
+			edit: func(p *types.KubernetesPolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs = types.KubernetesConnectAs{}
+			},
+			wantErr: true,
+		},
+		{
+			name: "Role Outside Policy Namespaces",
+			edit: func(p *types.KubernetesPolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Roles[0].Namespace = "kube-system"
+			},
+			wantErr: true,
+		},
+		{
+			name: "Role Without Namespace",
+			edit: func(p *types.KubernetesPolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Roles[0].Namespace = ""
+			},
+			wantErr: true,
+			wantMsg: "userAccessRules[0].connectionInformation.connectAs.roles[0].namespace is required",
+		},
+		{
+			name: "Role Without Name",
+			edit: func(p *types.KubernetesPolicy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Roles[0].Name = ""
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validKubernetesPolicy()
+			tt.edit(&p)
+			err := ValidateKubernetesPolicy(p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateKubernetesPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != tt.wantMsg && len(tt.wantMsg) != 0 {
+				t.Errorf("ValidateKubernetesPolicy() error = %v, want %s", err, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,508 @@
+package dpa
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Severity of a lint finding
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// LintFinding is a single problem reported by a lint rule.
+// Path is the JSON path of the offending field within the policy
+// (e.g. "userAccessRules[0].connectionInformation.grantAccess").
+type LintFinding struct {
+	RuleID     string   `json:"ruleId"`
+	Severity   Severity `json:"severity"`
+	PolicyID   string   `json:"policyId,omitempty"`
+	PolicyName string   `json:"policyName,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	Message    string   `json:"message"`
+}
+
+// LintRule is a check run against every policy. Check returns findings with
+// Path and Message populated, the linter fills in the remaining fields.
+type LintRule struct {
+	ID          string
+	Name        string
+	Description string
+	Severity    Severity
+	Check       func(p types.Policy, c LintConfig) []LintFinding
+}
+
+// LintConfig configures the linter. It may be decoded from a JSON
+// configuration file.
+//
+//	MaxGrantAccess - Maximum GrantAccess in hours (default 4)
+//	MaxIdleTime - Maximum IdleTime in minutes (default 60)
+//	MaxDisabledAge - Days a policy may remain disabled (default 90)
+//	Disabled - Rule IDs or names which are not run
+//	Severities - Severity overrides by rule ID or name
+//	Now - Time used for date based rules (default time.Now)
+type LintConfig struct {
+	MaxGrantAccess int                 `json:"maxGrantAccess,omitempty"`
+	MaxIdleTime    int                 `json:"maxIdleTime,omitempty"`
+	MaxDisabledAge int                 `json:"maxDisabledAge,omitempty"`
+	Disabled       []string            `json:"disabled,omitempty"`
+	Severities     map[string]Severity `json:"severities,omitempty"`
+	Now            time.Time           `json:"-"`
+}
+
+// Linter runs lint rules against policies
+type Linter struct {
+	config LintConfig
+	rules  []LintRule
+}
+
+// NewLinter returns a Linter with the built-in rules registered. Zero
+// values in the config are replaced with their defaults.
+//
+// Example:
+//
+//	l := dpa.NewLinter(dpa.LintConfig{MaxGrantAccess: 2, Disabled: []string{"DPA007"}})
+//	findings := l.Lint(policies)
+//	if err := dpa.WriteLintText(os.Stdout, findings); err != nil {
+//		log.Fatalf("Failed to write findings. %s", err)
+//		return
+//	}
+func NewLinter(config LintConfig) *Linter {
+	if config.MaxGrantAccess == 0 {
+		config.MaxGrantAccess = 4
+	}
+	if config.MaxIdleTime == 0 {
+		config.MaxIdleTime = 60
+	}
+	if config.MaxDisabledAge == 0 {
+		config.MaxDisabledAge = 90
+	}
+	return &Linter{
+		config: config,
+		rules:  slices.Clone(builtinLintRules),
+	}
+}
+
+// AddRule registers a custom lint rule
+func (l *Linter) AddRule(r LintRule) {
+	l.rules = append(l.rules, r)
+}
+
+// Rules returns the registered rules which are enabled by the config
+func (l *Linter) Rules() []LintRule {
+	var rules []LintRule
+	for _, r := range l.rules {
+		if slices.Contains(l.config.Disabled, r.ID) || slices.Contains(l.config.Disabled, r.Name) {
+			continue
+		}
+		if s, ok := l.config.Severities[r.ID]; ok {
+			r.Severity = s
+		} else if s, ok := l.config.Severities[r.Name]; ok {
+			r.Severity = s
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// Lint runs the enabled rules against the policies
+func (l *Linter) Lint(policies []types.Policy) []LintFinding {
+	return l.lint(policies, "")
+}
+
+// LintFiles loads exported policy files and runs the enabled rules against
+// them. The file name is recorded as the Source of each finding.
+func (l *Linter) LintFiles(names ...string) ([]LintFinding, error) {
+	var findings []LintFinding
+	for _, name := range names {
+		policies, err := LoadPolicyFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("lintFiles: %s", err)
+		}
+		findings = append(findings, l.lint(policies, name)...)
+	}
+	return findings, nil
+}
+
+func (l *Linter) lint(policies []types.Policy, source string) []LintFinding {
+	config := l.config
+	if config.Now.IsZero() {
+		config.Now = time.Now()
+	}
+
+	var findings []LintFinding
+	for _, p := range policies {
+		for _, r := range l.Rules() {
+			for _, f := range r.Check(p, config) {
+				f.RuleID = r.ID
+				f.Severity = r.Severity
+				f.PolicyID = p.PolicyID
+				f.PolicyName = p.PolicyName
+				f.Source = source
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings
+}
+
+var builtinLintRules = []LintRule{
+	{
+		ID:          "DPA001",
+		Name:        "broad-provider-scope",
+		Description: "Provider scope has no regions, tags, networks or accounts and matches every machine",
+		Severity:    SeverityWarning,
+		Check:       lintBroadScope,
+	},
+	{
+		ID:          "DPA002",
+		Name:        "grant-access-too-long",
+		Description: "GrantAccess exceeds the configured maximum",
+		Severity:    SeverityWarning,
+		Check:       lintGrantAccess,
+	},
+	{
+		ID:          "DPA003",
+		Name:        "idle-time-too-long",
+		Description: "IdleTime exceeds the configured maximum",
+		Severity:    SeverityWarning,
+		Check:       lintIdleTime,
+	},
+	{
+		ID:          "DPA004",
+		Name:        "weekend-full-day-access",
+		Description: "Rule grants full day access on weekends",
+		Severity:    SeverityInfo,
+		Check:       lintWeekendAccess,
+	},
+	{
+		ID:          "DPA005",
+		Name:        "missing-end-date",
+		Description: "Policy has no EndDate",
+		Severity:    SeverityWarning,
+		Check:       lintMissingEndDate,
+	},
+	{
+		ID:          "DPA006",
+		Name:        "expired-policy",
+		Description: "Policy EndDate is in the past",
+		Severity:    SeverityError,
+		Check:       lintExpired,
+	},
+	{
+		ID:          "DPA007",
+		Name:        "individual-user-assignment",
+		Description: "Rule is granted to individual users instead of roles",
+		Severity:    SeverityWarning,
+		Check:       lintUserAssignment,
+	},
+	{
+		ID:          "DPA008",
+		Name:        "stale-disabled-policy",
+		Description: "Policy has been disabled longer than the configured maximum",
+		Severity:    SeverityInfo,
+		Check:       lintStaleDisabled,
+	},
+}
+
+func lintBroadScope(p types.Policy, c LintConfig) []LintFinding {
+	pd := p.ProvidersData
+	aws, azure, gcp := deref(pd.Aws), deref(pd.Azure), deref(pd.Gcp)
+	var findings []LintFinding
+	broad := func(provider types.Provider, empty bool) {
+		if empty && providerConfigured(p, provider) {
+			findings = append(findings, LintFinding{
+				Path:    "providersData." + string(provider),
+				Message: fmt.Sprintf("%s scope has no regions, tags, networks or accounts and matches every machine", provider),
+			})
+		}
+	}
+
+	broad(types.ProviderAWS, len(aws.Regions) == 0 && len(aws.Tags) == 0 && len(aws.VpcIds) == 0 && len(aws.AccountIds) == 0)
+	broad(types.ProviderAzure, len(azure.Regions) == 0 && len(azure.Tags) == 0 && len(azure.VnetIds) == 0 &&
+		len(azure.Subscriptions) == 0 && len(azure.ResourceGroups) == 0)
+	broad(types.ProviderGCP, len(gcp.Regions) == 0 && len(gcp.Labels) == 0 && len(gcp.VpcIds) == 0 && len(gcp.Projects) == 0)
+	return findings
+}
+
+func lintGrantAccess(p types.Policy, c LintConfig) []LintFinding {
+	var findings []LintFinding
+	for i, r := range p.UserAccessRules {
+		if r.ConnectionInformation.GrantAccess > c.MaxGrantAccess {
+			findings = append(findings, LintFinding{
+				Path:    fmt.Sprintf("userAccessRules[%d].connectionInformation.grantAccess", i),
+				Message: fmt.Sprintf("rule %q grants access for %d hours, maximum is %d", r.RuleName, r.ConnectionInformation.GrantAccess, c.MaxGrantAccess),
+			})
+		}
+	}
+	return findings
+}
+
+func lintIdleTime(p types.Policy, c LintConfig) []LintFinding {
+	var findings []LintFinding
+	for i, r := range p.UserAccessRules {
+		if r.ConnectionInformation.IdleTime > c.MaxIdleTime {
+			findings = append(findings, LintFinding{
+				Path:    fmt.Sprintf("userAccessRules[%d].connectionInformation.idleTime", i),
+				Message: fmt.Sprintf("rule %q allows %d idle minutes, maximum is %d", r.RuleName, r.ConnectionInformation.IdleTime, c.MaxIdleTime),
+			})
+		}
+	}
+	return findings
+}
+
+func lintWeekendAccess(p types.Policy, c LintConfig) []LintFinding {
+	var findings []LintFinding
+	for i, r := range p.UserAccessRules {
+		ci := r.ConnectionInformation
+		// Rules without hours grant access all day
+		if !ci.FullDays && (len(ci.HoursFrom) != 0 || len(ci.HoursTo) != 0) {
+			continue
+		}
+		if dayAllowed(ci.DaysOfWeek, time.Saturday) || dayAllowed(ci.DaysOfWeek, time.Sunday) {
+			findings = append(findings, LintFinding{
+				Path:    fmt.Sprintf("userAccessRules[%d].connectionInformation.daysOfWeek", i),
+				Message: fmt.Sprintf("rule %q grants full day access on weekends", r.RuleName),
+			})
+		}
+	}
+	return findings
+}
+
+func lintMissingEndDate(p types.Policy, c LintConfig) []LintFinding {
+	if len(p.EndDate) != 0 {
+		return nil
+	}
+	return []LintFinding{{Path: "endDate", Message: "policy has no end date"}}
+}
+
+func lintExpired(p types.Policy, c LintConfig) []LintFinding {
+	if len(p.EndDate) == 0 {
+		return nil
+	}
+	end, err := parsePolicyDate(p.EndDate, time.UTC)
+	if err != nil {
+		return []LintFinding{{Path: "endDate", Message: err.Error()}}
+	}
+	if !c.Now.Before(end.AddDate(0, 0, 1)) {
+		return []LintFinding{{Path: "endDate", Message: fmt.Sprintf("policy expired on %s", p.EndDate)}}
+	}
+	return nil
+}
+
+func lintUserAssignment(p types.Policy, c LintConfig) []LintFinding {
+	var findings []LintFinding
+	for i, r := range p.UserAccessRules {
+		for j, u := range r.UserData.Users {
+			findings = append(findings, LintFinding{
+				Path:    fmt.Sprintf("userAccessRules[%d].userData.users[%d]", i, j),
+				Message: fmt.Sprintf("rule %q is granted to user %q instead of a role", r.RuleName, u.Name),
+			})
+		}
+	}
+	return findings
+}
+
+func lintStaleDisabled(p types.Policy, c LintConfig) []LintFinding {
+	if p.Status != types.PolicyStatusDisabled || len(p.UpdatedOn) == 0 {
+		return nil
+	}
+	updated, err := parseUpdatedOn(p.UpdatedOn)
+	if err != nil {
+		return []LintFinding{{Path: "updatedOn", Message: err.Error()}}
+	}
+	age := int(c.Now.Sub(updated).Hours() / 24)
+	if age > c.MaxDisabledAge {
+		return []LintFinding{{Path: "status", Message: fmt.Sprintf("policy has been disabled for %d days, maximum is %d", age, c.MaxDisabledAge)}}
+	}
+	return nil
+}
+
+// Parses the updatedOn timestamp returned by the API. Timestamps without a
+// time zone (e.g. "2023-11-20T14:16:42.161149") are treated as UTC.
+func parseUpdatedOn(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid updatedOn timestamp %q", s)
+}
+
+// WriteLintText writes findings as human readable lines
+//
+//	Example Policy (c12f982a-...) warning DPA002 userAccessRules[0].connectionInformation.grantAccess: rule "Dev" grants access for 8 hours, maximum is 4
+func WriteLintText(w io.Writer, findings []LintFinding) error {
+	for _, f := range findings {
+		name := f.PolicyName
+		if len(f.PolicyID) != 0 {
+			name = fmt.Sprintf("%s (%s)", name, f.PolicyID)
+		}
+		if len(f.Source) != 0 {
+			name = fmt.Sprintf("%s: %s", f.Source, name)
+		}
+		if _, err := fmt.Fprintf(w, "%s %s %s %s: %s\n", name, f.Severity, f.RuleID, f.Path, f.Message); err != nil {
+			return fmt.Errorf("writeLintText: Failed to write findings. %s", err)
+		}
+	}
+	return nil
+}
+
+// WriteLintJSON writes findings as a JSON array
+func WriteLintJSON(w io.Writer, findings []LintFinding) error {
+	if findings == nil {
+		findings = []LintFinding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(findings); err != nil {
+		return fmt.Errorf("writeLintJSON: Failed to write findings. %s", err)
+	}
+	return nil
+}
+
+// WriteLintSARIF writes findings as a SARIF 2.1.0 log for code review and
+// code scanning tools. The rules are included as the tool rule metadata.
+//
+// Example:
+//
+//	l := dpa.NewLinter(dpa.LintConfig{})
+//	findings, err := l.LintFiles("policies.json")
+//	if err != nil {
+//		log.Fatalf("Failed to lint policies. %s", err)
+//		return
+//	}
+//	dpa.WriteLintSARIF(os.Stdout, l.Rules(), findings)
+func WriteLintSARIF(w io.Writer, rules []LintRule, findings []LintFinding) error {
+	sr := make([]sarifRule, 0, len(rules))
+	for _, r := range rules {
+		sr = append(sr, sarifRule{
+			ID:                   r.ID,
+			Name:                 r.Name,
+			ShortDescription:     sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(r.Severity)},
+		})
+	}
+	sort.Slice(sr, func(i, j int) bool { return sr[i].ID < sr[j].ID })
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		var loc sarifLocation
+		if len(f.Source) != 0 {
+			loc.PhysicalLocation = &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: f.Source}}
+		}
+		policy := f.PolicyID
+		if len(policy) == 0 {
+			policy = f.PolicyName
+		}
+		loc.LogicalLocations = []sarifLogicalLocation{{
+			Name:               f.PolicyName,
+			FullyQualifiedName: strings.TrimSuffix(fmt.Sprintf("policies/%s/%s", policy, f.Path), "/"),
+			Kind:               "member",
+		}}
+
+		results = append(results, sarifResult{
+			RuleID:    f.RuleID,
+			Level:     sarifLevel(f.Severity),
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{loc},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "cybr-dpa",
+				Version:        Version,
+				InformationURI: "https://github.com/strick-j/cybr-dpa",
+				Rules:          sr,
+			}},
+			Results: results,
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(log); err != nil {
+		return fmt.Errorf("writeLintSARIF: Failed to write findings. %s", err)
+	}
+	return nil
+}
+
+// SARIF 2.1.0 log format
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name,omitempty"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+type sarifLogicalLocation struct {
+	Name               string `json:"name,omitempty"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind,omitempty"`
+}
+
+// Maps a severity to a SARIF result level
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "note"
+}
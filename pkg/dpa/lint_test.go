@@ -0,0 +1,198 @@
+package dpa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Sample policy which triggers every built-in lint rule
+var lintPolicy = types.Policy{
+	PolicyID:   "c12f982a-ab1a-12ab-1a31-f221aa31836a",
+	PolicyName: "Lint Policy",
+	Status:     "Disabled",
+	UpdatedOn:  "2023-11-20T14:16:42.161149",
+	ProvidersData: types.ProvidersData{
+		Aws: &types.Aws{
+			Regions:    []string{},
+			Tags:       []types.Tags{},
+			VpcIds:     []string{},
+			AccountIds: []string{},
+		},
+	},
+	UserAccessRules: []types.UserAccessRules{
+		{
+			RuleName: "Everything",
+			UserData: types.UserData{
+				Users: []types.Users{{Name: "alice@example.com"}},
+			},
+			ConnectionInformation: types.ConnectionInformation{
+				ConnectAs: types.ConnectAs{
+					Aws: &types.ConnectAsAws{SSH: "root"},
+				},
+				GrantAccess: 8,
+				IdleTime:    120,
+				DaysOfWeek:  []types.DayOfWeek{types.Saturday, types.Sunday},
+				FullDays:    true,
+				TimeZone:    "UTC",
+			},
+		},
+	},
+}
+
+func TestLint(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	expired := lintPolicy
+	expired.EndDate = "2024-01-01"
+
+	// Weekend rules without hours grant full day access, rules with hours
+	// do not
+	withoutHours := lintPolicy
+	withoutHours.UserAccessRules = []types.UserAccessRules{lintPolicy.UserAccessRules[0]}
+	withoutHours.UserAccessRules[0].ConnectionInformation.FullDays = false
+	withHours := withoutHours
+	withHours.UserAccessRules = []types.UserAccessRules{withoutHours.UserAccessRules[0]}
+	withHours.UserAccessRules[0].ConnectionInformation.HoursFrom = "08:00"
+	withHours.UserAccessRules[0].ConnectionInformation.HoursTo = "12:00"
+	weekendOnly := LintConfig{Now: now, Disabled: []string{"DPA001", "DPA002", "DPA003", "DPA005", "DPA007", "DPA008"}}
+
+	var tests = []struct {
+		name   string
+		config LintConfig
+		policy types.Policy
+		want   []string
+	}{
+		{
+			name:   "All Rules",
+			config: LintConfig{Now: now},
+			policy: lintPolicy,
+			want:   []string{"DPA001", "DPA002", "DPA003", "DPA004", "DPA005", "DPA007", "DPA008"},
+		},
+		{
+			name:   "Expired",
+			config: LintConfig{Now: now},
+			policy: expired,
+			want:   []string{"DPA001", "DPA002", "DPA003", "DPA004", "DPA006", "DPA007", "DPA008"},
+		},
+		{
+			name:   "Disabled Rules And Thresholds",
+			config: LintConfig{Now: now, MaxGrantAccess: 8, MaxIdleTime: 120, MaxDisabledAge: 365, Disabled: []string{"DPA001", "individual-user-assignment"}},
+			policy: lintPolicy,
+			want:   []string{"DPA004", "DPA005"},
+		},
+		{
+			name:   "Weekend Without Hours",
+			config: weekendOnly,
+			policy: withoutHours,
+			want:   []string{"DPA004"},
+		},
+		{
+			name:   "Weekend With Hours",
+			config: weekendOnly,
+			policy: withHours,
+			want:   nil,
+		},
+		{
+			name:   "Valid Policy",
+			config: LintConfig{Now: now},
+			policy: validSamplePolicy,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := NewLinter(tt.config).Lint([]types.Policy{tt.policy})
+
+			var got []string
+			for _, f := range findings {
+				got = append(got, f.RuleID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Lint() rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintCustomRuleAndSeverity(t *testing.T) {
+	l := NewLinter(LintConfig{
+		Disabled:   []string{"DPA001", "DPA002", "DPA003", "DPA004", "DPA005", "DPA006", "DPA007", "DPA008"},
+		Severities: map[string]Severity{"no-root": SeverityError},
+	})
+	l.AddRule(LintRule{
+		ID:       "ORG001",
+		Name:     "no-root",
+		Severity: SeverityWarning,
+		Check: func(p types.Policy, c LintConfig) []LintFinding {
+			var findings []LintFinding
+			for i, r := range p.UserAccessRules {
+				if aws := r.ConnectionInformation.ConnectAs.Aws; aws != nil && aws.SSH == "root" {
+					findings = append(findings, LintFinding{Path: fmt.Sprintf("userAccessRules[%d]", i), Message: "root"})
+				}
+			}
+			return findings
+		},
+	})
+
+	findings := l.Lint([]types.Policy{lintPolicy})
+	if len(findings) != 1 {
+		t.Fatalf("Lint() findings = %d, want 1", len(findings))
+	}
+	if findings[0].Severity != SeverityError || findings[0].PolicyName != "Lint Policy" {
+		t.Errorf("Lint() finding = %+v", findings[0])
+	}
+}
+
+func TestLintOutput(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "policies.json")
+	b, _ := json.Marshal([]types.Policy{lintPolicy})
+	os.WriteFile(name, b, 0600)
+
+	l := NewLinter(LintConfig{Now: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)})
+	findings, err := l.LintFiles(name)
+	if err != nil {
+		t.Fatalf("LintFiles() error = %v", err)
+	}
+
+	var text bytes.Buffer
+	if err := WriteLintText(&text, findings); err != nil {
+		t.Fatalf("WriteLintText() error = %v", err)
+	}
+	if !strings.Contains(text.String(), "warning DPA002 userAccessRules[0].connectionInformation.grantAccess") {
+		t.Errorf("WriteLintText() output = %s", text.String())
+	}
+
+	var js bytes.Buffer
+	if err := WriteLintJSON(&js, findings); err != nil {
+		t.Fatalf("WriteLintJSON() error = %v", err)
+	}
+	var decoded []LintFinding
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil || len(decoded) != len(findings) {
+		t.Errorf("WriteLintJSON() decoded %d findings, err %v", len(decoded), err)
+	}
+
+	var sarif bytes.Buffer
+	if err := WriteLintSARIF(&sarif, l.Rules(), findings); err != nil {
+		t.Fatalf("WriteLintSARIF() error = %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(sarif.Bytes(), &log); err != nil {
+		t.Fatalf("WriteLintSARIF() invalid json: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != 8 {
+		t.Fatalf("WriteLintSARIF() unexpected log %+v", log)
+	}
+	res := log.Runs[0].Results[0]
+	if res.Locations[0].PhysicalLocation.ArtifactLocation.URI != name || res.Level != "warning" {
+		t.Errorf("WriteLintSARIF() unexpected result %+v", res)
+	}
+}
@@ -0,0 +1,367 @@
+package dpa
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// OverlapKind classifies two rules whose identities and target scopes overlap
+type OverlapKind string
+
+const (
+	// OverlapDuplicate rules grant the same identities the same access
+	OverlapDuplicate OverlapKind = "duplicate"
+	// OverlapSuperset rules grant the same access but the first rule covers
+	// every identity and machine of the second
+	OverlapSuperset OverlapKind = "superset"
+	// OverlapConflict rules overlap but connect as different users, grant
+	// access for different durations or use different schedules
+	OverlapConflict OverlapKind = "conflict"
+)
+
+// RuleRef identifies a rule within a policy
+type RuleRef struct {
+	PolicyID   string `json:"policyId,omitempty"`
+	PolicyName string `json:"policyName,omitempty"`
+	RuleName   string `json:"ruleName,omitempty"`
+	Index      int    `json:"index"`
+}
+
+// RuleOverlap describes two rules which grant overlapping access on a provider.
+// For OverlapSuperset the First rule covers the Second.
+type RuleOverlap struct {
+	Kind        OverlapKind    `json:"kind"`
+	Provider    types.Provider `json:"provider"`
+	First       RuleRef        `json:"first"`
+	Second      RuleRef        `json:"second"`
+	Identities  []string       `json:"identities"`
+	Differences []string       `json:"differences,omitempty"`
+}
+
+// AnalyzeOverlaps compares every pair of rules across the provided policies
+// and reports those whose identities and target scopes overlap on the same
+// provider. Overlapping rules are classified as duplicates, supersets or
+// conflicts. Rules which partially overlap with identical access are not
+// reported. OnPrem scopes overlap when they share an identical FQDN rule.
+//
+// Example:
+//
+//	policies, _, err := s.FetchPolicies(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to fetch policies. %s", err)
+//		return
+//	}
+//	dpa.WriteOverlapReport(os.Stdout, dpa.AnalyzeOverlaps(policies))
+func AnalyzeOverlaps(policies []types.Policy) []RuleOverlap {
+	type ruleScope struct {
+		ref    RuleRef
+		policy types.Policy
+		rule   types.UserAccessRules
+	}
+
+	var rules []ruleScope
+	for _, p := range policies {
+		for i, r := range p.UserAccessRules {
+			rules = append(rules, ruleScope{
+				ref:    RuleRef{PolicyID: p.PolicyID, PolicyName: p.PolicyName, RuleName: r.RuleName, Index: i},
+				policy: p,
+				rule:   r,
+			})
+		}
+	}
+
+	var overlaps []RuleOverlap
+	for i := 0; i < len(rules); i++ {
+		for j := i + 1; j < len(rules); j++ {
+			a, b := rules[i], rules[j]
+
+			idA, idB := ruleIdentities(a.rule.UserData), ruleIdentities(b.rule.UserData)
+			shared := intersectFold(idA, idB)
+			if len(shared) == 0 {
+				continue
+			}
+			if !schedulesOverlap(a.rule.ConnectionInformation, b.rule.ConnectionInformation) {
+				continue
+			}
+
+			for _, provider := range types.Providers {
+				if !providerConfigured(a.policy, provider) || !providerConfigured(b.policy, provider) {
+					continue
+				}
+				sa, sb := policyScope(a.policy, provider), policyScope(b.policy, provider)
+				if !sa.overlaps(sb) {
+					continue
+				}
+
+				o := RuleOverlap{Provider: provider, First: a.ref, Second: b.ref, Identities: shared}
+				o.Differences = accessDifferences(a.rule.ConnectionInformation, b.rule.ConnectionInformation, provider)
+				switch {
+				case len(o.Differences) != 0:
+					o.Kind = OverlapConflict
+				case sa.equal(sb) && equalFold(idA, idB):
+					o.Kind = OverlapDuplicate
+				case sa.covers(sb) && subsetFold(idB, idA):
+					o.Kind = OverlapSuperset
+				case sb.covers(sa) && subsetFold(idA, idB):
+					o.Kind = OverlapSuperset
+					o.First, o.Second = b.ref, a.ref
+				default:
+					continue
+				}
+				overlaps = append(overlaps, o)
+			}
+		}
+	}
+	return overlaps
+}
+
+// WriteOverlapReport writes the overlaps as human readable text
+func WriteOverlapReport(w io.Writer, overlaps []RuleOverlap) error {
+	for _, o := range overlaps {
+		line := fmt.Sprintf("%s %s: %s and %s share %s", o.Kind, o.Provider, formatRuleRef(o.First), formatRuleRef(o.Second), strings.Join(o.Identities, ", "))
+		if o.Kind == OverlapSuperset {
+			line = fmt.Sprintf("%s %s: %s covers %s for %s", o.Kind, o.Provider, formatRuleRef(o.First), formatRuleRef(o.Second), strings.Join(o.Identities, ", "))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return fmt.Errorf("writeOverlapReport: Failed to write report. %s", err)
+		}
+		for _, d := range o.Differences {
+			if _, err := fmt.Fprintf(w, "\t%s\n", d); err != nil {
+				return fmt.Errorf("writeOverlapReport: Failed to write report. %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+func formatRuleRef(r RuleRef) string {
+	return fmt.Sprintf("%q rule %q", r.PolicyName, r.RuleName)
+}
+
+// Returns the identities of a rule prefixed with their type (e.g. "role:DevOps")
+func ruleIdentities(u types.UserData) []string {
+	var ids []string
+	for _, r := range u.Roles {
+		ids = append(ids, "role:"+r.Name)
+	}
+	for _, g := range u.Groups {
+		ids = append(ids, "group:"+g.Name)
+	}
+	for _, user := range u.Users {
+		ids = append(ids, "user:"+user.Name)
+	}
+	return ids
+}
+
+// Lists the differences in the access granted by two rules for a provider
+func accessDifferences(a, b types.ConnectionInformation, provider types.Provider) []string {
+	var diffs []string
+
+	var ca, cb types.ConnectAs
+	switch provider {
+	case types.ProviderAWS:
+		ca.Aws, cb.Aws = a.ConnectAs.Aws, b.ConnectAs.Aws
+	case types.ProviderAzure:
+		ca.Azure, cb.Azure = a.ConnectAs.Azure, b.ConnectAs.Azure
+	case types.ProviderGCP:
+		ca.Gcp, cb.Gcp = a.ConnectAs.Gcp, b.ConnectAs.Gcp
+	case types.ProviderOnPrem:
+		ca.OnPrem, cb.OnPrem = a.ConnectAs.OnPrem, b.ConnectAs.OnPrem
+	}
+	if da, db := describeConnectAs(ca), describeConnectAs(cb); da != db {
+		diffs = append(diffs, fmt.Sprintf("connectAs: %s != %s", da, db))
+	}
+	if a.GrantAccess != b.GrantAccess {
+		diffs = append(diffs, fmt.Sprintf("grantAccess: %d != %d", a.GrantAccess, b.GrantAccess))
+	}
+	if sa, sb := describeSchedule(a), describeSchedule(b); sa != sb {
+		diffs = append(diffs, fmt.Sprintf("schedule: %s != %s", sa, sb))
+	}
+	return diffs
+}
+
+// Returns a normalized description of a rule schedule
+func describeSchedule(ci types.ConnectionInformation) string {
+	days := "every day"
+	if len(ci.DaysOfWeek) != 0 {
+		var d []string
+		for wd := 0; wd < 7; wd++ {
+			if slices.Contains(ci.DaysOfWeek, shortWeekday(time.Weekday(wd))) {
+				d = append(d, string(shortWeekday(time.Weekday(wd))))
+			}
+		}
+		days = strings.Join(d, ",")
+	}
+	hours := "all day"
+	if !ci.FullDays && (len(ci.HoursFrom) != 0 || len(ci.HoursTo) != 0) {
+		hours = ci.HoursFrom + "-" + ci.HoursTo
+	}
+	tz := ci.TimeZone
+	if len(tz) == 0 {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%s %s %s", days, hours, tz)
+}
+
+// Determines if two rule schedules may be open at the same time. Schedules
+// in different time zones are assumed to overlap.
+func schedulesOverlap(a, b types.ConnectionInformation) bool {
+	if a.TimeZone != b.TimeZone {
+		return true
+	}
+
+	// Windows past midnight spill into the following day, so only compare
+	// days and hours when neither does
+	aFrom, aTo, aHours := scheduleHours(a)
+	bFrom, bTo, bHours := scheduleHours(b)
+	if (aHours && aTo <= aFrom) || (bHours && bTo <= bFrom) {
+		return true
+	}
+
+	var sharedDay bool
+	for wd := 0; wd < 7; wd++ {
+		if dayAllowed(a.DaysOfWeek, time.Weekday(wd)) && dayAllowed(b.DaysOfWeek, time.Weekday(wd)) {
+			sharedDay = true
+		}
+	}
+	if !sharedDay {
+		return false
+	}
+	if aHours && bHours {
+		return aFrom < bTo && bFrom < aTo
+	}
+	return true
+}
+
+// Returns the schedule hours in minutes, and false for full day schedules
+func scheduleHours(ci types.ConnectionInformation) (int, int, bool) {
+	if ci.FullDays || (len(ci.HoursFrom) == 0 && len(ci.HoursTo) == 0) {
+		return 0, 0, false
+	}
+	from, errFrom := parseClock(ci.HoursFrom)
+	to, errTo := parseClock(ci.HoursTo)
+	if errFrom != nil || errTo != nil {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// providerScope is the normalized target scope of a policy for a provider.
+// Empty dimensions match every machine, except fqdn which matches nothing.
+type providerScope struct {
+	dims map[string][]string
+	tags map[string][]string
+	fqdn []string
+}
+
+// Builds the normalized scope of a policy for a provider
+func policyScope(p types.Policy, provider types.Provider) providerScope {
+	pd := p.ProvidersData
+	s := providerScope{dims: map[string][]string{}, tags: map[string][]string{}}
+	addTags := func(tags []types.Tags) {
+		for _, t := range tags {
+			s.tags[t.Key] = append(s.tags[t.Key], t.Value...)
+		}
+	}
+
+	switch provider {
+	case types.ProviderAWS:
+		aws := deref(pd.Aws)
+		s.dims["account"] = aws.AccountIds
+		s.dims["region"] = aws.Regions
+		s.dims["vpc"] = aws.VpcIds
+		addTags(aws.Tags)
+	case types.ProviderAzure:
+		azure := deref(pd.Azure)
+		s.dims["subscription"] = azure.Subscriptions
+		s.dims["region"] = azure.Regions
+		s.dims["vnet"] = azure.VnetIds
+		s.dims["resourceGroup"] = azure.ResourceGroups
+		addTags(azure.Tags)
+	case types.ProviderGCP:
+		gcp := deref(pd.Gcp)
+		s.dims["project"] = gcp.Projects
+		s.dims["region"] = gcp.Regions
+		s.dims["vpc"] = gcp.VpcIds
+		addTags(labelsToTags(gcp.Labels))
+	case types.ProviderOnPrem:
+		for _, r := range deref(pd.OnPrem).FqdnRules {
+			s.fqdn = append(s.fqdn, strings.ToUpper(r.Operator)+"|"+r.ComputernamePattern+"|"+r.Domain)
+		}
+	}
+	return s
+}
+
+// Determines if some machine could be within both scopes
+func (s providerScope) overlaps(o providerScope) bool {
+	for k, v := range s.dims {
+		if len(v) != 0 && len(o.dims[k]) != 0 && len(intersectFold(v, o.dims[k])) == 0 {
+			return false
+		}
+	}
+	for k, v := range s.tags {
+		ov, ok := o.tags[k]
+		if ok && len(v) != 0 && len(ov) != 0 && len(intersectFold(v, ov)) == 0 {
+			return false
+		}
+	}
+	if len(s.fqdn) != 0 || len(o.fqdn) != 0 {
+		return len(intersectFold(s.fqdn, o.fqdn)) != 0
+	}
+	return true
+}
+
+// Determines if every machine within o is also within s
+func (s providerScope) covers(o providerScope) bool {
+	for k, v := range s.dims {
+		if len(v) != 0 && (len(o.dims[k]) == 0 || !subsetFold(o.dims[k], v)) {
+			return false
+		}
+	}
+	for k, v := range s.tags {
+		ov, ok := o.tags[k]
+		if !ok {
+			return false
+		}
+		if len(v) != 0 && (len(ov) == 0 || !subsetFold(ov, v)) {
+			return false
+		}
+	}
+	return subsetFold(o.fqdn, s.fqdn)
+}
+
+// Determines if both scopes match the same machines
+func (s providerScope) equal(o providerScope) bool {
+	return s.covers(o) && o.covers(s)
+}
+
+// Returns the values present in both slices, compared case-insensitively
+func intersectFold(a, b []string) []string {
+	var out []string
+	for _, v := range a {
+		if containsFold(b, v) && !containsFold(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Determines if every value of a is present in b
+func subsetFold(a, b []string) bool {
+	for _, v := range a {
+		if !containsFold(b, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Determines if both slices contain the same values
+func equalFold(a, b []string) bool {
+	return subsetFold(a, b) && subsetFold(b, a)
+}
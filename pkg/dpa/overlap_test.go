@@ -0,0 +1,138 @@
+package dpa
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Builds an AWS policy used by the overlap tests
+func overlapPolicy(name string, regions []string, role, ssh string, grant int, days []types.DayOfWeek) types.Policy {
+	p := validPolicy()
+	p.PolicyID, p.PolicyName = name+"-id", name
+	p.ProvidersData.Aws = &types.Aws{Regions: regions}
+
+	r := &p.UserAccessRules[0]
+	r.RuleName = name + " Rule"
+	r.UserData.Roles = []types.Roles{{Name: role}}
+	r.ConnectionInformation.ConnectAs.Aws.SSH = ssh
+	r.ConnectionInformation.GrantAccess = grant
+	r.ConnectionInformation.DaysOfWeek = days
+	r.ConnectionInformation.TimeZone = "UTC"
+	return p
+}
+
+func TestAnalyzeOverlaps(t *testing.T) {
+	weekdays := []types.DayOfWeek{types.Monday, types.Tuesday, types.Wednesday, types.Thursday, types.Friday}
+
+	var tests = []struct {
+		name     string
+		policies []types.Policy
+		want     []OverlapKind
+		first    string
+	}{
+		{
+			name: "Duplicate",
+			policies: []types.Policy{
+				overlapPolicy("A", []string{"us-east-1"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("B", []string{"US-EAST-1"}, "devops", "ec2-user", 2, weekdays),
+			},
+			want:  []OverlapKind{OverlapDuplicate},
+			first: "A",
+		},
+		{
+			name: "Superset",
+			policies: []types.Policy{
+				overlapPolicy("Narrow", []string{"us-east-1"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("Wide", nil, "DevOps", "ec2-user", 2, weekdays),
+			},
+			want:  []OverlapKind{OverlapSuperset},
+			first: "Wide",
+		},
+		{
+			name: "Conflicting Connect As",
+			policies: []types.Policy{
+				overlapPolicy("A", []string{"us-east-1", "us-east-2"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("B", []string{"us-east-2"}, "DevOps", "ubuntu", 2, weekdays),
+			},
+			want:  []OverlapKind{OverlapConflict},
+			first: "A",
+		},
+		{
+			name: "Conflicting Grant Access",
+			policies: []types.Policy{
+				overlapPolicy("A", []string{"us-east-1"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("B", []string{"us-east-1"}, "DevOps", "ec2-user", 8, weekdays),
+			},
+			want:  []OverlapKind{OverlapConflict},
+			first: "A",
+		},
+		{
+			name: "Different Regions",
+			policies: []types.Policy{
+				overlapPolicy("A", []string{"us-east-1"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("B", []string{"eu-west-1"}, "DevOps", "ubuntu", 2, weekdays),
+			},
+			want: nil,
+		},
+		{
+			name: "Different Roles",
+			policies: []types.Policy{
+				overlapPolicy("A", []string{"us-east-1"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("B", []string{"us-east-1"}, "Finance", "ubuntu", 2, weekdays),
+			},
+			want: nil,
+		},
+		{
+			name: "Different Days",
+			policies: []types.Policy{
+				overlapPolicy("A", []string{"us-east-1"}, "DevOps", "ec2-user", 2, weekdays),
+				overlapPolicy("B", []string{"us-east-1"}, "DevOps", "ubuntu", 2, []types.DayOfWeek{types.Saturday, types.Sunday}),
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzeOverlaps(tt.policies)
+
+			var kinds []OverlapKind
+			for _, o := range got {
+				kinds = append(kinds, o.Kind)
+			}
+			if len(kinds) != len(tt.want) {
+				t.Fatalf("AnalyzeOverlaps() kinds = %v, want %v", kinds, tt.want)
+			}
+			for i := range kinds {
+				if kinds[i] != tt.want[i] {
+					t.Errorf("AnalyzeOverlaps() kinds = %v, want %v", kinds, tt.want)
+				}
+			}
+			if len(got) != 0 && got[0].First.PolicyName != tt.first {
+				t.Errorf("AnalyzeOverlaps() first = %s, want %s", got[0].First.PolicyName, tt.first)
+			}
+		})
+	}
+}
+
+func TestWriteOverlapReport(t *testing.T) {
+	overlaps := AnalyzeOverlaps([]types.Policy{
+		overlapPolicy("A", []string{"us-east-1"}, "DevOps", "ec2-user", 2, nil),
+		overlapPolicy("B", []string{"us-east-1"}, "DevOps", "ubuntu", 2, nil),
+	})
+
+	var buf bytes.Buffer
+	if err := WriteOverlapReport(&buf, overlaps); err != nil {
+		t.Fatalf("WriteOverlapReport() error = %v", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, `conflict AWS: "A" rule "A Rule" and "B" rule "B Rule" share role:DevOps`) {
+		t.Errorf("WriteOverlapReport() output = %s", out)
+	}
+	if !strings.Contains(out, "\tconnectAs: "+`{"AWS":{"ssh":"ec2-user"}} != {"AWS":{"ssh":"ubuntu"}}`) {
+		t.Errorf("WriteOverlapReport() missing differences in %s", out)
+	}
+}
@@ -2,25 +2,49 @@ package dpa
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
+	"path"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
 )
 
-var (
-	deletePolicy string
+// ListPoliciesPageSize is the number of items requested per page when a
+// list endpoint reports more items than were returned
+const ListPoliciesPageSize = 100
 
-	addPolicy    types.AddPolicy
-	listPolicies types.ListPolicies
-	getPolicy    types.Policy
-	policy       types.Policy
-)
+// ListPoliciesOptions filters the policies returned by ListPoliciesWithOptions.
+// Empty fields do not filter. Status is sent to the API as a query parameter
+// when a single status is requested, every filter is also applied to the
+// returned items.
+type ListPoliciesOptions struct {
+	// Policies with any of the statuses
+	Status []types.PolicyStatus
+	// Policies covering any of the platforms
+	Platforms []types.Provider
+	// Policies with a rule of this name, compared case-insensitively
+	RuleName string
+	// Policies whose name matches this path.Match pattern, compared
+	// case-insensitively
+	NameGlob string
+	// Policies updated at or after UpdatedAfter and before UpdatedBefore.
+	// Policies without an UpdatedOn never match a time range.
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+}
 
 // ListPolicies returns all of the currently configured policies
 // Returns types.ListPolicies or types.ErrorResponse based on the
 // response from the API. An error is returned on request failure
+// Note: When the API returns an error response the list is nil, earlier
+// versions returned an empty list alongside the error response.
 //
 // Example:
 //
@@ -30,14 +54,199 @@ var (
 //		return
 //	}
 func (s *Service) ListPolicies(ctx context.Context) (*types.ListPolicies, *types.ErrorResponse, error) {
+	return s.ListPoliciesWithOptions(ctx, ListPoliciesOptions{})
+}
+
+// ListPoliciesWithOptions returns the configured policies matching the
+// provided options. When the API reports a TotalCount larger than the
+// items returned the remaining pages are requested using the limit and
+// offset query parameters. TotalCount of the response is the number of
+// matching policies.
+// Returns types.ListPolicies or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+// Note: When the API returns an error response for any page the list is
+// nil.
+//
+// Example:
+//
+//	opts := dpa.ListPoliciesOptions{
+//		Status:    []types.PolicyStatus{types.PolicyStatusEnabled},
+//		Platforms: []types.Provider{types.ProviderAWS},
+//		NameGlob:  "prod-*",
+//	}
+//	resp, dpaerr, err := s.ListPoliciesWithOptions(context.Background(), opts)
+//	if err != nil {
+//		log.Fatalf("Failed to list policies. %s", err)
+//		return
+//	}
+func (s *Service) ListPoliciesWithOptions(ctx context.Context, opts ListPoliciesOptions) (*types.ListPolicies, *types.ErrorResponse, error) {
+	if len(opts.NameGlob) != 0 {
+		if _, err := path.Match(opts.NameGlob, ""); err != nil {
+			return nil, nil, fmt.Errorf("listPolicies: Invalid name pattern %q. %s", opts.NameGlob, err)
+		}
+	}
+
+	q := url.Values{}
+	if len(opts.Status) == 1 {
+		q.Set("status", string(opts.Status[0]))
+	}
+
+	items, dpaerr, err := listAllPages(ctx, s, "listPolicies", "/access-policies", q, func(i types.Items) string { return i.PolicyID })
+	if err != nil {
+		return nil, nil, err
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	matched := []types.Items{}
+	for _, item := range items {
+		if opts.match(item) {
+			matched = append(matched, item)
+		}
+	}
+	return &types.ListPolicies{Items: matched, TotalCount: len(matched)}, &types.ErrorResponse{}, nil
+}
+
+// A page of a list response
+type listPage[T any] struct {
+	Items      []T `json:"items"`
+	TotalCount int `json:"totalCount"`
+}
+
+// Requests every page of a list endpoint. When the API reports a
+// TotalCount larger than the items returned the remaining pages are
+// requested using the limit and offset query parameters.
+func listAllPages[T any](ctx context.Context, s *Service, op, basePath string, q url.Values, id func(T) string) ([]T, *types.ErrorResponse, error) {
+	q = maps.Clone(q)
+	if q == nil {
+		q = url.Values{}
+	}
+
+	var items []T
+	for {
+		page, dpaerr, err := getListPage[T](ctx, s, op, basePath, q)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !dpaerr.Empty() {
+			return nil, dpaerr, nil
+		}
+
+		// Stop when the API has no more items or ignored the offset and
+		// returned the first page again
+		if len(page.Items) == 0 || (len(items) != 0 && id(page.Items[0]) == id(items[0])) {
+			break
+		}
+		items = append(items, page.Items...)
+		if len(items) >= page.TotalCount {
+			break
+		}
+		q.Set("limit", strconv.Itoa(ListPoliciesPageSize))
+		q.Set("offset", strconv.Itoa(len(items)))
+	}
+	return items, &types.ErrorResponse{}, nil
+}
+
+// Requests a single page of a list endpoint
+func getListPage[T any](ctx context.Context, s *Service, op, basePath string, q url.Values) (*listPage[T], *types.ErrorResponse, error) {
 	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
-	if err := s.client.Get(ctx, "/access-policies", &listPolicies, &errorResponse); err != nil {
+
+	path := basePath
+	if len(q) != 0 {
+		path = fmt.Sprintf("%s?%s", path, q.Encode())
+	}
+
+	var page listPage[T]
+	var errorResponse types.ErrorResponse
+	if err := s.client.Get(ctx, path, &page, &errorResponse); err != nil {
 		defer cancelCtx()
-		return nil, nil, fmt.Errorf("listPolicies: Failed to get access policies. %s", err)
+		return nil, nil, fmt.Errorf("%s: Failed to get list page. %s", op, err)
 	}
 
 	defer cancelCtx()
-	return &listPolicies, &errorResponse, nil
+	return &page, &errorResponse, nil
+}
+
+// Reports whether a listed policy matches the options
+func (o ListPoliciesOptions) match(item types.Items) bool {
+	if len(o.Status) != 0 && !slices.Contains(o.Status, item.Status) {
+		return false
+	}
+	if len(o.Platforms) != 0 && !slices.ContainsFunc(item.Platforms, func(p types.Provider) bool {
+		return slices.Contains(o.Platforms, p)
+	}) {
+		return false
+	}
+	if len(o.RuleName) != 0 && !containsFold(item.RuleNames, o.RuleName) {
+		return false
+	}
+	if len(o.NameGlob) != 0 {
+		if ok, _ := path.Match(strings.ToLower(o.NameGlob), strings.ToLower(item.PolicyName)); !ok {
+			return false
+		}
+	}
+	if !o.UpdatedAfter.IsZero() || !o.UpdatedBefore.IsZero() {
+		updated, err := parseUpdatedOn(item.UpdatedOn)
+		if err != nil {
+			return false
+		}
+		if !o.UpdatedAfter.IsZero() && updated.Before(o.UpdatedAfter) {
+			return false
+		}
+		if !o.UpdatedBefore.IsZero() && !updated.Before(o.UpdatedBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPolicyByName returns the policy with the provided name. An exact name
+// match is preferred, otherwise the name is compared case-insensitively.
+// An error wrapping ErrNotFound is returned when no policy has the name,
+// and an error is returned when more than one policy matches.
+// Returns types.Policy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	resp, dpaerr, err := s.GetPolicyByName(context.Background(), "Production System Access")
+//	if err != nil {
+//		log.Fatalf("Failed to get policy. %s", err)
+//		return
+//	}
+func (s *Service) GetPolicyByName(ctx context.Context, name string) (*types.Policy, *types.ErrorResponse, error) {
+	if len(name) == 0 {
+		return nil, nil, fmt.Errorf("getPolicyByName: Policy name cannot be empty")
+	}
+
+	list, dpaerr, err := s.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getPolicyByName: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	var exact, folded []string
+	for _, item := range list.Items {
+		if item.PolicyName == name {
+			exact = append(exact, item.PolicyID)
+		} else if strings.EqualFold(item.PolicyName, name) {
+			folded = append(folded, item.PolicyID)
+		}
+	}
+	ids := exact
+	if len(ids) == 0 {
+		ids = folded
+	}
+	switch len(ids) {
+	case 0:
+		return nil, nil, fmt.Errorf("getPolicyByName: Policy %q not found. %w", name, ErrNotFound)
+	case 1:
+		return s.GetPolicy(ctx, ids[0])
+	}
+	return nil, nil, fmt.Errorf("getPolicyByName: Policy name %q is ambiguous, matching policies %s", name, strings.Join(ids, ", "))
 }
 
 // GetPolicy returns a specific policy
@@ -63,6 +272,8 @@ func (s *Service) GetPolicy(ctx context.Context, i string) (*types.Policy, *type
 
 	// Create path and get policy using policy id
 	path := fmt.Sprintf("/access-policies/%s", i)
+	var getPolicy types.Policy
+	var errorResponse types.ErrorResponse
 	if err := s.client.Get(ctx, path, &getPolicy, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("lgetPolicies: Failed to get access policy. %s", err)
@@ -72,6 +283,42 @@ func (s *Service) GetPolicy(ctx context.Context, i string) (*types.Policy, *type
 	return &getPolicy, &errorResponse, nil
 }
 
+// FetchPolicies returns the full details of every configured policy by
+// listing the policies and retrieving each one with GetPolicy.
+// Returns a slice of types.Policy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure
+//
+// Example:
+//
+//	policies, dpaerr, err := s.FetchPolicies(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to fetch policies. %s", err)
+//		return
+//	}
+func (s *Service) FetchPolicies(ctx context.Context) ([]types.Policy, *types.ErrorResponse, error) {
+	list, dpaerr, err := s.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetchPolicies: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+
+	policies := make([]types.Policy, 0, len(list.Items))
+	for _, item := range list.Items {
+		p, dpaerr, err := s.GetPolicy(ctx, item.PolicyID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fetchPolicies: %s", err)
+		}
+		if !dpaerr.Empty() {
+			return nil, dpaerr, nil
+		}
+		policies = append(policies, *p)
+	}
+
+	return policies, &types.ErrorResponse{}, nil
+}
+
 // Add Policy creates a new policy
 // Expects a struct of type types.Policy
 // Returns types.AddPolicy or types.ErrorResponse based on the
@@ -84,7 +331,7 @@ func (s *Service) GetPolicy(ctx context.Context, i string) (*types.Policy, *type
 //		PolicyName: "Test Policy",
 //		Status:     "Enabled",
 //		ProvidersData: types.ProvidersData{
-//			Aws: types.Aws{
+//			Aws: &types.Aws{
 //				Regions:    []string{"us-east-1"},
 //				Tags:       []types.Tags{},
 //				VpcIds:     []string{},
@@ -105,13 +352,13 @@ func (s *Service) GetPolicy(ctx context.Context, i string) (*types.Policy, *type
 //				},
 //				ConnectionInformation: types.ConnectionInformation{
 //				ConnectAs: types.ConnectAs{
-//					Aws: types.ConnectAsAws{
+//					Aws: &types.ConnectAsAws{
 //						SSH: "ec2-user",
 //						},
 //					},
 //				GrantAccess: 3,
 //				IdleTime:    10,
-//				DaysOfWeek:  []string{"Mon", "Tue"},
+//				DaysOfWeek:  []types.DayOfWeek{types.Monday, types.Tuesday},
 //				FullDays:    true,
 //				TimeZone:    "Asia/Jerusalem",
 //				},
@@ -129,13 +376,21 @@ func (s *Service) AddPolicy(ctx context.Context, p interface{}) (*types.AddPolic
 	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
 
 	// Validate provided type
-	val := reflect.ValueOf(p)
+	val := reflect.Indirect(reflect.ValueOf(p))
 	if val.Kind() != reflect.Struct {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("addPolicy: Invalid type provided. Expected struct of format types.Policy")
 	}
 
+	// Reject policies which violate the guardrails
+	if err := s.checkGuardrails(p); err != nil {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("addPolicy: Policy rejected by guardrails. %w", err)
+	}
+
 	// Make request to add policy via service client
+	var addPolicy types.AddPolicy
+	var errorResponse types.ErrorResponse
 	if err := s.client.Post(ctx, "/access-policies", p, &addPolicy, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("addPolicy: Failed to add policy. %s", err)
@@ -145,9 +400,10 @@ func (s *Service) AddPolicy(ctx context.Context, p interface{}) (*types.AddPolic
 	return &addPolicy, &errorResponse, nil
 }
 
-// Update Policy replaces an existing policy
+// Update Policy replaces an existing policy using a PUT request
 // Expects a struct of type types.Policy and a string with the policy ID.
-// Note: The policy ID in the request body must match the policy ID in the path.
+// Note: The policy ID in the request body must match the policy ID in the
+// path, a mismatch is rejected before the request is sent.
 //
 // Returns types.Policy or types.ErrorResponse based on the
 // response from the API. An error is returned on request failure.
@@ -157,10 +413,10 @@ func (s *Service) AddPolicy(ctx context.Context, p interface{}) (*types.AddPolic
 //	// Fill out policy Information
 //	validSamplePolicy := types.Policy{
 //		PolicyName: "Test Policy",
-//		PolicyId: "c12f982a-ab1a-12ab-1a31-f221aa31836a"
+//		PolicyID:   "c12f982a-ab1a-12ab-1a31-f221aa31836a",
 //		Status:     "Enabled",
 //		ProvidersData: types.ProvidersData{
-//			Aws: types.Aws{
+//			Aws: &types.Aws{
 //				Regions:    []string{"us-east-1"},
 //				Tags:       []types.Tags{},
 //				VpcIds:     []string{},
@@ -181,13 +437,13 @@ func (s *Service) AddPolicy(ctx context.Context, p interface{}) (*types.AddPolic
 //				},
 //				ConnectionInformation: types.ConnectionInformation{
 //				ConnectAs: types.ConnectAs{
-//					Aws: types.ConnectAsAws{
+//					Aws: &types.ConnectAsAws{
 //						SSH: "ec2-user",
 //						},
 //					},
 //				GrantAccess: 3,
 //				IdleTime:    10,
-//				DaysOfWeek:  []string{"Mon", "Tue"},
+//				DaysOfWeek:  []types.DayOfWeek{types.Monday, types.Tuesday},
 //				FullDays:    true,
 //				TimeZone:    "Asia/Jerusalem",
 //				},
@@ -195,12 +451,17 @@ func (s *Service) AddPolicy(ctx context.Context, p interface{}) (*types.AddPolic
 //		},
 //	}
 //
-//	resp, dpaerr, err := s.UpdatePolicy(context.Background(), validSamplePolicy)
+//	resp, dpaerr, err := s.UpdatePolicy(context.Background(), validSamplePolicy, validSamplePolicy.PolicyID)
 //	if err != nil {
 //		log.Fatalf("Failed to update policy. %s", err)
 //		return
 //	}
 func (s *Service) UpdatePolicy(ctx context.Context, p interface{}, i string) (*types.Policy, *types.ErrorResponse, error) {
+	return s.updatePolicy(ctx, p, i, true)
+}
+
+// Writes a policy, checking the guardrails first when guard is set
+func (s *Service) updatePolicy(ctx context.Context, p interface{}, i string, guard bool) (*types.Policy, *types.ErrorResponse, error) {
 	// Set a timeout for the request
 	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
 
@@ -211,25 +472,121 @@ func (s *Service) UpdatePolicy(ctx context.Context, p interface{}, i string) (*t
 	}
 
 	// Validate provided type
-	val := reflect.ValueOf(p)
+	val := reflect.Indirect(reflect.ValueOf(p))
 	if val.Kind() != reflect.Struct {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("updatePolicy: Invalid type provided. Expected struct of format types.Policy")
 	}
 
+	// Validate the policy id in the body matches the path
+	if id := val.FieldByName("PolicyID"); !id.IsValid() || id.Kind() != reflect.String || id.String() != i {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("updatePolicy: Policy id in the request body must match policy id %s", i)
+	}
+
+	// Reject policies which violate the guardrails
+	if guard {
+		if err := s.checkGuardrails(p); err != nil {
+			defer cancelCtx()
+			return nil, nil, fmt.Errorf("updatePolicy: Policy rejected by guardrails. %w", err)
+		}
+	}
+
 	// Create path and get policy using policy id
 	path := fmt.Sprintf("/access-policies/%s", i)
 
-	// Make request to add policy via service client
-	if err := s.client.Post(ctx, path, p, &policy, &errorResponse); err != nil {
+	// Make request to update policy via service client
+	var policy types.Policy
+	var errorResponse types.ErrorResponse
+	if err := s.client.Put(ctx, path, p, &policy, &errorResponse); err != nil {
 		defer cancelCtx()
-		return nil, nil, fmt.Errorf("updatePolicy: Failed to add policy. %s", err)
+		return nil, nil, fmt.Errorf("updatePolicy: Failed to update policy. %w", err)
 	}
 
 	defer cancelCtx()
 	return &policy, &errorResponse, nil
 }
 
+// Number of times ModifyPolicy retries after a concurrent modification
+const modifyPolicyAttempts = 3
+
+// ModifyPolicy applies a change to an existing policy. The current policy is
+// retrieved, passed to fn to be modified in place and written back with
+// UpdatePolicy. If the policy's UpdatedOn changes before the write, or the
+// API reports a conflict, the whole fetch-modify-write is retried so fn may
+// be called more than once. An error returned by fn aborts the update.
+//
+// The API has no precondition for writes, so the second fetch only narrows
+// the window in which a concurrent change can be overwritten. A change made
+// between that fetch and the write is lost unless the API reports a conflict.
+//
+// Guardrails are not checked when fn only changes the policy's Status, so a
+// policy which violates a guardrail can still be disabled or enabled.
+//
+// Returns the updated types.Policy or types.ErrorResponse based on the
+// response from the API. An error is returned on request failure or when
+// the policy keeps changing, in which case it wraps ErrConflict.
+//
+// Example:
+//
+//	resp, dpaerr, err := s.ModifyPolicy(context.Background(), policyID, func(p *types.Policy) error {
+//		p.Status = types.PolicyStatusDisabled
+//		return nil
+//	})
+//	if err != nil {
+//		log.Fatalf("Failed to modify policy. %s", err)
+//		return
+//	}
+func (s *Service) ModifyPolicy(ctx context.Context, i string, fn func(*types.Policy) error) (*types.Policy, *types.ErrorResponse, error) {
+	if len(i) == 0 {
+		return nil, nil, fmt.Errorf("modifyPolicy: Policy id cannot be empty")
+	}
+
+	for attempt := 0; attempt < modifyPolicyAttempts; attempt++ {
+		current, dpaerr, err := s.GetPolicy(ctx, i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("modifyPolicy: Failed to get policy. %w", err)
+		}
+		if !dpaerr.Empty() {
+			return nil, dpaerr, nil
+		}
+
+		updatedOn := current.UpdatedOn
+		if err := fn(current); err != nil {
+			return nil, nil, fmt.Errorf("modifyPolicy: Failed to modify policy %s. %w", i, err)
+		}
+		current.PolicyID = i
+
+		// Check nobody else changed the policy while it was being modified
+		latest, dpaerr, err := s.GetPolicy(ctx, i)
+		if err != nil {
+			return nil, nil, fmt.Errorf("modifyPolicy: Failed to get policy. %w", err)
+		}
+		if !dpaerr.Empty() {
+			return nil, dpaerr, nil
+		}
+		if latest.UpdatedOn != updatedOn {
+			continue
+		}
+
+		// Status changes are allowed for policies violating a guardrail
+		unchanged := *current
+		unchanged.Status = latest.Status
+		statusOnly := reflect.DeepEqual(unchanged, *latest)
+
+		updated, dpaerr, err := s.updatePolicy(ctx, current, i, !statusOnly)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("modifyPolicy: Failed to update policy. %w", err)
+		}
+		return updated, dpaerr, nil
+	}
+
+	return nil, nil, fmt.Errorf("modifyPolicy: Policy %s was modified concurrently %d times. %w", i, modifyPolicyAttempts, ErrConflict)
+}
+
 // DeletePolicy deletes a specific policy
 // Returns no response if succesfull or types.ErrorResponse based on the
 // response from the API. An error is returned on request failure.
@@ -249,6 +606,8 @@ func (s *Service) DeletePolicy(ctx context.Context, p string) (*types.ErrorRespo
 
 	// Make request to delete policy via service client
 	path := fmt.Sprintf("/access-policies/%s", p)
+	var deletePolicy string
+	var errorResponse types.ErrorResponse
 	if err := s.client.Delete(ctx, path, nil, &deletePolicy, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, fmt.Errorf("deletepolicy: Failed to delete policy. %s", err)
@@ -2,8 +2,16 @@ package dpa
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,7 +23,7 @@ var validSamplePolicy = types.Policy{
 	PolicyName: "Test Policy",
 	Status:     "Enabled",
 	ProvidersData: types.ProvidersData{
-		Aws: types.Aws{
+		Aws: &types.Aws{
 			Regions:    []string{"us-east-1"},
 			Tags:       []types.Tags{},
 			VpcIds:     []string{},
@@ -36,13 +44,13 @@ var validSamplePolicy = types.Policy{
 			},
 			ConnectionInformation: types.ConnectionInformation{
 				ConnectAs: types.ConnectAs{
-					Aws: types.ConnectAsAws{
+					Aws: &types.ConnectAsAws{
 						SSH: "ec2-user",
 					},
 				},
 				GrantAccess: 3,
 				IdleTime:    10,
-				DaysOfWeek:  []string{"Mon", "Tue"},
+				DaysOfWeek:  []types.DayOfWeek{types.Monday, types.Tuesday},
 				FullDays:    true,
 				TimeZone:    "Asia/Jerusalem",
 			},
@@ -50,6 +58,30 @@ var validSamplePolicy = types.Policy{
 	},
 }
 
+// Returns an enabled AWS policy with one rule granting the Ops role SSH
+// access as ec2-user. Each call builds a new policy so tests may modify it
+// and only set the fields they need to differ.
+func validPolicy() types.Policy {
+	return types.Policy{
+		PolicyID:      "id-1",
+		PolicyName:    "Ops",
+		Status:        types.PolicyStatusEnabled,
+		ProvidersData: types.ProvidersData{Aws: &types.Aws{AccountIds: []string{"111111111111"}}},
+		UserAccessRules: []types.UserAccessRules{
+			{
+				RuleName: "Ops",
+				UserData: types.UserData{Roles: []types.Roles{{Name: "Ops", Source: "IDENTITY"}}},
+				ConnectionInformation: types.ConnectionInformation{
+					ConnectAs:   types.ConnectAs{Aws: &types.ConnectAsAws{SSH: "ec2-user"}},
+					GrantAccess: 2,
+					FullDays:    true,
+				},
+			},
+		},
+		UpdatedOn: "2024-02-13T12:34:56",
+	}
+}
+
 func TestListPolicies(t *testing.T) {
 	var tests = []struct {
 		name     string
@@ -57,6 +89,7 @@ func TestListPolicies(t *testing.T) {
 		sleep    time.Duration
 		response string
 		wantErr  bool
+		wantList bool
 	}{
 		{
 			name:    "Invalid Timeout",
@@ -70,6 +103,19 @@ func TestListPolicies(t *testing.T) {
 			sleep:   1 * time.Millisecond,
 			wantErr: true,
 		},
+		{
+			name:   "Invalid Error Response",
+			header: http.StatusBadRequest,
+			response: `{
+				"code": "DPA_INVALID_VALUE",
+				"message": "Invalid query parameter",
+				"description": "Invalid query parameter",
+				"doc": null,
+				"steps": null
+			}`,
+			sleep:   1 * time.Millisecond,
+			wantErr: false,
+		},
 		{
 			name: "Valid Response",
 			response: `{
@@ -104,9 +150,10 @@ func TestListPolicies(t *testing.T) {
 					],
 					"totalCount": 2
 				}`,
-			header:  http.StatusOK,
-			sleep:   1 * time.Millisecond,
-			wantErr: false,
+			header:   http.StatusOK,
+			sleep:    1 * time.Millisecond,
+			wantErr:  false,
+			wantList: true,
 		},
 	}
 
@@ -124,7 +171,7 @@ func TestListPolicies(t *testing.T) {
 			// Valid Service using httptest New Server URL
 			ns, _ := NewService(ts.URL, "api", false, validToken)
 
-			_, _, err := ns.ListPolicies(context.Background())
+			got, dpaerr, err := ns.ListPolicies(context.Background())
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("ListPolicies() error = %v, wantErr %v", err, tt.wantErr)
@@ -133,11 +180,253 @@ func TestListPolicies(t *testing.T) {
 				if err != nil {
 					t.Errorf("ListPolicies() error = %v, wantErr %v", err, tt.wantErr)
 				}
+				if (got != nil) != tt.wantList || dpaerr.Empty() != tt.wantList {
+					t.Errorf("ListPolicies() = %v, dpaerr = %v, want list %v", got, dpaerr, tt.wantList)
+				}
+			}
+		})
+	}
+}
+
+// Policies returned by the paginated list policies tests
+var listPolicyItems = []string{
+	`{"policyId":"id-1","status":"Enabled","policyName":"Prod SSH","updatedOn":"2024-01-10T10:00:00.000000","ruleNames":["Admins"],"platforms":["AWS"]}`,
+	`{"policyId":"id-2","status":"Disabled","policyName":"prod RDP","updatedOn":"2024-02-10T10:00:00.000000","ruleNames":["Operators"],"platforms":["OnPrem"]}`,
+	`{"policyId":"id-3","status":"Enabled","policyName":"Dev Access","updatedOn":"2024-03-10T10:00:00.000000","ruleNames":["Developers","Admins"],"platforms":["AWS","GCP"]}`,
+	`{"policyId":"id-4","status":"Enabled","policyName":"Prod SSH","ruleNames":["Admins"],"platforms":["Azure"]}`,
+}
+
+// Serves listPolicyItems two at a time using the offset query parameter
+func listPoliciesServer(requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/access-policies" {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"policyId":"%s","policyName":"Fetched"}`, path.Base(r.URL.Path))
+			return
+		}
+		*requests = append(*requests, r.URL.RawQuery)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		end := min(offset+2, len(listPolicyItems))
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"items":[%s],"totalCount":%d}`, strings.Join(listPolicyItems[offset:end], ","), len(listPolicyItems))
+	}))
+}
+
+func TestListPoliciesWithOptions(t *testing.T) {
+	var tests = []struct {
+		name      string
+		opts      ListPoliciesOptions
+		wantIDs   string
+		wantQuery string
+		wantErr   bool
+	}{
+		{
+			name:    "All Pages",
+			wantIDs: "id-1,id-2,id-3,id-4",
+		},
+		{
+			name:      "Status",
+			opts:      ListPoliciesOptions{Status: []types.PolicyStatus{types.PolicyStatusDisabled}},
+			wantIDs:   "id-2",
+			wantQuery: "status=Disabled",
+		},
+		{
+			name:    "Platform",
+			opts:    ListPoliciesOptions{Platforms: []types.Provider{types.ProviderGCP, types.ProviderOnPrem}},
+			wantIDs: "id-2,id-3",
+		},
+		{
+			name:    "Rule Name",
+			opts:    ListPoliciesOptions{RuleName: "admins"},
+			wantIDs: "id-1,id-3,id-4",
+		},
+		{
+			name:    "Name Glob",
+			opts:    ListPoliciesOptions{NameGlob: "PROD *"},
+			wantIDs: "id-1,id-2,id-4",
+		},
+		{
+			name: "Updated Range",
+			opts: ListPoliciesOptions{
+				UpdatedAfter:  time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+				UpdatedBefore: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+			wantIDs: "id-2",
+		},
+		{
+			name:    "Invalid Name Glob",
+			opts:    ListPoliciesOptions{NameGlob: "prod["},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			ts := listPoliciesServer(&requests)
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			got, _, err := ns.ListPoliciesWithOptions(context.Background(), tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ListPoliciesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListPoliciesWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var ids []string
+			for _, item := range got.Items {
+				ids = append(ids, item.PolicyID)
+			}
+			if strings.Join(ids, ",") != tt.wantIDs || got.TotalCount != len(ids) {
+				t.Errorf("ListPoliciesWithOptions() = %v (%d), want %s", ids, got.TotalCount, tt.wantIDs)
+			}
+			if len(requests) != 2 || requests[0] != tt.wantQuery {
+				t.Errorf("ListPoliciesWithOptions() requests = %q, want 2 starting with %q", requests, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestGetPolicyByName(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		wantID  string
+		wantErr bool
+	}{
+		{
+			name:   "Valid Case Insensitive Name",
+			input:  "prod rdp",
+			wantID: "id-2",
+		},
+		{
+			name:   "Valid Exact Name",
+			input:  "Dev Access",
+			wantID: "id-3",
+		},
+		{
+			name:    "Invalid Ambiguous Name",
+			input:   "Prod SSH",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Not Found",
+			input:   "QA Access",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Empty Name",
+			input:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			ts := listPoliciesServer(&requests)
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			got, _, err := ns.GetPolicyByName(context.Background(), tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GetPolicyByName() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPolicyByName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.PolicyID != tt.wantID {
+				t.Errorf("GetPolicyByName() = %s, want %s", got.PolicyID, tt.wantID)
 			}
 		})
 	}
 }
 
+// Policy response captured from the API
+const capturedPolicyResponse = `{
+	"policyId": "01a4f891-1591-4acb-ae3f-f27e56d45499",
+	"policyName": "Production System Access",
+	"status": "Draft",
+	"description": "",
+	"providersData": {
+		"OnPrem": {
+			"fqdnRulesConjunction": "OR",
+			"fqdnRules": [
+				{
+					"operator": "CONTAINS",
+					"computernamePattern": "prod",
+					"domain": "example.local"
+				},
+				{
+					"operator": "CONTAINS",
+					"computernamePattern": "prd",
+					"domain": "example.local"
+				}
+			],
+			"logicalNames": null
+		}
+	},
+	"startDate": null,
+	"endDate": null,
+	"userAccessRules": [
+		{
+			"ruleName": "StorageTower",
+			"userData": {
+				"roles": [
+					{
+						"name": "StorageTower",
+						"source": null
+					}
+				],
+				"groups": [],
+				"users": []
+			},
+			"connectionInformation": {
+				"connectAs": {
+					"OnPrem": {
+						"rdp": {
+							"localEphemeralUser": {
+								"assignGroups": [
+									"Remote Desktop Users",
+									"Administrators"
+								]
+							}
+						}
+					}
+				},
+				"grantAccess": 2,
+				"idleTime": 10,
+				"daysOfWeek": [
+					"Fri",
+					"Mon",
+					"Sat",
+					"Sun",
+					"Thu",
+					"Tue",
+					"Wed"
+				],
+				"fullDays": false,
+				"hoursFrom": "08:00",
+				"hoursTo": "18:00",
+				"timeZone": "America/New_York"
+			}
+		}
+	]
+}`
+
 func TestGetPolicy(t *testing.T) {
 	var tests = []struct {
 		name     string
@@ -176,81 +465,12 @@ func TestGetPolicy(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name:  "Valid Response",
-			input: "01a4f891-1591-4acb-ae3f-f27e56d45499",
-			response: `{
-				"policyId": "01a4f891-1591-4acb-ae3f-f27e56d45499",
-				"policyName": "Production System Access",
-				"status": "Draft",
-				"description": "",
-				"providersData": {
-					"OnPrem": {
-						"fqdnRulesConjunction": "OR",
-						"fqdnRules": [
-							{
-								"operator": "CONTAINS",
-								"computernamePattern": "prod",
-								"domain": "example.local"
-							},
-							{
-								"operator": "CONTAINS",
-								"computernamePattern": "prd",
-								"domain": "example.local"
-							}
-						],
-						"logicalNames": null
-					}
-				},
-				"startDate": null,
-				"endDate": null,
-				"userAccessRules": [
-					{
-						"ruleName": "StorageTower",
-						"userData": {
-							"roles": [
-								{
-									"name": "StorageTower",
-									"source": null
-								}
-							],
-							"groups": [],
-							"users": []
-						},
-						"connectionInformation": {
-							"connectAs": {
-								"OnPrem": {
-									"rdp": {
-										"localEphemeralUser": {
-											"assignGroups": [
-												"Remote Desktop Users",
-												"Administrators"
-											]
-										}
-									}
-								}
-							},
-							"grantAccess": 2,
-							"idleTime": 10,
-							"daysOfWeek": [
-								"Fri",
-								"Mon",
-								"Sat",
-								"Sun",
-								"Thu",
-								"Tue",
-								"Wed"
-							],
-							"fullDays": false,
-							"hoursFrom": "08:00",
-							"hoursTo": "18:00",
-							"timeZone": "America/New_York"
-						}
-					}
-				]
-			}`,
-			header:  http.StatusOK,
-			sleep:   1 * time.Millisecond,
-			wantErr: false,
+			name:     "Valid Response",
+			input:    "01a4f891-1591-4acb-ae3f-f27e56d45499",
+			response: capturedPolicyResponse,
+			header:   http.StatusOK,
+			sleep:    1 * time.Millisecond,
+			wantErr:  false,
 		},
 	}
 
@@ -321,6 +541,16 @@ func TestAddPolicy(t *testing.T) {
 			sleep:   1 * time.Millisecond,
 			wantErr: false,
 		},
+		{
+			name:  "Valid Policy Pointer Add Response",
+			input: &validSamplePolicy,
+			response: `{
+				"policyId": "07280193-cfd3-4155-b3dd-232a77a6c72a"
+			}`,
+			header:  http.StatusCreated,
+			sleep:   1 * time.Millisecond,
+			wantErr: false,
+		},
 		{
 			name:  "Valid Policy Add Response",
 			input: validSamplePolicy,
@@ -396,14 +626,26 @@ func TestUpdatePolicy(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name:   "Invalid Policy ID Mismatch",
+			name:    "Invalid Policy ID Mismatch",
+			input:   validSamplePolicy,
+			id:      "c12f322a-ab1a-12ab-1a31-f221aa31836b",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Missing Body Policy ID",
+			input:   struct{ PolicyName string }{PolicyName: "Test Policy"},
+			id:      "c12f982a-ab1a-12ab-1a31-f221aa31836a",
+			wantErr: true,
+		},
+		{
+			name:   "Invalid Status Bad Request",
 			input:  validSamplePolicy,
-			id:     "c12f322a-ab1a-12ab-1a31-f221aa31836b",
+			id:     "c12f982a-ab1a-12ab-1a31-f221aa31836a",
 			header: http.StatusBadRequest,
 			response: `{
 				"code": "DPA_CRUD_ACTION_FAILED",
 				"message": "Unable to update an Authorization Policy.",
-				"description": "Unable to update an Authorization Policy. Error(s): Policy ID in the path parameter is not the same as the policy ID in the request body",
+				"description": "Unable to update an Authorization Policy.",
 				"doc": null,
 				"steps": null
 			}`,
@@ -412,7 +654,7 @@ func TestUpdatePolicy(t *testing.T) {
 		},
 		{
 			name:  "Valid Policy Update Response",
-			id:    "76321c1a-32ff-488e-af40-b7ae5eefb808",
+			id:    "c12f982a-ab1a-12ab-1a31-f221aa31836a",
 			input: validSamplePolicy,
 			response: `{
 				"policyId": "76321c1a-32ff-488e-af40-b7ae5eefb808",
@@ -483,6 +725,9 @@ func TestUpdatePolicy(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Mock Response
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut {
+					t.Errorf("UpdatePolicy() method = %s, want %s", r.Method, http.MethodPut)
+				}
 				time.Sleep(tt.sleep)
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(int(tt.header))
@@ -508,6 +753,118 @@ func TestUpdatePolicy(t *testing.T) {
 
 }
 
+func TestModifyPolicy(t *testing.T) {
+	var tests = []struct {
+		name      string
+		notFound  bool
+		bumpOnGet int
+		conflicts int
+		fnErr     bool
+		wantGets  int
+		wantPuts  int
+		wantDpa   bool
+		wantErr   bool
+	}{
+		{
+			name:     "Valid Modify",
+			wantGets: 2,
+			wantPuts: 1,
+		},
+		{
+			name:      "Concurrent Modification Retried",
+			bumpOnGet: 2,
+			wantGets:  4,
+			wantPuts:  1,
+		},
+		{
+			name:      "Conflict Retried",
+			conflicts: 1,
+			wantGets:  4,
+			wantPuts:  2,
+		},
+		{
+			name:      "Invalid Persistent Conflict",
+			conflicts: 5,
+			wantGets:  6,
+			wantPuts:  3,
+			wantErr:   true,
+		},
+		{
+			name:     "Invalid Mutation Error",
+			fnErr:    true,
+			wantGets: 1,
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid Policy Not Found",
+			notFound: true,
+			wantGets: 1,
+			wantDpa:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets, puts, version int
+			var written types.Policy
+
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.Method {
+				case http.MethodGet:
+					gets++
+					if tt.notFound {
+						w.WriteHeader(http.StatusNotFound)
+						w.Write([]byte(`{"code":"DPA_CRUD_ACTION_FAILED","message":"Policy was not found"}`))
+						return
+					}
+					if gets == tt.bumpOnGet {
+						version++
+					}
+				case http.MethodPut:
+					puts++
+					if puts <= tt.conflicts {
+						w.WriteHeader(http.StatusConflict)
+						return
+					}
+					json.NewDecoder(r.Body).Decode(&written)
+					version++
+				}
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, `{"policyId":"c12f982a-ab1a-12ab-1a31-f221aa31836a","policyName":"Example Policy","status":"Enabled","updatedOn":"2024-01-01T00:00:%02d"}`, version)
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			_, dpaerr, err := ns.ModifyPolicy(context.Background(), "c12f982a-ab1a-12ab-1a31-f221aa31836a", func(p *types.Policy) error {
+				if tt.fnErr {
+					return fmt.Errorf("mutation failed")
+				}
+				p.Status = types.PolicyStatusDisabled
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ModifyPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.conflicts > modifyPolicyAttempts && !errors.Is(err, ErrConflict) {
+				t.Errorf("ModifyPolicy() error = %v, want ErrConflict", err)
+			}
+			if (dpaerr != nil && !dpaerr.Empty()) != tt.wantDpa {
+				t.Errorf("ModifyPolicy() dpaerr = %v, wantDpa %v", dpaerr, tt.wantDpa)
+			}
+			if gets != tt.wantGets || puts != tt.wantPuts {
+				t.Errorf("ModifyPolicy() requests = %d GET %d PUT, want %d GET %d PUT", gets, puts, tt.wantGets, tt.wantPuts)
+			}
+			if !tt.wantErr && !tt.wantDpa && written.Status != types.PolicyStatusDisabled {
+				t.Errorf("ModifyPolicy() written status = %s, want %s", written.Status, types.PolicyStatusDisabled)
+			}
+		})
+	}
+}
+
 func TestDeletePolicy(t *testing.T) {
 	var tests = []struct {
 		name     string
@@ -574,3 +931,252 @@ func TestDeletePolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchPolicies(t *testing.T) {
+	var tests = []struct {
+		name      string
+		list      string
+		policy    string
+		header    http.ConnState
+		wantCount int
+		wantDpa   bool
+		wantErr   bool
+	}{
+		{
+			name:    "Invalid List Unauthorized",
+			header:  http.StatusUnauthorized,
+			list:    `{"code": "UNAUTHORIZED", "message": "Unauthorized"}`,
+			wantDpa: true,
+		},
+		{
+			name:    "Invalid Too Many Requests",
+			header:  http.StatusTooManyRequests,
+			wantErr: true,
+		},
+		{
+			name:   "Valid Response",
+			header: http.StatusOK,
+			list: `{
+				"items": [
+					{"policyId": "c12f982a-ab1a-12ab-1a31-f221aa31836a", "policyName": "Example Policy 1"},
+					{"policyId": "c12f982a-ab1a-12ab-1a31-f221aa31836b", "policyName": "Example Policy 2"}
+				],
+				"totalCount": 2
+			}`,
+			policy:    `{"policyName": "Example Policy", "status": "Enabled"}`,
+			wantCount: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(int(tt.header))
+				if r.URL.Path == "/api/access-policies" {
+					w.Write([]byte(tt.list))
+					return
+				}
+				w.Write([]byte(strings.Replace(tt.policy, `"policyName"`, `"policyId": "`+path.Base(r.URL.Path)+`", "policyName"`, 1)))
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			got, dpaerr, err := ns.FetchPolicies(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FetchPolicies() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if dpaerr.Empty() == tt.wantDpa {
+				t.Errorf("FetchPolicies() dpaerr = %v, wantDpa %v", dpaerr, tt.wantDpa)
+			}
+			if len(got) != tt.wantCount {
+				t.Fatalf("FetchPolicies() policies = %d, want %d", len(got), tt.wantCount)
+			}
+			if tt.wantCount > 1 && got[0].PolicyID == got[1].PolicyID {
+				t.Errorf("FetchPolicies() returned duplicate policies %s", got[0].PolicyID)
+			}
+		})
+	}
+}
+
+func TestPolicyRoundTrip(t *testing.T) {
+	var p types.Policy
+	if err := json.Unmarshal([]byte(capturedPolicyResponse), &p); err != nil {
+		t.Fatalf("failed to decode policy: %s", err)
+	}
+	if p.ProvidersData.OnPrem == nil || p.ProvidersData.Aws != nil || p.ProvidersData.Azure != nil || p.ProvidersData.Gcp != nil {
+		t.Errorf("providers decoded as %+v", p.ProvidersData)
+	}
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failed to encode policy: %s", err)
+	}
+
+	// Empty fields are omitted, every other field is sent back under the
+	// key of the response
+	var got, want interface{}
+	json.Unmarshal(encoded, &got)
+	json.Unmarshal([]byte(capturedPolicyResponse), &want)
+	if !reflect.DeepEqual(got, withoutEmptyJSON(want)) {
+		t.Errorf("policy round trip mismatch\ngot  %s\nwant %s", encoded, capturedPolicyResponse)
+	}
+
+	// Groups are sent under the key of the response
+	userData := p.UserAccessRules[0].UserData
+	userData.Groups = []types.Groups{{Name: "Operators", Source: "AD"}}
+	encoded, _ = json.Marshal(userData)
+	var keys map[string]interface{}
+	json.Unmarshal(encoded, &keys)
+	captured := want.(map[string]interface{})["userAccessRules"].([]interface{})[0].(map[string]interface{})["userData"].(map[string]interface{})
+	for k := range keys {
+		if _, ok := captured[k]; !ok {
+			t.Errorf("userData key %q is not in the response", k)
+		}
+	}
+}
+
+// Returns a generic JSON value without nulls, zero values and empty arrays
+// and objects, which omitempty fields do not encode
+func withoutEmptyJSON(v interface{}) interface{} {
+	switch d := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, e := range d {
+			if e = withoutEmptyJSON(e); e != nil {
+				out[k] = e
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case []interface{}:
+		if len(d) == 0 {
+			return nil
+		}
+		out := make([]interface{}, len(d))
+		for i, e := range d {
+			out[i] = withoutEmptyJSON(e)
+		}
+		return out
+	case string, bool, float64:
+		if reflect.ValueOf(d).IsZero() {
+			return nil
+		}
+	}
+	return v
+}
+
+func TestConnectAsRoundTrip(t *testing.T) {
+	response := `{
+		"AWS": {"ssh": "ec2-user", "rdp": {"localEphemeralUser": {"assignGroups": ["Remote Desktop Users"]}}},
+		"Azure": {"ssh": "azureuser", "rdp": {"domainEphemeralUser": {"assignGroups": ["Administrators"], "assignDomainGroups": ["Operators"], "enableEphemeralUserReconnect": true}}},
+		"GCP": {"ssh": "gcp-user", "rdp": {"user": "svc-rdp"}},
+		"OnPrem": {"ssh": "admin", "rdp": {"domainEphemeralUser": {"assignDomainGroups": ["Operators"], "enableEphemeralUserReconnect": false}}}
+	}`
+
+	var ca types.ConnectAs
+	if err := json.Unmarshal([]byte(response), &ca); err != nil {
+		t.Fatalf("failed to decode connect as: %s", err)
+	}
+	if ca.OnPrem.Rdp.DomainEphemeralUser.EnableEphemeralUserReconnect == nil {
+		t.Errorf("explicit false reconnect decoded as nil")
+	}
+	encoded, err := json.Marshal(ca)
+	if err != nil {
+		t.Fatalf("failed to encode connect as: %s", err)
+	}
+
+	var got, want interface{}
+	json.Unmarshal(encoded, &got)
+	json.Unmarshal([]byte(response), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("connect as round trip mismatch\ngot  %s\nwant %s", encoded, response)
+	}
+}
+
+func TestAddPolicy_RequestBody(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"policyId":"c12f982a-ab1a-12ab-1a31-f221aa31836a"}`))
+	}))
+	defer ts.Close()
+
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+	if _, _, err := ns.AddPolicy(context.Background(), validSamplePolicy); err != nil {
+		t.Fatalf("AddPolicy() error = %v", err)
+	}
+
+	providers, _ := body["providersData"].(map[string]interface{})
+	if _, ok := providers["AWS"]; !ok {
+		t.Errorf("AddPolicy() request missing AWS provider: %v", body)
+	}
+	for _, p := range []string{"Azure", "OnPrem", "GCP"} {
+		if _, ok := providers[p]; ok {
+			t.Errorf("AddPolicy() request sent unset provider %s: %v", p, body)
+		}
+	}
+}
+
+func TestPolicyEnumValidation(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:  "Valid Values",
+			input: `{"status":"Enabled","userAccessRules":[{"connectionInformation":{"daysOfWeek":["Mon","Sun"]}}]}`,
+		},
+		{
+			name:    "Unknown Status",
+			input:   `{"status":"Enabeld"}`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown Day",
+			input:   `{"userAccessRules":[{"connectionInformation":{"daysOfWeek":["Monday"]}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown Platform",
+			input:   `{"items":[{"platforms":["Oracle"]}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if strings.Contains(tt.input, "items") {
+				err = json.Unmarshal([]byte(tt.input), &types.ListPolicies{})
+			} else {
+				err = json.Unmarshal([]byte(tt.input), &types.Policy{})
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Unknown values are also rejected when encoding a request
+	if _, err := json.Marshal(types.Policy{Status: "enabled"}); err == nil {
+		t.Errorf("Marshal() expected error for unknown status")
+	}
+	if !types.PolicyStatusDraft.Valid() || types.PolicyStatus("Active").Valid() {
+		t.Errorf("PolicyStatus.Valid() returned unexpected result")
+	}
+}
@@ -0,0 +1,217 @@
+package dpa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// ReadPolicies reads exported policies formatted as JSON. The document may
+// contain a single policy, an array of policies or a ListPolicies style
+// object with an items array of full policies.
+//
+// Example:
+//
+//	policies, err := dpa.ReadPolicies(os.Stdin)
+//	if err != nil {
+//		log.Fatalf("Failed to read policies. %s", err)
+//		return
+//	}
+func ReadPolicies(r io.Reader) ([]types.Policy, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("readPolicies: Failed to read policies. %s", err)
+	}
+
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	switch b[0] {
+	case '[':
+		var policies []types.Policy
+		if err := json.Unmarshal(b, &policies); err != nil {
+			return nil, fmt.Errorf("readPolicies: Failed to parse policies. %s", err)
+		}
+		return policies, nil
+	case '{':
+		var list struct {
+			Items []types.Policy `json:"items"`
+		}
+		if err := json.Unmarshal(b, &list); err == nil && list.Items != nil {
+			return list.Items, nil
+		}
+
+		var p types.Policy
+		if err := json.Unmarshal(b, &p); err != nil {
+			return nil, fmt.Errorf("readPolicies: Failed to parse policy. %s", err)
+		}
+		return []types.Policy{p}, nil
+	}
+	return nil, fmt.Errorf("readPolicies: Invalid document. Expected a JSON object or array")
+}
+
+// LoadPolicyFile reads exported policies from a JSON file.
+// See ReadPolicies for the supported formats.
+//
+// Example:
+//
+//	policies, err := dpa.LoadPolicyFile("policies.json")
+//	if err != nil {
+//		log.Fatalf("Failed to load policies. %s", err)
+//		return
+//	}
+func LoadPolicyFile(name string) ([]types.Policy, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadPolicyFile: Failed to open policy file. %s", err)
+	}
+	defer f.Close()
+
+	policies, err := ReadPolicies(f)
+	if err != nil {
+		return nil, fmt.Errorf("loadPolicyFile: %s: %s", name, err)
+	}
+	return policies, nil
+}
+
+// ValidatePolicy checks a policy is complete before it is sent to the API.
+// The policy must have a name, at least one provider and at least one rule.
+// Each rule needs a unique name, a user, group or role, a connect as user
+// and a valid schedule, and the policy dates must be valid and ordered.
+// All problems found are returned joined in a single error.
+//
+// Example:
+//
+//	if err := dpa.ValidatePolicy(policy); err != nil {
+//		log.Fatalf("Invalid policy. %s", err)
+//		return
+//	}
+func ValidatePolicy(p types.Policy) error {
+	var errs validationErrors
+	errs.policy(p.PolicyName, p.Status, p.StartDate, p.EndDate)
+	if p.ProvidersData == (types.ProvidersData{}) {
+		errs.add("providersData must include at least one provider")
+	}
+
+	if len(p.UserAccessRules) == 0 {
+		errs.add("userAccessRules must include at least one rule")
+	}
+	names := map[string]bool{}
+	for i, r := range p.UserAccessRules {
+		path := fmt.Sprintf("userAccessRules[%d]", i)
+		errs.rule(path, r.RuleName, r.UserData, names)
+
+		ci := r.ConnectionInformation
+		if ci.ConnectAs == (types.ConnectAs{}) {
+			errs.add("%s.connectionInformation.connectAs must include at least one provider", path)
+		}
+		errs.rdp(path+".connectionInformation.connectAs", ci.ConnectAs)
+		errs.schedule(path+".connectionInformation", ci.GrantAccess, ci.TimeZone, ci.FullDays, ci.HoursFrom, ci.HoursTo)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Collects the problems found while validating a policy
+type validationErrors []error
+
+func (v *validationErrors) add(format string, a ...interface{}) {
+	*v = append(*v, fmt.Errorf(format, a...))
+}
+
+// Checks the fields shared by every kind of policy
+func (v *validationErrors) policy(name string, status types.PolicyStatus, startDate, endDate string) {
+	if len(strings.TrimSpace(name)) == 0 {
+		v.add("policyName cannot be empty")
+	}
+	if len(status) != 0 && !status.Valid() {
+		v.add("status %q is not valid", status)
+	}
+
+	var start, end time.Time
+	var err error
+	if len(startDate) != 0 {
+		if start, err = parsePolicyDate(startDate, time.UTC); err != nil {
+			v.add("startDate: %s", err)
+		}
+	}
+	if len(endDate) != 0 {
+		if end, err = parsePolicyDate(endDate, time.UTC); err != nil {
+			v.add("endDate: %s", err)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		v.add("endDate %s is before startDate %s", endDate, startDate)
+	}
+}
+
+// Checks a rule has a unique name and at least one user, group or role
+func (v *validationErrors) rule(path, ruleName string, ud types.UserData, names map[string]bool) {
+	if len(strings.TrimSpace(ruleName)) == 0 {
+		v.add("%s.ruleName cannot be empty", path)
+	} else if names[strings.ToLower(ruleName)] {
+		v.add("%s.ruleName %q is used by more than one rule", path, ruleName)
+	}
+	names[strings.ToLower(ruleName)] = true
+
+	if len(ud.Users) == 0 && len(ud.Groups) == 0 && len(ud.Roles) == 0 {
+		v.add("%s.userData must include a user, group or role", path)
+	}
+}
+
+// Checks each RDP connect as block sets exactly one account
+func (v *validationErrors) rdp(path string, ca types.ConnectAs) {
+	for _, c := range []struct {
+		provider types.Provider
+		rdp      *types.Rdp
+	}{
+		{types.ProviderAWS, deref(ca.Aws).Rdp},
+		{types.ProviderAzure, deref(ca.Azure).Rdp},
+		{types.ProviderGCP, deref(ca.Gcp).Rdp},
+		{types.ProviderOnPrem, deref(ca.OnPrem).Rdp},
+	} {
+		if c.rdp == nil {
+			continue
+		}
+		set := 0
+		if c.rdp.LocalEphemeralUser != nil {
+			set++
+		}
+		if c.rdp.DomainEphemeralUser != nil {
+			set++
+		}
+		if len(c.rdp.User) != 0 {
+			set++
+		}
+		if set != 1 {
+			v.add("%s.%s.rdp must set one of localEphemeralUser, domainEphemeralUser or user", path, c.provider)
+		}
+	}
+}
+
+// Checks the access window of a rule's connection information. A
+// grantAccess of 0 is omitted from the request and the API default applies.
+func (v *validationErrors) schedule(path string, grantAccess int, timeZone string, fullDays bool, hoursFrom, hoursTo string) {
+	if grantAccess < 0 || grantAccess > 24 {
+		v.add("%s.grantAccess must be between 1 and 24 hours, or 0 for the default", path)
+	}
+	if _, err := loadTimeZone(timeZone); err != nil {
+		v.add("%s.timeZone: %s", path, err)
+	}
+	if !fullDays && (len(hoursFrom) != 0 || len(hoursTo) != 0) {
+		for _, h := range []string{hoursFrom, hoursTo} {
+			if _, err := parseClock(h); err != nil {
+				v.add("%s: %s", path, err)
+			}
+		}
+	}
+}
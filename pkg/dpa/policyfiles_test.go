@@ -0,0 +1,168 @@
+package dpa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestReadPolicies(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{
+			name:  "Single Policy",
+			input: `{"policyId": "c12f982a-ab1a-12ab-1a31-f221aa31836a", "policyName": "Example Policy"}`,
+			want:  1,
+		},
+		{
+			name:  "Array Of Policies",
+			input: `[{"policyName": "Example Policy 1"}, {"policyName": "Example Policy 2"}]`,
+			want:  2,
+		},
+		{
+			name:  "Items Of Policies",
+			input: `{"items": [{"policyName": "Example Policy 1"}], "totalCount": 1}`,
+			want:  1,
+		},
+		{
+			name:  "Empty Document",
+			input: ``,
+			want:  0,
+		},
+		{
+			name:    "Invalid Document",
+			input:   `policyName: Example Policy`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadPolicies(strings.NewReader(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ReadPolicies() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("ReadPolicies() policies = %d, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	valid := func() types.Policy {
+		p := validPolicy()
+		p.StartDate, p.EndDate = "2024-01-01", "2024-12-31"
+		ci := &p.UserAccessRules[0].ConnectionInformation
+		ci.FullDays, ci.HoursFrom, ci.HoursTo, ci.TimeZone = false, "08:00", "17:00", "Europe/Berlin"
+		return p
+	}
+
+	var tests = []struct {
+		name    string
+		edit    func(*types.Policy)
+		wantErr bool
+	}{
+		{
+			name: "Valid Policy",
+			edit: func(p *types.Policy) {},
+		},
+		{
+			name:    "Missing Name",
+			edit:    func(p *types.Policy) { p.PolicyName = " " },
+			wantErr: true,
+		},
+		{
+			name:    "Missing Provider",
+			edit:    func(p *types.Policy) { p.ProvidersData = types.ProvidersData{} },
+			wantErr: true,
+		},
+		{
+			name:    "Dates Out Of Order",
+			edit:    func(p *types.Policy) { p.EndDate = "2023-12-31" },
+			wantErr: true,
+		},
+		{
+			name: "Duplicate Rule Name",
+			edit: func(p *types.Policy) {
+				r := p.UserAccessRules[0]
+				r.RuleName = "ops"
+				p.UserAccessRules = append(p.UserAccessRules, r)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Missing Principal",
+			edit:    func(p *types.Policy) { p.UserAccessRules[0].UserData = types.UserData{} },
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Hours",
+			edit:    func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.HoursTo = "25:00" },
+			wantErr: true,
+		},
+		{
+			name: "Domain Ephemeral RDP User",
+			edit: func(p *types.Policy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Aws.Rdp = &types.Rdp{
+					DomainEphemeralUser: &types.DomainEphemeralUser{AssignDomainGroups: []string{"Operators"}},
+				}
+			},
+		},
+		{
+			name:    "RDP Without User",
+			edit:    func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.ConnectAs.Aws.Rdp = &types.Rdp{} },
+			wantErr: true,
+		},
+		{
+			name: "RDP With Two Users",
+			edit: func(p *types.Policy) {
+				p.UserAccessRules[0].ConnectionInformation.ConnectAs.Aws.Rdp = &types.Rdp{
+					LocalEphemeralUser: &types.LocalEphemeralUser{},
+					User:               "Administrator",
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "Default Grant Access",
+			edit: func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.GrantAccess = 0 },
+		},
+		{
+			name:    "Grant Access Too Long",
+			edit:    func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.GrantAccess = 25 },
+			wantErr: true,
+		},
+		{
+			name:    "Negative Grant Access",
+			edit:    func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.GrantAccess = -1 },
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Time Zone",
+			edit:    func(p *types.Policy) { p.UserAccessRules[0].ConnectionInformation.TimeZone = "Mars/Olympus" },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.edit(&p)
+			if err := ValidatePolicy(p); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
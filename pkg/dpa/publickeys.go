@@ -9,12 +9,6 @@ import (
 	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
 )
 
-// Local variables for the package
-var (
-	publicKey       string
-	publicKeyScript types.PublicKeyScript
-)
-
 // GetPublicKey returns the public key for the DPA Workspace
 // Expects an ordered map of the query parameters
 // Returns a PublicKey, DPA Error Response, or generic error if failed.
@@ -54,6 +48,8 @@ func (s *Service) GetPublicKey(ctx context.Context, query interface{}) (*types.P
 
 	// Create URL and make request via service client
 	path := fmt.Sprintf("/public-keys?%s", q.Encode())
+	var publicKey string
+	var errorResponse types.ErrorResponse
 	if err := s.client.Get(ctx, path, &publicKey, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("getPublicKey: Failed to retrieve public key. %s", err)
@@ -102,6 +98,8 @@ func (s *Service) GetPublicKeyScript(ctx context.Context, query interface{}) (*t
 
 	// Create path and make request via service client
 	path := fmt.Sprintf("/public-keys/scripts?%s", q.Encode())
+	var publicKeyScript types.PublicKeyScript
+	var errorResponse types.ErrorResponse
 	if err := s.client.Get(ctx, path, &publicKeyScript, &errorResponse); err != nil {
 		defer cancelCtx()
 		return nil, nil, fmt.Errorf("getPublicKeyScript: Failed to retrieve public key installation script. %s", err)
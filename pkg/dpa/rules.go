@@ -0,0 +1,486 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// PrincipalKind identifies the UserData list a principal belongs to
+type PrincipalKind string
+
+const (
+	PrincipalUser  PrincipalKind = "user"
+	PrincipalGroup PrincipalKind = "group"
+	PrincipalRole  PrincipalKind = "role"
+)
+
+// Principal is a user, group or role assigned to a policy rule. Names are
+// matched case-insensitively. When removing, an empty Source matches any
+// source.
+type Principal struct {
+	Kind   PrincipalKind `json:"kind"`
+	Name   string        `json:"name"`
+	Source string        `json:"source,omitempty"`
+}
+
+// RuleSchedule is the part of a rule's connection information which
+// controls when access is granted
+type RuleSchedule struct {
+	DaysOfWeek []types.DayOfWeek `json:"daysOfWeek,omitempty"`
+	FullDays   bool              `json:"fullDays,omitempty"`
+	HoursFrom  string            `json:"hoursFrom,omitempty"`
+	HoursTo    string            `json:"hoursTo,omitempty"`
+	TimeZone   string            `json:"timeZone,omitempty"`
+}
+
+// ChangeAction describes how a rule or one of its fields changed
+type ChangeAction string
+
+const (
+	ChangeAdded   ChangeAction = "added"
+	ChangeRemoved ChangeAction = "removed"
+	ChangeUpdated ChangeAction = "updated"
+)
+
+// RuleChange records a single change made to a policy rule. Field is
+// "rule" when the whole rule was added, removed or renamed, otherwise the
+// name of the changed field (users, groups, roles, connectAs or schedule).
+type RuleChange struct {
+	RuleName string       `json:"ruleName"`
+	Field    string       `json:"field"`
+	Action   ChangeAction `json:"action"`
+	Before   string       `json:"before,omitempty"`
+	After    string       `json:"after,omitempty"`
+}
+
+// RuleUpdate is the result of a rule level operation
+type RuleUpdate struct {
+	Policy  *types.Policy
+	Changes []RuleChange
+}
+
+// Returned by a rule edit which leaves the policy unchanged, so that no
+// update is sent
+var errNoRuleChanges = errors.New("no rule changes")
+
+// AddRule appends a new rule to a policy. The rule name must not already
+// be used by the policy.
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure.
+//
+// Example:
+//
+//	rule := types.UserAccessRules{
+//		RuleName: "Operators",
+//		UserData: types.UserData{Groups: []types.Groups{{Name: "Operators", Source: "AD"}}},
+//		ConnectionInformation: types.ConnectionInformation{
+//			ConnectAs: types.ConnectAs{Aws: &types.ConnectAsAws{SSH: "ec2-user"}},
+//			FullDays:  true,
+//		},
+//	}
+//	update, dpaerr, err := s.AddRule(context.Background(), policyID, rule)
+//	if err != nil {
+//		log.Fatalf("Failed to add rule. %s", err)
+//		return
+//	}
+func (s *Service) AddRule(ctx context.Context, policyID string, rule types.UserAccessRules) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "addRule", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return addRule(p, rule)
+	})
+}
+
+// RemoveRule removes a named rule from a policy
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure, when the rule does not exist or when it is
+// the only rule of the policy.
+//
+// Example:
+//
+//	update, dpaerr, err := s.RemoveRule(context.Background(), policyID, "Operators")
+//	if err != nil {
+//		log.Fatalf("Failed to remove rule. %s", err)
+//		return
+//	}
+func (s *Service) RemoveRule(ctx context.Context, policyID, ruleName string) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "removeRule", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return removeRule(p, ruleName)
+	})
+}
+
+// RenameRule renames a rule of a policy. The new name must not already be
+// used by another rule of the policy.
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure.
+//
+// Example:
+//
+//	update, dpaerr, err := s.RenameRule(context.Background(), policyID, "Operators", "Night Operators")
+//	if err != nil {
+//		log.Fatalf("Failed to rename rule. %s", err)
+//		return
+//	}
+func (s *Service) RenameRule(ctx context.Context, policyID, ruleName, newName string) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "renameRule", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return renameRule(p, ruleName, newName)
+	})
+}
+
+// AddPrincipal assigns a user, group or role to a rule of a policy. An
+// empty rule name assigns the principal to every rule. Rules which already
+// include the principal are left unchanged.
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure.
+//
+// Example:
+//
+//	group := dpa.Principal{Kind: dpa.PrincipalGroup, Name: "Operators", Source: "AD"}
+//	update, dpaerr, err := s.AddPrincipal(context.Background(), policyID, "Night Shift", group)
+//	if err != nil {
+//		log.Fatalf("Failed to add group. %s", err)
+//		return
+//	}
+func (s *Service) AddPrincipal(ctx context.Context, policyID, ruleName string, principal Principal) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "addPrincipal", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return addPrincipal(p, ruleName, principal)
+	})
+}
+
+// RemovePrincipal removes a user, group or role from a rule of a policy.
+// An empty rule name removes the principal from every rule.
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure or when a rule would be left without users,
+// groups and roles.
+//
+// Example:
+//
+//	// Remove a user from every rule
+//	user := dpa.Principal{Kind: dpa.PrincipalUser, Name: "alice@example.com"}
+//	update, dpaerr, err := s.RemovePrincipal(context.Background(), policyID, "", user)
+//	if err != nil {
+//		log.Fatalf("Failed to remove user. %s", err)
+//		return
+//	}
+func (s *Service) RemovePrincipal(ctx context.Context, policyID, ruleName string, principal Principal) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "removePrincipal", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return removePrincipal(p, ruleName, principal)
+	})
+}
+
+// SetRuleConnectAs replaces the connect as users of a rule of a policy
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure.
+//
+// Example:
+//
+//	connectAs := types.ConnectAs{Aws: &types.ConnectAsAws{SSH: "ubuntu"}}
+//	update, dpaerr, err := s.SetRuleConnectAs(context.Background(), policyID, "DevOps SSH", connectAs)
+//	if err != nil {
+//		log.Fatalf("Failed to update connect as. %s", err)
+//		return
+//	}
+func (s *Service) SetRuleConnectAs(ctx context.Context, policyID, ruleName string, connectAs types.ConnectAs) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "setRuleConnectAs", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return setRuleConnectAs(p, ruleName, connectAs)
+	})
+}
+
+// SetRuleSchedule replaces the days, hours and time zone of a rule of a
+// policy. Hours must use the "15:04" format and the time zone must be an
+// IANA name.
+// Returns a RuleUpdate with the updated policy and the changes made or
+// types.ErrorResponse based on the response from the API. An error is
+// returned on request failure.
+//
+// Example:
+//
+//	schedule := dpa.RuleSchedule{
+//		DaysOfWeek: []types.DayOfWeek{types.Monday, types.Friday},
+//		HoursFrom:  "08:00",
+//		HoursTo:    "18:00",
+//		TimeZone:   "America/New_York",
+//	}
+//	update, dpaerr, err := s.SetRuleSchedule(context.Background(), policyID, "DevOps SSH", schedule)
+//	if err != nil {
+//		log.Fatalf("Failed to update schedule. %s", err)
+//		return
+//	}
+func (s *Service) SetRuleSchedule(ctx context.Context, policyID, ruleName string, schedule RuleSchedule) (*RuleUpdate, *types.ErrorResponse, error) {
+	return s.modifyRules(ctx, "setRuleSchedule", policyID, func(p *types.Policy) ([]RuleChange, error) {
+		return setRuleSchedule(p, ruleName, schedule)
+	})
+}
+
+// Applies a rule edit with ModifyPolicy. Edits which change nothing return
+// the current policy without sending an update.
+func (s *Service) modifyRules(ctx context.Context, op, policyID string, edit func(*types.Policy) ([]RuleChange, error)) (*RuleUpdate, *types.ErrorResponse, error) {
+	var changes []RuleChange
+	var current types.Policy
+	policy, dpaerr, err := s.ModifyPolicy(ctx, policyID, func(p *types.Policy) error {
+		var err error
+		changes, err = edit(p)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			current = *p
+			return errNoRuleChanges
+		}
+		return nil
+	})
+	if errors.Is(err, errNoRuleChanges) {
+		return &RuleUpdate{Policy: &current}, &types.ErrorResponse{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: Failed to update policy rules. %w", op, err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	return &RuleUpdate{Policy: policy, Changes: changes}, dpaerr, nil
+}
+
+// Returns the index of the named rule or -1
+func findRule(p *types.Policy, name string) int {
+	for i, r := range p.UserAccessRules {
+		if strings.EqualFold(r.RuleName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the indexes of the named rule, or of every rule when name is
+// empty
+func selectRules(p *types.Policy, name string) ([]int, error) {
+	if len(name) == 0 {
+		indexes := make([]int, len(p.UserAccessRules))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+	i := findRule(p, name)
+	if i < 0 {
+		return nil, fmt.Errorf("Rule %q not found in policy %q", name, p.PolicyName)
+	}
+	return []int{i}, nil
+}
+
+func addRule(p *types.Policy, rule types.UserAccessRules) ([]RuleChange, error) {
+	if len(rule.RuleName) == 0 {
+		return nil, fmt.Errorf("Rule name cannot be empty")
+	}
+	if findRule(p, rule.RuleName) >= 0 {
+		return nil, fmt.Errorf("Rule %q already exists in policy %q", rule.RuleName, p.PolicyName)
+	}
+	p.UserAccessRules = append(p.UserAccessRules, rule)
+	return []RuleChange{{RuleName: rule.RuleName, Field: "rule", Action: ChangeAdded}}, nil
+}
+
+func removeRule(p *types.Policy, name string) ([]RuleChange, error) {
+	i := findRule(p, name)
+	if i < 0 {
+		return nil, fmt.Errorf("Rule %q not found in policy %q", name, p.PolicyName)
+	}
+	removed := p.UserAccessRules[i].RuleName
+	if len(p.UserAccessRules) == 1 {
+		return nil, fmt.Errorf("Rule %q is the only rule of policy %q, delete the policy instead", removed, p.PolicyName)
+	}
+	p.UserAccessRules = append(p.UserAccessRules[:i:i], p.UserAccessRules[i+1:]...)
+	return []RuleChange{{RuleName: removed, Field: "rule", Action: ChangeRemoved}}, nil
+}
+
+func renameRule(p *types.Policy, name, newName string) ([]RuleChange, error) {
+	if len(newName) == 0 {
+		return nil, fmt.Errorf("Rule name cannot be empty")
+	}
+	i := findRule(p, name)
+	if i < 0 {
+		return nil, fmt.Errorf("Rule %q not found in policy %q", name, p.PolicyName)
+	}
+	old := p.UserAccessRules[i].RuleName
+	if old == newName {
+		return nil, nil
+	}
+	if j := findRule(p, newName); j >= 0 && j != i {
+		return nil, fmt.Errorf("Rule %q already exists in policy %q", newName, p.PolicyName)
+	}
+	p.UserAccessRules[i].RuleName = newName
+	return []RuleChange{{RuleName: newName, Field: "rule", Action: ChangeUpdated, Before: old, After: newName}}, nil
+}
+
+func addPrincipal(p *types.Policy, ruleName string, principal Principal) ([]RuleChange, error) {
+	if err := validatePrincipal(principal); err != nil {
+		return nil, err
+	}
+	indexes, err := selectRules(p, ruleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RuleChange
+	for _, i := range indexes {
+		ud := &p.UserAccessRules[i].UserData
+		var added bool
+		switch principal.Kind {
+		case PrincipalUser:
+			if !hasPrincipal(ud.Users, principal, func(u types.Users) (string, string) { return u.Name, u.Source }) {
+				ud.Users = append(ud.Users, types.Users{Name: principal.Name, Source: principal.Source})
+				added = true
+			}
+		case PrincipalGroup:
+			if !hasPrincipal(ud.Groups, principal, func(g types.Groups) (string, string) { return g.Name, g.Source }) {
+				ud.Groups = append(ud.Groups, types.Groups{Name: principal.Name, Source: principal.Source})
+				added = true
+			}
+		case PrincipalRole:
+			if !hasPrincipal(ud.Roles, principal, func(r types.Roles) (string, string) { return r.Name, r.Source }) {
+				ud.Roles = append(ud.Roles, types.Roles{Name: principal.Name, Source: principal.Source})
+				added = true
+			}
+		}
+		if added {
+			changes = append(changes, RuleChange{
+				RuleName: p.UserAccessRules[i].RuleName,
+				Field:    string(principal.Kind) + "s",
+				Action:   ChangeAdded,
+				After:    principal.Name,
+			})
+		}
+	}
+	return changes, nil
+}
+
+func removePrincipal(p *types.Policy, ruleName string, principal Principal) ([]RuleChange, error) {
+	if err := validatePrincipal(principal); err != nil {
+		return nil, err
+	}
+	indexes, err := selectRules(p, ruleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RuleChange
+	for _, i := range indexes {
+		ud := &p.UserAccessRules[i].UserData
+		var removed int
+		switch principal.Kind {
+		case PrincipalUser:
+			ud.Users, removed = removePrincipals(ud.Users, principal, func(u types.Users) (string, string) { return u.Name, u.Source })
+		case PrincipalGroup:
+			ud.Groups, removed = removePrincipals(ud.Groups, principal, func(g types.Groups) (string, string) { return g.Name, g.Source })
+		case PrincipalRole:
+			ud.Roles, removed = removePrincipals(ud.Roles, principal, func(r types.Roles) (string, string) { return r.Name, r.Source })
+		}
+		if removed != 0 && len(ud.Users) == 0 && len(ud.Groups) == 0 && len(ud.Roles) == 0 {
+			return nil, fmt.Errorf("Removing %s %q would leave rule %q without users, groups or roles", principal.Kind, principal.Name, p.UserAccessRules[i].RuleName)
+		}
+		if removed != 0 {
+			changes = append(changes, RuleChange{
+				RuleName: p.UserAccessRules[i].RuleName,
+				Field:    string(principal.Kind) + "s",
+				Action:   ChangeRemoved,
+				Before:   principal.Name,
+			})
+		}
+	}
+	return changes, nil
+}
+
+func setRuleConnectAs(p *types.Policy, ruleName string, connectAs types.ConnectAs) ([]RuleChange, error) {
+	i := findRule(p, ruleName)
+	if i < 0 {
+		return nil, fmt.Errorf("Rule %q not found in policy %q", ruleName, p.PolicyName)
+	}
+	ci := &p.UserAccessRules[i].ConnectionInformation
+	before, after := describeConnectAs(ci.ConnectAs), describeConnectAs(connectAs)
+	if before == after {
+		return nil, nil
+	}
+	ci.ConnectAs = connectAs
+	return []RuleChange{{RuleName: p.UserAccessRules[i].RuleName, Field: "connectAs", Action: ChangeUpdated, Before: before, After: after}}, nil
+}
+
+func setRuleSchedule(p *types.Policy, ruleName string, schedule RuleSchedule) ([]RuleChange, error) {
+	if _, err := loadTimeZone(schedule.TimeZone); err != nil {
+		return nil, err
+	}
+	if !schedule.FullDays {
+		for _, h := range []string{schedule.HoursFrom, schedule.HoursTo} {
+			if _, err := parseClock(h); err != nil {
+				return nil, err
+			}
+		}
+	}
+	i := findRule(p, ruleName)
+	if i < 0 {
+		return nil, fmt.Errorf("Rule %q not found in policy %q", ruleName, p.PolicyName)
+	}
+
+	ci := &p.UserAccessRules[i].ConnectionInformation
+	before := describeSchedule(*ci)
+	ci.DaysOfWeek = schedule.DaysOfWeek
+	ci.FullDays = schedule.FullDays
+	ci.HoursFrom, ci.HoursTo = schedule.HoursFrom, schedule.HoursTo
+	if schedule.FullDays {
+		ci.HoursFrom, ci.HoursTo = "", ""
+	}
+	ci.TimeZone = schedule.TimeZone
+	after := describeSchedule(*ci)
+	if before == after {
+		return nil, nil
+	}
+	return []RuleChange{{RuleName: p.UserAccessRules[i].RuleName, Field: "schedule", Action: ChangeUpdated, Before: before, After: after}}, nil
+}
+
+func validatePrincipal(principal Principal) error {
+	if len(principal.Name) == 0 {
+		return fmt.Errorf("Principal name cannot be empty")
+	}
+	switch principal.Kind {
+	case PrincipalUser, PrincipalGroup, PrincipalRole:
+		return nil
+	}
+	return fmt.Errorf("Invalid principal kind %q. Valid options are %s, %s, %s", principal.Kind, PrincipalUser, PrincipalGroup, PrincipalRole)
+}
+
+// Reports whether a principal with the same name and source is assigned
+func hasPrincipal[T any](s []T, principal Principal, key func(T) (string, string)) bool {
+	for _, e := range s {
+		name, source := key(e)
+		if strings.EqualFold(name, principal.Name) && strings.EqualFold(source, principal.Source) {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes matching principals, an empty source matches any source
+func removePrincipals[T any](s []T, principal Principal, key func(T) (string, string)) ([]T, int) {
+	var kept []T
+	for _, e := range s {
+		name, source := key(e)
+		if strings.EqualFold(name, principal.Name) && (len(principal.Source) == 0 || strings.EqualFold(source, principal.Source)) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, len(s) - len(kept)
+}
+
+// Returns a stable description of a rule's connect as users
+func describeConnectAs(ca types.ConnectAs) string {
+	b, _ := json.Marshal(ca)
+	return string(b)
+}
@@ -0,0 +1,265 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Builds a policy with two rules used by the rule operation tests
+func rulesPolicy() types.Policy {
+	p := validPolicy()
+	p.UserAccessRules[0].RuleName = "Admins"
+	p.UserAccessRules[0].UserData = types.UserData{
+		Users: []types.Users{{Name: "alice@example.com", Source: "IDENTITY"}},
+		Roles: []types.Roles{{Name: "DpaAdmin", Source: "IDENTITY"}},
+	}
+	p.UserAccessRules = append(p.UserAccessRules, types.UserAccessRules{
+		RuleName: "Operators",
+		UserData: types.UserData{
+			Users:  []types.Users{{Name: "Alice@example.com", Source: "IDENTITY"}},
+			Groups: []types.Groups{{Name: "Operators", Source: "AD"}},
+		},
+	})
+	return p
+}
+
+func TestRuleEdits(t *testing.T) {
+	var tests = []struct {
+		name        string
+		edit        func(p *types.Policy) ([]RuleChange, error)
+		wantChanges int
+		wantErr     bool
+		check       func(p types.Policy) bool
+	}{
+		{
+			name: "Add Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return addRule(p, types.UserAccessRules{RuleName: "Auditors"})
+			},
+			wantChanges: 1,
+			check:       func(p types.Policy) bool { return len(p.UserAccessRules) == 3 },
+		},
+		{
+			name: "Invalid Add Duplicate Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return addRule(p, types.UserAccessRules{RuleName: "admins"})
+			},
+			wantErr: true,
+		},
+		{
+			name: "Remove Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return removeRule(p, "Admins")
+			},
+			wantChanges: 1,
+			check: func(p types.Policy) bool {
+				return len(p.UserAccessRules) == 1 && p.UserAccessRules[0].RuleName == "Operators"
+			},
+		},
+		{
+			name: "Invalid Remove Missing Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return removeRule(p, "Auditors")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid Remove Last Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				removeRule(p, "Admins")
+				return removeRule(p, "Operators")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Rename Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return renameRule(p, "Operators", "Night Operators")
+			},
+			wantChanges: 1,
+			check:       func(p types.Policy) bool { return p.UserAccessRules[1].RuleName == "Night Operators" },
+		},
+		{
+			name: "Invalid Rename To Existing Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return renameRule(p, "Operators", "Admins")
+			},
+			wantErr: true,
+		},
+		{
+			name: "Add Group To Every Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return addPrincipal(p, "", Principal{Kind: PrincipalGroup, Name: "operators", Source: "AD"})
+			},
+			wantChanges: 1,
+			check:       func(p types.Policy) bool { return len(p.UserAccessRules[0].UserData.Groups) == 1 },
+		},
+		{
+			name: "Remove User From Every Rule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return removePrincipal(p, "", Principal{Kind: PrincipalUser, Name: "alice@example.com"})
+			},
+			wantChanges: 2,
+			check: func(p types.Policy) bool {
+				return len(p.UserAccessRules[0].UserData.Users) == 0 && len(p.UserAccessRules[1].UserData.Users) == 0
+			},
+		},
+		{
+			name: "Invalid Remove Last Principal",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				removePrincipal(p, "Admins", Principal{Kind: PrincipalRole, Name: "DpaAdmin", Source: "IDENTITY"})
+				return removePrincipal(p, "Admins", Principal{Kind: PrincipalUser, Name: "alice@example.com"})
+			},
+			wantErr: true,
+		},
+		{
+			name: "Remove Role With Other Source",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return removePrincipal(p, "Admins", Principal{Kind: PrincipalRole, Name: "DpaAdmin", Source: "AD"})
+			},
+			wantChanges: 0,
+		},
+		{
+			name: "Invalid Principal Kind",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return addPrincipal(p, "Admins", Principal{Kind: "team", Name: "Ops"})
+			},
+			wantErr: true,
+		},
+		{
+			name: "Set Connect As",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return setRuleConnectAs(p, "Admins", types.ConnectAs{Aws: &types.ConnectAsAws{SSH: "ubuntu"}})
+			},
+			wantChanges: 1,
+			check: func(p types.Policy) bool {
+				return p.UserAccessRules[0].ConnectionInformation.ConnectAs.Aws.SSH == "ubuntu"
+			},
+		},
+		{
+			name: "Set Schedule",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return setRuleSchedule(p, "Admins", RuleSchedule{
+					DaysOfWeek: []types.DayOfWeek{types.Monday},
+					HoursFrom:  "08:00",
+					HoursTo:    "18:00",
+					TimeZone:   "America/New_York",
+				})
+			},
+			wantChanges: 1,
+			check: func(p types.Policy) bool {
+				ci := p.UserAccessRules[0].ConnectionInformation
+				return !ci.FullDays && ci.HoursFrom == "08:00" && ci.TimeZone == "America/New_York"
+			},
+		},
+		{
+			name: "Invalid Schedule Hours",
+			edit: func(p *types.Policy) ([]RuleChange, error) {
+				return setRuleSchedule(p, "Admins", RuleSchedule{HoursFrom: "8am", HoursTo: "18:00"})
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := rulesPolicy()
+			changes, err := tt.edit(&p)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("edit error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("edit error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(changes) != tt.wantChanges {
+				t.Errorf("edit changes = %v, want %d", changes, tt.wantChanges)
+			}
+			if tt.check != nil && !tt.check(p) {
+				t.Errorf("edit produced unexpected policy %+v", p.UserAccessRules)
+			}
+		})
+	}
+}
+
+func TestAddPrincipal(t *testing.T) {
+	var tests = []struct {
+		name        string
+		principal   Principal
+		wantChanges int
+		wantPuts    int
+		conflict    bool
+	}{
+		{
+			name:        "Valid Added",
+			principal:   Principal{Kind: PrincipalGroup, Name: "Auditors", Source: "AD"},
+			wantChanges: 2,
+			wantPuts:    1,
+		},
+		{
+			name:      "Valid Already Assigned",
+			principal: Principal{Kind: PrincipalRole, Name: "DpaAdmin", Source: "IDENTITY"},
+			wantPuts:  0,
+		},
+		{
+			name:      "Invalid Conflict",
+			principal: Principal{Kind: PrincipalGroup, Name: "Auditors", Source: "AD"},
+			conflict:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var puts int
+			policy := rulesPolicy()
+			policy.UserAccessRules[1].UserData.Roles = []types.Roles{{Name: "DpaAdmin", Source: "IDENTITY"}}
+
+			// Mock Response
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.Method == http.MethodPut {
+					if tt.conflict {
+						w.WriteHeader(http.StatusConflict)
+						return
+					}
+					puts++
+					json.NewDecoder(r.Body).Decode(&policy)
+				}
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(policy)
+			}))
+			defer ts.Close()
+
+			// Valid Service using httptest New Server URL
+			ns, _ := NewService(ts.URL, "api", false, validToken)
+
+			got, dpaerr, err := ns.AddPrincipal(context.Background(), policy.PolicyID, "", tt.principal)
+			if tt.conflict {
+				if !errors.Is(err, ErrConflict) {
+					t.Errorf("AddPrincipal() error = %v, want wrapping ErrConflict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddPrincipal() error = %v", err)
+			}
+			if !dpaerr.Empty() {
+				t.Fatalf("AddPrincipal() dpaerr = %v", dpaerr)
+			}
+			if len(got.Changes) != tt.wantChanges || puts != tt.wantPuts {
+				t.Errorf("AddPrincipal() changes = %d puts = %d, want %d and %d", len(got.Changes), puts, tt.wantChanges, tt.wantPuts)
+			}
+			if got.Policy == nil || got.Policy.PolicyID != policy.PolicyID {
+				t.Errorf("AddPrincipal() policy = %v", got.Policy)
+			}
+		})
+	}
+}
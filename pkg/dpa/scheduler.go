@@ -0,0 +1,465 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Defaults of PolicySchedulerOptions
+const (
+	defaultSchedulerInterval = time.Minute
+	defaultSchedulerLookback = 35 * 24 * time.Hour
+)
+
+// PolicySchedule lists the policies a PolicyScheduler enables and disables
+type PolicySchedule struct {
+	Policies []ScheduledPolicy `json:"policies"`
+}
+
+// ScheduledPolicy is the activation schedule of one policy, identified by
+// PolicyID or PolicyName. The policy is either enabled by the Enable cron
+// expression and disabled by the Disable cron expression, evaluated in
+// TimeZone (UTC when empty), or enabled during each of the Intervals and
+// disabled between them. Intervals may not overlap.
+type ScheduledPolicy struct {
+	PolicyID   string             `json:"policyId,omitempty"`
+	PolicyName string             `json:"policyName,omitempty"`
+	Enable     string             `json:"enable,omitempty"`
+	Disable    string             `json:"disable,omitempty"`
+	TimeZone   string             `json:"timeZone,omitempty"`
+	Intervals  []ScheduleInterval `json:"intervals,omitempty"`
+}
+
+// ScheduleInterval is a period during which a policy is enabled. The policy
+// is disabled at End.
+type ScheduleInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ScheduledTransition is a status change of a scheduled policy. At is the
+// time the schedule changed the status and AppliedAt the time it was
+// applied, later than At when the scheduler was not running. Changed is
+// false when the policy already had the status. Err is set when the
+// transition failed, in which case it is retried on the next run.
+type ScheduledTransition struct {
+	PolicyID   string             `json:"policyId,omitempty"`
+	PolicyName string             `json:"policyName,omitempty"`
+	Status     types.PolicyStatus `json:"status"`
+	At         time.Time          `json:"at"`
+	AppliedAt  time.Time          `json:"appliedAt"`
+	Changed    bool               `json:"changed"`
+	Err        error              `json:"-"`
+}
+
+// PolicySchedulerOptions configures a PolicyScheduler.
+//
+//	StateFile - File recording the applied transitions. Without it the
+//	            state is only kept in memory
+//	Interval  - Time between runs of Run (default 1 minute)
+//	Lookback  - How far back the last transition of a cron schedule is
+//	            searched for when none has been applied (default 35 days)
+//	Clock     - Returns the current time (default time.Now)
+//	Notify    - Called by Run with every transition attempted
+type PolicySchedulerOptions struct {
+	StateFile string
+	Interval  time.Duration
+	Lookback  time.Duration
+	Clock     func() time.Time
+	Notify    func(ScheduledTransition)
+}
+
+// PolicyScheduler enables and disables policies following a PolicySchedule.
+// Each run determines the last transition of every policy that is due and
+// applies it when it has not been applied before, so transitions missed
+// while the scheduler was stopped are caught up on the next run and are
+// never applied twice. Only the latest transition of a policy is applied,
+// and a status changed by hand is left alone until the next transition.
+// It is safe for concurrent use.
+type PolicyScheduler struct {
+	service  *Service
+	policies []scheduledPolicy
+	opts     PolicySchedulerOptions
+
+	mu    sync.Mutex
+	state map[string]ScheduledTransition
+}
+
+type scheduledPolicy struct {
+	ScheduledPolicy
+	key      string
+	enable   *CronSchedule
+	disable  *CronSchedule
+	location *time.Location
+}
+
+// ReadPolicySchedule reads a policy schedule formatted as YAML or JSON.
+// Unknown fields are rejected.
+//
+//	policies:
+//	  - policyName: Change Window
+//	    enable: "0 22 * * FRI"
+//	    disable: "0 6 * * SAT"
+//	    timeZone: Europe/Berlin
+//	  - policyId: c12f982a-ab1a-12ab-1a31-f221aa31836b
+//	    intervals:
+//	      - start: 2024-05-01T22:00:00Z
+//	        end: 2024-05-02T04:00:00Z
+//
+// Example:
+//
+//	schedule, err := dpa.ReadPolicySchedule(os.Stdin)
+//	if err != nil {
+//		log.Fatalf("Failed to read schedule. %s", err)
+//		return
+//	}
+func ReadPolicySchedule(r io.Reader) (*PolicySchedule, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("readPolicySchedule: Failed to read schedule. %s", err)
+	}
+
+	var schedule PolicySchedule
+	if err := yaml.UnmarshalStrict(b, &schedule); err != nil {
+		return nil, fmt.Errorf("readPolicySchedule: Failed to parse schedule. %s", err)
+	}
+	return &schedule, nil
+}
+
+// LoadPolicyScheduleFile reads a policy schedule from a YAML or JSON file.
+// See ReadPolicySchedule for the format.
+//
+// Example:
+//
+//	schedule, err := dpa.LoadPolicyScheduleFile("schedule.yaml")
+//	if err != nil {
+//		log.Fatalf("Failed to load schedule. %s", err)
+//		return
+//	}
+func LoadPolicyScheduleFile(name string) (*PolicySchedule, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadPolicyScheduleFile: Failed to open schedule file. %s", err)
+	}
+	defer f.Close()
+
+	schedule, err := ReadPolicySchedule(f)
+	if err != nil {
+		return nil, fmt.Errorf("loadPolicyScheduleFile: %s: %s", name, err)
+	}
+	return schedule, nil
+}
+
+// NewPolicyScheduler validates the schedule and loads the state file when
+// it exists. Every policy needs a PolicyID or PolicyName, which must be
+// unique, and either both cron expressions or at least one interval.
+//
+// Example:
+//
+//	scheduler, err := dpa.NewPolicyScheduler(s, *schedule, dpa.PolicySchedulerOptions{
+//		StateFile: "scheduler-state.json",
+//		Notify: func(t dpa.ScheduledTransition) {
+//			log.Printf("%s %s %s %v", t.PolicyName, t.PolicyID, t.Status, t.Err)
+//		},
+//	})
+//	if err != nil {
+//		log.Fatalf("Failed to create scheduler. %s", err)
+//		return
+//	}
+//	err = scheduler.Run(ctx)
+func NewPolicyScheduler(s *Service, schedule PolicySchedule, opts PolicySchedulerOptions) (*PolicyScheduler, error) {
+	if opts.Interval < 0 || opts.Lookback < 0 {
+		return nil, fmt.Errorf("newPolicyScheduler: Interval and Lookback cannot be negative")
+	}
+	if opts.Interval == 0 {
+		opts.Interval = defaultSchedulerInterval
+	}
+	if opts.Lookback == 0 {
+		opts.Lookback = defaultSchedulerLookback
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	var errs validationErrors
+	keys := map[string]bool{}
+	policies := make([]scheduledPolicy, 0, len(schedule.Policies))
+	for i, sp := range schedule.Policies {
+		p, err := compileScheduledPolicy(sp)
+		if err != nil {
+			errs.add("policies[%d]: %s", i, err)
+			continue
+		}
+		if keys[p.key] {
+			errs.add("policies[%d]: policy %s is scheduled more than once", i, p.key)
+			continue
+		}
+		keys[p.key] = true
+		policies = append(policies, p)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("newPolicyScheduler: Invalid schedule. %w", err)
+	}
+
+	state := map[string]ScheduledTransition{}
+	if len(opts.StateFile) != 0 {
+		b, err := os.ReadFile(opts.StateFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("newPolicyScheduler: Failed to read state. %s", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(b, &state); err != nil {
+				return nil, fmt.Errorf("newPolicyScheduler: Failed to parse state. %s", err)
+			}
+		}
+	}
+
+	return &PolicyScheduler{service: s, policies: policies, opts: opts, state: state}, nil
+}
+
+// RunOnce applies the transitions which are due and not yet applied.
+// Returns the transitions attempted. Transitions which failed have Err set
+// and are not recorded. An error is returned when the state cannot be
+// saved.
+//
+// Example:
+//
+//	transitions, err := scheduler.RunOnce(context.Background())
+//	if err != nil {
+//		log.Fatalf("Failed to run scheduler. %s", err)
+//		return
+//	}
+func (p *PolicyScheduler) RunOnce(ctx context.Context) ([]ScheduledTransition, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.opts.Clock()
+	var transitions []ScheduledTransition
+	for _, sp := range p.policies {
+		status, at := sp.transition(now, p.opts.Lookback)
+		if at.IsZero() {
+			continue
+		}
+		if last, ok := p.state[sp.key]; ok && !last.At.Before(at) {
+			continue
+		}
+
+		t := ScheduledTransition{PolicyID: sp.PolicyID, PolicyName: sp.PolicyName, Status: status, At: at, AppliedAt: now}
+		t.PolicyID, t.Changed, t.Err = p.apply(ctx, sp, status)
+		transitions = append(transitions, t)
+		if t.Err != nil {
+			continue
+		}
+
+		p.state[sp.key] = t
+		if err := p.saveState(); err != nil {
+			return transitions, fmt.Errorf("runOnce: Failed to save state. %s", err)
+		}
+	}
+	return transitions, nil
+}
+
+// Run calls RunOnce every Interval until the context is done, passing each
+// transition to Notify. Returns the context's error, or the error of a run
+// which failed to save the state.
+//
+// Example:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//	defer stop()
+//	if err := scheduler.Run(ctx); !errors.Is(err, context.Canceled) {
+//		log.Fatalf("Scheduler stopped. %s", err)
+//	}
+func (p *PolicyScheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		transitions, err := p.RunOnce(ctx)
+		if p.opts.Notify != nil {
+			for _, t := range transitions {
+				p.opts.Notify(t)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("run: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Next returns the next transition of every scheduled policy after the
+// current time, ordered by time. Policies without further transitions are
+// omitted.
+//
+// Example:
+//
+//	for _, t := range scheduler.Next() {
+//		fmt.Printf("%s will be %s at %s\n", t.PolicyName, t.Status, t.At)
+//	}
+func (p *PolicyScheduler) Next() []ScheduledTransition {
+	now := p.opts.Clock()
+	var next []ScheduledTransition
+	for _, sp := range p.policies {
+		if status, at := sp.next(now); !at.IsZero() {
+			next = append(next, ScheduledTransition{PolicyID: sp.PolicyID, PolicyName: sp.PolicyName, Status: status, At: at})
+		}
+	}
+	sort.SliceStable(next, func(i, j int) bool { return next[i].At.Before(next[j].At) })
+	return next
+}
+
+// Sets the status of the policy, resolving its name when no ID is set.
+// Returns the policy ID and whether the status was changed.
+func (p *PolicyScheduler) apply(ctx context.Context, sp scheduledPolicy, status types.PolicyStatus) (string, bool, error) {
+	id := sp.PolicyID
+	if len(id) == 0 {
+		policy, dpaerr, err := p.service.GetPolicyByName(ctx, sp.PolicyName)
+		if err != nil {
+			return "", false, err
+		}
+		if !dpaerr.Empty() {
+			return "", false, dpaerr
+		}
+		id = policy.PolicyID
+	}
+
+	_, dpaerr, err := p.service.ModifyPolicy(ctx, id, func(policy *types.Policy) error {
+		if policy.Status == status {
+			return errStatusUnchanged
+		}
+		policy.Status = status
+		return nil
+	})
+	switch {
+	case errors.Is(err, errStatusUnchanged):
+		return id, false, nil
+	case err != nil:
+		return id, false, err
+	case !dpaerr.Empty():
+		return id, false, dpaerr
+	}
+	return id, true, nil
+}
+
+func (p *PolicyScheduler) saveState() error {
+	if len(p.opts.StateFile) == 0 {
+		return nil
+	}
+	b, err := json.MarshalIndent(p.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p.opts.StateFile, b)
+}
+
+func compileScheduledPolicy(sp ScheduledPolicy) (scheduledPolicy, error) {
+	p := scheduledPolicy{ScheduledPolicy: sp}
+	switch {
+	case len(sp.PolicyID) != 0 && len(sp.PolicyName) != 0:
+		return p, fmt.Errorf("only one of policyId and policyName can be set")
+	case len(sp.PolicyID) != 0:
+		p.key = "id:" + sp.PolicyID
+	case len(sp.PolicyName) != 0:
+		p.key = "name:" + sp.PolicyName
+	default:
+		return p, fmt.Errorf("policyId or policyName is required")
+	}
+
+	cron := len(sp.Enable) != 0 || len(sp.Disable) != 0
+	switch {
+	case cron && len(sp.Intervals) != 0:
+		return p, fmt.Errorf("cron expressions and intervals cannot be combined")
+	case cron && (len(sp.Enable) == 0 || len(sp.Disable) == 0):
+		return p, fmt.Errorf("enable and disable are both required")
+	case !cron && len(sp.Intervals) == 0:
+		return p, fmt.Errorf("enable and disable or intervals are required")
+	}
+
+	var err error
+	if cron {
+		if p.enable, err = ParseCron(sp.Enable); err != nil {
+			return p, err
+		}
+		if p.disable, err = ParseCron(sp.Disable); err != nil {
+			return p, err
+		}
+		p.location, err = loadTimeZone(sp.TimeZone)
+		return p, err
+	}
+
+	p.Intervals = append([]ScheduleInterval(nil), sp.Intervals...)
+	sort.Slice(p.Intervals, func(i, j int) bool { return p.Intervals[i].Start.Before(p.Intervals[j].Start) })
+	for i, in := range p.Intervals {
+		if !in.End.After(in.Start) {
+			return p, fmt.Errorf("interval %s must end after it starts", in.Start.Format(time.RFC3339))
+		}
+		if i > 0 && in.Start.Before(p.Intervals[i-1].End) {
+			return p, fmt.Errorf("interval %s overlaps the previous interval", in.Start.Format(time.RFC3339))
+		}
+	}
+	return p, nil
+}
+
+// Returns the status set by the last transition at or before now and its
+// time, or the zero time when there is none
+func (p scheduledPolicy) transition(now time.Time, lookback time.Duration) (types.PolicyStatus, time.Time) {
+	if p.enable != nil {
+		now = now.In(p.location)
+		limit := now.Add(-lookback)
+		enabled, disabled := p.enable.prev(now, limit), p.disable.prev(now, limit)
+		if enabled.After(disabled) {
+			return types.PolicyStatusEnabled, enabled
+		}
+		return types.PolicyStatusDisabled, disabled
+	}
+
+	status, at := types.PolicyStatus(""), time.Time{}
+	for _, in := range p.Intervals {
+		switch {
+		case in.Start.After(now):
+			return status, at
+		case in.End.After(now):
+			return types.PolicyStatusEnabled, in.Start
+		}
+		status, at = types.PolicyStatusDisabled, in.End
+	}
+	return status, at
+}
+
+// Returns the first transition after now and its time, or the zero time
+// when there is none
+func (p scheduledPolicy) next(now time.Time) (types.PolicyStatus, time.Time) {
+	if p.enable != nil {
+		now = now.In(p.location)
+		enabled, disabled := p.enable.Next(now), p.disable.Next(now)
+		if !enabled.IsZero() && (disabled.IsZero() || enabled.Before(disabled)) {
+			return types.PolicyStatusEnabled, enabled
+		}
+		return types.PolicyStatusDisabled, disabled
+	}
+
+	for _, in := range p.Intervals {
+		switch {
+		case in.Start.After(now):
+			return types.PolicyStatusEnabled, in.Start
+		case in.End.After(now):
+			return types.PolicyStatusDisabled, in.End
+		}
+	}
+	return "", time.Time{}
+}
@@ -0,0 +1,210 @@
+package dpa
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Returns a server which stores policy statuses by ID, names policies by
+// their ID and counts updates
+func schedulerServer(statuses map[string]types.PolicyStatus, updates *int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			*updates++
+		}
+		servePolicyStatuses(w, r, statuses)
+	}))
+}
+
+func TestPolicyScheduler(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	statuses := map[string]types.PolicyStatus{"change-window": types.PolicyStatusEnabled, "id-2": types.PolicyStatusDisabled}
+	var updates int
+	ts := schedulerServer(statuses, &updates)
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	schedule, err := ReadPolicySchedule(strings.NewReader(`
+policies:
+  - policyName: change-window
+    enable: "0 22 * * FRI"
+    disable: "0 6 * * SAT"
+    timeZone: Europe/Berlin
+  - policyId: id-2
+    intervals:
+      - start: 2024-05-03T20:00:00Z
+        end: 2024-05-03T22:00:00Z
+`))
+	if err != nil {
+		t.Fatalf("ReadPolicySchedule() error = %v", err)
+	}
+
+	now := time.Date(2024, 5, 3, 21, 0, 0, 0, berlin)
+	opts := PolicySchedulerOptions{
+		StateFile: filepath.Join(t.TempDir(), "state.json"),
+		Clock:     func() time.Time { return now },
+	}
+	run := func(s *PolicyScheduler, want ...ScheduledTransition) {
+		t.Helper()
+		got, err := s.RunOnce(context.Background())
+		if err != nil {
+			t.Fatalf("RunOnce() error = %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("RunOnce() = %+v, want %+v", got, want)
+		}
+		for i := range got {
+			if got[i].Err != nil || got[i].PolicyID != want[i].PolicyID || got[i].Status != want[i].Status ||
+				!got[i].At.Equal(want[i].At) || !got[i].AppliedAt.Equal(now) || got[i].Changed != want[i].Changed {
+				t.Errorf("RunOnce()[%d] = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+
+	s, err := NewPolicyScheduler(ns, *schedule, opts)
+	if err != nil {
+		t.Fatalf("NewPolicyScheduler() error = %v", err)
+	}
+
+	// The first run applies the last transition of the previous week
+	run(s, ScheduledTransition{PolicyID: "change-window", Status: types.PolicyStatusDisabled, At: time.Date(2024, 4, 27, 6, 0, 0, 0, berlin), Changed: true})
+	run(s)
+	if updates != 1 || statuses["change-window"] != types.PolicyStatusDisabled {
+		t.Errorf("RunOnce() updates = %d, statuses = %v", updates, statuses)
+	}
+
+	next := s.Next()
+	if len(next) != 2 || next[0].PolicyName != "change-window" || next[1].PolicyID != "id-2" ||
+		next[1].Status != types.PolicyStatusEnabled || !next[1].At.Equal(time.Date(2024, 5, 3, 22, 0, 0, 0, berlin)) {
+		t.Errorf("Next() = %+v", next)
+	}
+
+	now = time.Date(2024, 5, 3, 22, 30, 0, 0, berlin)
+	run(s,
+		ScheduledTransition{PolicyID: "change-window", Status: types.PolicyStatusEnabled, At: time.Date(2024, 5, 3, 22, 0, 0, 0, berlin), Changed: true},
+		ScheduledTransition{PolicyID: "id-2", Status: types.PolicyStatusEnabled, At: time.Date(2024, 5, 3, 20, 0, 0, 0, time.UTC), Changed: true},
+	)
+
+	// A restarted scheduler catches up with the transitions it missed
+	now = time.Date(2024, 5, 4, 9, 0, 0, 0, berlin)
+	s, err = NewPolicyScheduler(ns, *schedule, opts)
+	if err != nil {
+		t.Fatalf("NewPolicyScheduler() error = %v", err)
+	}
+	run(s,
+		ScheduledTransition{PolicyID: "change-window", Status: types.PolicyStatusDisabled, At: time.Date(2024, 5, 4, 6, 0, 0, 0, berlin), Changed: true},
+		ScheduledTransition{PolicyID: "id-2", Status: types.PolicyStatusDisabled, At: time.Date(2024, 5, 3, 22, 0, 0, 0, time.UTC), Changed: true},
+	)
+
+	// A status changed by hand is kept until the next transition
+	statuses["change-window"] = types.PolicyStatusEnabled
+	now = now.Add(time.Hour)
+	s, err = NewPolicyScheduler(ns, *schedule, opts)
+	if err != nil {
+		t.Fatalf("NewPolicyScheduler() error = %v", err)
+	}
+	run(s)
+	if updates != 5 || statuses["change-window"] != types.PolicyStatusEnabled || statuses["id-2"] != types.PolicyStatusDisabled {
+		t.Errorf("RunOnce() updates = %d, statuses = %v", updates, statuses)
+	}
+	if next := s.Next(); len(next) != 1 || next[0].Status != types.PolicyStatusEnabled {
+		t.Errorf("Next() = %+v", next)
+	}
+}
+
+func TestPolicySchedulerFailure(t *testing.T) {
+	statuses := map[string]types.PolicyStatus{"id-1": types.PolicyStatusDisabled}
+	var updates int
+	ts := schedulerServer(statuses, &updates)
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	schedule := PolicySchedule{Policies: []ScheduledPolicy{
+		{PolicyName: "missing", Enable: "@daily", Disable: "0 23 * * *"},
+		{PolicyID: "id-1", Enable: "@daily", Disable: "0 23 * * *"},
+	}}
+	var notified []ScheduledTransition
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewPolicyScheduler(ns, schedule, PolicySchedulerOptions{
+		Clock: func() time.Time { return now },
+		Notify: func(t ScheduledTransition) {
+			notified = append(notified, t)
+			cancel()
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyScheduler() error = %v", err)
+	}
+
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Errorf("Run() error = %v", err)
+	}
+	if len(notified) != 2 || notified[0].Err == nil || notified[1].Err != nil || statuses["id-1"] != types.PolicyStatusEnabled {
+		t.Fatalf("Run() notified = %+v, statuses = %v", notified, statuses)
+	}
+
+	// Failed transitions are retried
+	got, err := s.RunOnce(context.Background())
+	if err != nil || len(got) != 1 || got[0].PolicyName != "missing" || got[0].Err == nil {
+		t.Errorf("RunOnce() = %+v, %v", got, err)
+	}
+}
+
+func TestNewPolicySchedulerInvalid(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		name    string
+		policy  ScheduledPolicy
+		wantErr string
+	}{
+		{name: "No Policy", policy: ScheduledPolicy{Enable: "@daily", Disable: "@hourly"}, wantErr: "policyId or policyName is required"},
+		{name: "ID And Name", policy: ScheduledPolicy{PolicyID: "a", PolicyName: "a", Enable: "@daily", Disable: "@hourly"}, wantErr: "only one of policyId and policyName"},
+		{name: "No Schedule", policy: ScheduledPolicy{PolicyID: "a"}, wantErr: "enable and disable or intervals are required"},
+		{name: "Enable Only", policy: ScheduledPolicy{PolicyID: "a", Enable: "@daily"}, wantErr: "enable and disable are both required"},
+		{name: "Cron And Intervals", policy: ScheduledPolicy{PolicyID: "a", Enable: "@daily", Disable: "@hourly", Intervals: []ScheduleInterval{{Start: start, End: start.Add(time.Hour)}}}, wantErr: "cannot be combined"},
+		{name: "Invalid Cron", policy: ScheduledPolicy{PolicyID: "a", Enable: "0 25 * * *", Disable: "@hourly"}, wantErr: "invalid hour"},
+		{name: "Invalid Time Zone", policy: ScheduledPolicy{PolicyID: "a", Enable: "@daily", Disable: "@hourly", TimeZone: "Mars/Olympus"}, wantErr: "invalid time zone"},
+		{name: "Empty Interval", policy: ScheduledPolicy{PolicyID: "a", Intervals: []ScheduleInterval{{Start: start, End: start}}}, wantErr: "must end after it starts"},
+		{
+			name:    "Overlapping Intervals",
+			policy:  ScheduledPolicy{PolicyID: "a", Intervals: []ScheduleInterval{{Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)}, {Start: start, End: start.Add(2 * time.Hour)}}},
+			wantErr: "overlaps the previous interval",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPolicyScheduler(nil, PolicySchedule{Policies: []ScheduledPolicy{tt.policy}}, PolicySchedulerOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewPolicyScheduler() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	duplicate := ScheduledPolicy{PolicyName: "a", Enable: "@daily", Disable: "@hourly"}
+	if _, err := NewPolicyScheduler(nil, PolicySchedule{Policies: []ScheduledPolicy{duplicate, duplicate}}, PolicySchedulerOptions{}); err == nil || !strings.Contains(err.Error(), "scheduled more than once") {
+		t.Errorf("NewPolicyScheduler() error = %v", err)
+	}
+	if _, err := ReadPolicySchedule(strings.NewReader("policies:\n  - policyId: a\n    enabled: '@daily'\n")); err == nil {
+		t.Errorf("ReadPolicySchedule() expected error for unknown field")
+	}
+}
@@ -0,0 +1,627 @@
+package dpa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+	"sigs.k8s.io/yaml"
+)
+
+// SchemaDraft is the JSON Schema dialect of generated schemas
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document. Only the keywords used by generated
+// schemas are supported. Besides the standard date and date-time formats,
+// the format time-zone marks an IANA time zone name such as Europe/Berlin.
+// Like the API, Validate also accepts RFC 3339 timestamps as dates and null
+// for properties which are not required.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             int                `json:"minItems,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	MinProperties        int                `json:"minProperties,omitempty"`
+	MaxProperties        int                `json:"maxProperties,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Examples             []string           `json:"examples,omitempty"`
+}
+
+// GenerateSchema generates a JSON Schema for the type of v. Structs are
+// described in $defs and properties are named as in their JSON encoding.
+// Objects do not allow unknown properties so misspelt fields are reported.
+// Enum values, formats, limits and descriptions are included for the
+// types of the types package.
+//
+// Example:
+//
+//	schema, err := dpa.GenerateSchema(types.Policy{})
+//	if err != nil {
+//		log.Fatalf("Failed to generate schema. %s", err)
+//		return
+//	}
+//	b, _ := json.MarshalIndent(schema, "", "  ")
+//	os.WriteFile("policy.schema.json", b, 0644)
+func GenerateSchema(v interface{}) (*Schema, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil, fmt.Errorf("generateSchema: Type cannot be nil")
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if len(t.Name()) == 0 {
+		return nil, fmt.Errorf("generateSchema: Type must be named")
+	}
+
+	g := schemaGenerator{defs: map[string]*Schema{}}
+	ref, err := g.schema(t)
+	if err != nil {
+		return nil, fmt.Errorf("generateSchema: Failed to generate schema. %s", err)
+	}
+	return &Schema{
+		Schema:      SchemaDraft,
+		Title:       t.Name(),
+		Description: schemaAnnotations[t.Name()].Description,
+		Ref:         ref.Ref,
+		Defs:        g.defs,
+	}, nil
+}
+
+// Schemas of the documents read by the package, generated once when the
+// package is initialised so a broken annotation fails at start up and the
+// accessors below never panic
+var (
+	policySchema           = mustGenerateSchema(types.Policy{})
+	targetSetMappingSchema = mustGenerateSchema(types.TargetSetMapping{})
+	settingsSchema         = mustGenerateSchema(types.Settings{})
+)
+
+// PolicySchema returns the JSON Schema of a types.Policy document. Each
+// call returns a new copy which may be modified.
+//
+// Example:
+//
+//	err := dpa.PolicySchema().ValidateFile("policy.yaml")
+//	if err != nil {
+//		log.Fatalf("Invalid policy. %s", err)
+//		return
+//	}
+func PolicySchema() *Schema {
+	return policySchema.clone()
+}
+
+// TargetSetMappingSchema returns the JSON Schema of a types.TargetSetMapping
+// document. Each call returns a new copy which may be modified.
+func TargetSetMappingSchema() *Schema {
+	return targetSetMappingSchema.clone()
+}
+
+// SettingsSchema returns the JSON Schema of a types.Settings document. Each
+// call returns a new copy which may be modified.
+func SettingsSchema() *Schema {
+	return settingsSchema.clone()
+}
+
+// Returns a deep copy of the schema
+func (s *Schema) clone() *Schema {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Enum = slices.Clone(s.Enum)
+	c.Required = slices.Clone(s.Required)
+	c.Examples = slices.Clone(s.Examples)
+	c.Items = s.Items.clone()
+	c.Defs = cloneSchemas(s.Defs)
+	c.Properties = cloneSchemas(s.Properties)
+	if s.Minimum != nil {
+		c.Minimum = schemaBound(*s.Minimum)
+	}
+	if s.Maximum != nil {
+		c.Maximum = schemaBound(*s.Maximum)
+	}
+	if s.AdditionalProperties != nil {
+		c.AdditionalProperties = types.Bool(*s.AdditionalProperties)
+	}
+	return &c
+}
+
+func cloneSchemas(m map[string]*Schema) map[string]*Schema {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]*Schema, len(m))
+	for k, s := range m {
+		c[k] = s.clone()
+	}
+	return c
+}
+
+func mustGenerateSchema(v interface{}) *Schema {
+	s, err := GenerateSchema(v)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate checks a JSON or YAML document against the schema. All problems
+// found are returned joined in a single error.
+//
+// Example:
+//
+//	if err := dpa.SettingsSchema().Validate(b); err != nil {
+//		log.Fatalf("Invalid settings. %s", err)
+//		return
+//	}
+func (s *Schema) Validate(b []byte) error {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return fmt.Errorf("validate: Failed to parse document. %s", err)
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return fmt.Errorf("validate: Failed to parse document. %s", err)
+	}
+
+	v := schemaValidator{root: s}
+	v.validate("", s, doc)
+	return errors.Join(v.errs...)
+}
+
+// ValidateFile checks a JSON or YAML file against the schema.
+// See Validate for details.
+//
+// Example:
+//
+//	if err := dpa.PolicySchema().ValidateFile("policy.yaml"); err != nil {
+//		log.Fatalf("Invalid policy. %s", err)
+//		return
+//	}
+func (s *Schema) ValidateFile(name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("validateFile: Failed to read file. %s", err)
+	}
+	if err := s.Validate(b); err != nil {
+		return fmt.Errorf("validateFile: %s: %w", name, err)
+	}
+	return nil
+}
+
+// Adds the vocabulary the json package cannot derive from struct tags.
+// Keys are a type name or a type name and JSON property name.
+var schemaAnnotations = map[string]Schema{
+	"Policy":                 {Description: "Access policy granting identities connections to virtual machines"},
+	"Policy.policyId":        {Description: "Identifier assigned by DPA. Ignored when a policy is added", ReadOnly: true},
+	"Policy.policyName":      {Description: "Unique name of the policy"},
+	"Policy.status":          {Description: "Status of the policy. Only Enabled policies grant access"},
+	"Policy.description":     {Description: "Description of the policy"},
+	"Policy.providersData":   {Description: "Targets the policy applies to, by provider"},
+	"Policy.startDate":       {Description: "First day the policy grants access", Format: "date"},
+	"Policy.endDate":         {Description: "Last day the policy grants access", Format: "date"},
+	"Policy.userAccessRules": {Description: "Rules granting identities access to the targets", MinItems: 1},
+	"Policy.updatedOn":       {Description: "Time the policy was last updated. Set by DPA", ReadOnly: true},
+
+	"ProvidersData":                 {Description: "Target scope of each provider. Providers which are not set are not part of the policy", MinProperties: 1},
+	"Aws.regions":                   {Description: "AWS regions, e.g. us-east-1"},
+	"Aws.tags":                      {Description: "EC2 instance tags"},
+	"Aws.vpcIds":                    {Description: "VPC identifiers"},
+	"Aws.accountIds":                {Description: "AWS account identifiers"},
+	"Azure.regions":                 {Description: "Azure regions, e.g. eastus"},
+	"Azure.tags":                    {Description: "Virtual machine tags"},
+	"Azure.resourceGroups":          {Description: "Resource group names"},
+	"Azure.vnetIds":                 {Description: "Virtual network identifiers"},
+	"Azure.subscriptions":           {Description: "Subscription identifiers"},
+	"Gcp.regions":                   {Description: "GCP regions, e.g. us-central1"},
+	"Gcp.labels":                    {Description: "Instance labels"},
+	"Gcp.vpc_ids":                   {Description: "VPC network identifiers"},
+	"Gcp.projects":                  {Description: "Project identifiers"},
+	"Tags.Key":                      {Description: "Tag key"},
+	"Tags.Value":                    {Description: "Tag values. Any of the values matches"},
+	"Labels.Key":                    {Description: "Label key"},
+	"Labels.Value":                  {Description: "Label values. Any of the values matches"},
+	"OnPrem.fqdnRulesConjunction":   {Description: "Whether targets must match every rule (AND) or any rule (OR)", Enum: []string{"AND", "OR"}},
+	"OnPrem.fqdnRules":              {Description: "Rules matching the fully qualified domain names of targets"},
+	"FqdnRules.operator":            {Description: "How the computer name is matched", Enum: []string{"EXACTLY", "WILDCARD", "PREFIX", "SUFFIX", "CONTAINS"}},
+	"FqdnRules.computernamePattern": {Description: "Computer name pattern. WILDCARD patterns support *"},
+	"FqdnRules.domain":              {Description: "Domain of the targets, e.g. example.local"},
+
+	"UserAccessRules.ruleName":              {Description: "Name of the rule, unique within the policy"},
+	"UserAccessRules.userData":              {Description: "Identities the rule grants access to. At least one user, group or role is required"},
+	"UserAccessRules.connectionInformation": {Description: "When and how the identities connect"},
+	"Roles.name":                            {Description: "Role name"},
+	"Roles.source":                          {Description: "Directory the role is defined in, e.g. IDENTITY"},
+	"Groups.name":                           {Description: "Group name"},
+	"Groups.source":                         {Description: "Directory the group is defined in"},
+	"Users.name":                            {Description: "User name"},
+	"Users.source":                          {Description: "Directory the user is defined in"},
+
+	"ConnectionInformation.connectAs":                  {Description: "Account the identities connect as, by provider"},
+	"ConnectionInformation.grantAccess":                {Description: "Hours access is granted for at a time. The default applies when 0 or omitted", Minimum: schemaBound(0), Maximum: schemaBound(24)},
+	"ConnectionInformation.idleTime":                   {Description: "Minutes after which idle sessions end. The default applies when 0 or omitted"},
+	"ConnectionInformation.daysOfWeek":                 {Description: "Days access is granted on. Every day when empty", UniqueItems: true},
+	"ConnectionInformation.fullDays":                   {Description: "Grant access at any time of day"},
+	"ConnectionInformation.hoursFrom":                  {Description: "Time of day access starts (HH:MM)", Pattern: clockPattern, Examples: []string{"08:00"}},
+	"ConnectionInformation.hoursTo":                    {Description: "Time of day access ends (HH:MM). Earlier than hoursFrom ends the next day", Pattern: clockPattern, Examples: []string{"18:00"}},
+	"ConnectionInformation.timeZone":                   {Description: "IANA time zone of hoursFrom and hoursTo. UTC when empty", Format: "time-zone", Examples: []string{"UTC", "Europe/Berlin"}},
+	"ConnectAs":                                        {MinProperties: 1},
+	"ConnectAsAws.ssh":                                 {Description: "Account SSH sessions connect as"},
+	"ConnectAsAzure.ssh":                               {Description: "Account SSH sessions connect as"},
+	"ConnectAsOnPrem.ssh":                              {Description: "Account SSH sessions connect as"},
+	"ConnectAsGcp.ssh":                                 {Description: "Account SSH sessions connect as"},
+	"Rdp":                                              {Description: "Account RDP sessions connect as. Exactly one option is set", MinProperties: 1, MaxProperties: 1},
+	"Rdp.user":                                         {Description: "Name of an existing account"},
+	"Rdp.localEphemeralUser":                           {Description: "Temporary local account"},
+	"Rdp.domainEphemeralUser":                          {Description: "Temporary domain account"},
+	"LocalEphemeralUser.assignGroups":                  {Description: "Local groups the account is added to"},
+	"DomainEphemeralUser.assignGroups":                 {Description: "Local groups the account is added to"},
+	"DomainEphemeralUser.assignDomainGroups":           {Description: "Domain groups the account is added to"},
+	"DomainEphemeralUser.enableEphemeralUserReconnect": {Description: "Reconnect disconnected sessions as the same account"},
+
+	"TargetSetMapping":                         {Description: "Target sets and the strong account used to provision them"},
+	"TargetSetMapping.strong_account_id":       {Description: "Identifier of the strong account"},
+	"TargetSets.name":                          {Description: "Domain, suffix or target name"},
+	"TargetSets.description":                   {Description: "Description of the target set"},
+	"TargetSets.provision_format":              {Description: "Format of provisioned account names"},
+	"TargetSets.enable_certificate_validation": {Description: "Validate the certificates of targets"},
+	"TargetSets.secret_type":                   {Description: "Type of the strong account secret"},
+	"TargetSets.secret_id":                     {Description: "Identifier of the strong account secret"},
+	"TargetSets.type":                          {Description: "What the name matches"},
+
+	"Settings":                                        {Description: "Configuration of each DPA feature. Features which are not set are not changed"},
+	"MfaCaching.isMfaCachingEnabled":                  {Description: "Cache MFA so users are not prompted for every connection"},
+	"MfaCaching.keyExpirationTimeSec":                 {Description: "Seconds a cached MFA key is valid", Minimum: schemaBound(1)},
+	"SSHCommandAudit.isCommandParsingForAuditEnabled": {Description: "Parse SSH commands for the audit"},
+	"SSHCommandAudit.shellPromptForAudit":             {Description: "Regular expression matching the shell prompt"},
+	"StandingAccess.standingAccessAvailable":          {Description: "Allow standing access"},
+	"StandingAccess.sessionMaxDuration":               {Description: "Maximum hours of a standing access session", Minimum: schemaBound(1)},
+	"StandingAccess.sessionIdleTime":                  {Description: "Minutes after which idle standing access sessions end", Minimum: schemaBound(1)},
+	"RdpFileTransfer.enabled":                         {Description: "Allow file transfer in RDP sessions"},
+	"CertificateValidation.enabled":                   {Description: "Validate the certificates of targets"},
+}
+
+// Properties which must be present, by type name
+var schemaRequired = map[string][]string{
+	"Policy":                {"policyName", "providersData", "userAccessRules"},
+	"UserAccessRules":       {"ruleName", "userData", "connectionInformation"},
+	"ConnectionInformation": {"connectAs"},
+	"FqdnRules":             {"operator", "computernamePattern"},
+	"TargetSets":            {"name"},
+	"Tags":                  {"Key"},
+	"Labels":                {"Key"},
+}
+
+// Valid values of the enum types
+var schemaEnums = map[reflect.Type][]string{
+	reflect.TypeOf(types.PolicyStatus("")):       enumNames(types.PolicyStatuses),
+	reflect.TypeOf(types.Provider("")):           enumNames(types.Providers),
+	reflect.TypeOf(types.DayOfWeek("")):          enumNames(types.DaysOfWeek),
+	reflect.TypeOf(types.ConnectorOS("")):        enumNames(types.ConnectorOSes),
+	reflect.TypeOf(types.ConnectorType("")):      enumNames(types.ConnectorTypes),
+	reflect.TypeOf(types.FeatureName("")):        enumNames(types.FeatureNames),
+	reflect.TypeOf(types.TargetSetType("")):      enumNames(types.TargetSetTypes),
+	reflect.TypeOf(types.DatabaseEngine("")):     enumNames(types.DatabaseEngines),
+	reflect.TypeOf(types.KubernetesPlatform("")): enumNames(types.KubernetesPlatforms),
+}
+
+const clockPattern = `^([01][0-9]|2[0-3]):[0-5][0-9]$`
+
+func enumNames[T ~string](values []T) []string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = string(v)
+	}
+	return names
+}
+
+func schemaBound(f float64) *float64 {
+	return &f
+}
+
+type schemaGenerator struct {
+	defs map[string]*Schema
+}
+
+// Returns the schema of a type. Named structs are added to the $defs and
+// referenced.
+func (g *schemaGenerator) schema(t reflect.Type) (*Schema, error) {
+	if enum, ok := schemaEnums[t]; ok {
+		return &Schema{Type: "string", Enum: enum}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		name := t.Name()
+		if len(name) == 0 {
+			return g.object(t)
+		}
+		if _, ok := g.defs[name]; !ok {
+			// Reserve the name so recursive types terminate
+			g.defs[name] = nil
+			s, err := g.object(t)
+			if err != nil {
+				return nil, err
+			}
+			g.defs[name] = s
+		}
+		return &Schema{Ref: "#/$defs/" + name}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// Returns the schema of a struct with a property for each JSON field
+func (g *schemaGenerator) object(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: types.Bool(false)}
+	mergeSchema(s, schemaAnnotations[t.Name()])
+	s.Required = slices.Clone(schemaRequired[t.Name()])
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		p, err := g.schema(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", t.Name(), f.Name, err)
+		}
+		if len(t.Name()) != 0 {
+			mergeSchema(p, schemaAnnotations[t.Name()+"."+name])
+		}
+		s.Properties[name] = p
+	}
+	return s, nil
+}
+
+// Copies the keywords set in the annotation to the schema
+func mergeSchema(s *Schema, a Schema) {
+	if len(a.Description) != 0 {
+		s.Description = a.Description
+	}
+	if len(a.Enum) != 0 {
+		s.Enum = a.Enum
+	}
+	if len(a.Format) != 0 {
+		s.Format = a.Format
+	}
+	if len(a.Pattern) != 0 {
+		s.Pattern = a.Pattern
+	}
+	if a.Minimum != nil {
+		s.Minimum = a.Minimum
+	}
+	if a.Maximum != nil {
+		s.Maximum = a.Maximum
+	}
+	if a.MinItems != 0 {
+		s.MinItems = a.MinItems
+	}
+	if a.UniqueItems {
+		s.UniqueItems = true
+	}
+	if a.MinProperties != 0 {
+		s.MinProperties = a.MinProperties
+	}
+	if a.MaxProperties != 0 {
+		s.MaxProperties = a.MaxProperties
+	}
+	if a.ReadOnly {
+		s.ReadOnly = true
+	}
+	if len(a.Examples) != 0 {
+		s.Examples = a.Examples
+	}
+}
+
+type schemaValidator struct {
+	root *Schema
+	errs validationErrors
+}
+
+// Checks a decoded JSON value against a schema
+func (v *schemaValidator) validate(path string, s *Schema, doc interface{}) {
+	if len(path) == 0 {
+		path = "document"
+	}
+
+	if len(s.Ref) != 0 {
+		ref, err := v.resolve(s.Ref)
+		if err != nil {
+			v.errs.add("%s: %s", path, err)
+			return
+		}
+		v.validate(path, ref, doc)
+	}
+
+	if len(s.Type) != 0 && schemaType(doc) != s.Type && !(s.Type == "number" && schemaType(doc) == "integer") {
+		v.errs.add("%s must be of type %s, got %s", path, s.Type, schemaType(doc))
+		return
+	}
+
+	switch d := doc.(type) {
+	case string:
+		v.validateString(path, s, d)
+	case json.Number:
+		f, _ := d.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			v.errs.add("%s must be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.errs.add("%s must be at most %v", path, *s.Maximum)
+		}
+	case []interface{}:
+		if len(d) < s.MinItems {
+			v.errs.add("%s must have at least %s", path, plural(s.MinItems, "item", "items"))
+		}
+		seen := map[string]bool{}
+		for i, item := range d {
+			if s.UniqueItems {
+				b, _ := json.Marshal(item)
+				if seen[string(b)] {
+					v.errs.add("%s[%d] is a duplicate", path, i)
+				}
+				seen[string(b)] = true
+			}
+			if s.Items != nil {
+				v.validate(fmt.Sprintf("%s[%d]", path, i), s.Items, item)
+			}
+		}
+	case map[string]interface{}:
+		v.validateObject(path, s, d)
+	}
+}
+
+func (v *schemaValidator) validateString(path string, s *Schema, d string) {
+	if len(s.Enum) != 0 && !slices.Contains(s.Enum, d) {
+		v.errs.add("%s %q is not valid. Valid options are %s", path, d, strings.Join(s.Enum, ", "))
+	}
+	if len(s.Pattern) != 0 {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			v.errs.add("%s: invalid pattern %q", path, s.Pattern)
+		} else if !re.MatchString(d) {
+			v.errs.add("%s %q does not match %s", path, d, s.Pattern)
+		}
+	}
+
+	var err error
+	switch s.Format {
+	case "date":
+		_, err = parsePolicyDate(d, time.UTC)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, d)
+	case "time-zone":
+		_, err = loadTimeZone(d)
+	}
+	if err != nil {
+		v.errs.add("%s %q is not a valid %s", path, d, s.Format)
+	}
+}
+
+func (v *schemaValidator) validateObject(path string, s *Schema, d map[string]interface{}) {
+	for _, r := range s.Required {
+		if _, ok := d[r]; !ok {
+			v.errs.add("%s is required", schemaPath(path, r))
+		}
+	}
+	if s.MinProperties != 0 && len(d) < s.MinProperties {
+		v.errs.add("%s must have at least %s", path, plural(s.MinProperties, "property", "properties"))
+	}
+	if s.MaxProperties != 0 && len(d) > s.MaxProperties {
+		v.errs.add("%s must have at most %s", path, plural(s.MaxProperties, "property", "properties"))
+	}
+
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p, ok := s.Properties[k]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				v.errs.add("%s is not a known property", schemaPath(path, k))
+			}
+			continue
+		}
+		// API responses set unset optional fields to null
+		if d[k] == nil && !slices.Contains(s.Required, k) {
+			continue
+		}
+		v.validate(schemaPath(path, k), p, d[k])
+	}
+}
+
+// Resolves a reference to a definition of the root schema
+func (v *schemaValidator) resolve(ref string) (*Schema, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+	s := v.root.Defs[name]
+	if s == nil {
+		return nil, fmt.Errorf("unresolved reference %q", ref)
+	}
+	return s, nil
+}
+
+// Returns the path of a property of the object at path
+func schemaPath(path, key string) string {
+	if path == "document" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Returns the JSON Schema type of a decoded JSON value
+func schemaType(doc interface{}) string {
+	switch d := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := d.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
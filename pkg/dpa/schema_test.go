@@ -0,0 +1,315 @@
+package dpa
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestGenerateSchema(t *testing.T) {
+	s := PolicySchema()
+	if s.Schema != SchemaDraft || s.Ref != "#/$defs/Policy" || s.Title != "Policy" {
+		t.Fatalf("PolicySchema() = %+v", s)
+	}
+
+	policy := s.Defs["Policy"]
+	if !slices.Equal(policy.Required, []string{"policyName", "providersData", "userAccessRules"}) || *policy.AdditionalProperties {
+		t.Errorf("PolicySchema() policy = %+v", policy)
+	}
+	if got := policy.Properties["status"].Enum; !slices.Equal(got, enumNames(types.PolicyStatuses)) {
+		t.Errorf("PolicySchema() status enum = %v", got)
+	}
+	if got := policy.Properties["startDate"].Format; got != "date" {
+		t.Errorf("PolicySchema() startDate format = %s", got)
+	}
+	if !policy.Properties["policyId"].ReadOnly {
+		t.Errorf("PolicySchema() policyId is not read only")
+	}
+
+	ci := s.Defs["ConnectionInformation"]
+	if got := ci.Properties["daysOfWeek"].Items.Enum; !slices.Equal(got, enumNames(types.DaysOfWeek)) {
+		t.Errorf("PolicySchema() daysOfWeek enum = %v", got)
+	}
+	if got := ci.Properties["timeZone"]; got.Format != "time-zone" || len(got.Description) == 0 {
+		t.Errorf("PolicySchema() timeZone = %+v", got)
+	}
+	if got := ci.Properties["grantAccess"]; *got.Minimum != 0 || *got.Maximum != 24 {
+		t.Errorf("PolicySchema() grantAccess = %+v", got)
+	}
+	if got := ci.Properties["idleTime"]; got.Minimum != nil || got.Maximum != nil {
+		t.Errorf("PolicySchema() idleTime = %+v", got)
+	}
+	if got := s.Defs["Rdp"]; got.MinProperties != 1 || got.MaxProperties != 1 {
+		t.Errorf("PolicySchema() rdp = %+v", got)
+	}
+
+	// Every reference resolves
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, ref := range strings.Split(string(b), `"$ref":"#/$defs/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if s.Defs[name] == nil {
+			t.Errorf("PolicySchema() reference %s is not defined", name)
+		}
+	}
+
+	if got := TargetSetMappingSchema().Defs["TargetSets"].Properties["type"].Enum; !slices.Equal(got, enumNames(types.TargetSetTypes)) {
+		t.Errorf("TargetSetMappingSchema() type enum = %v", got)
+	}
+	if got := SettingsSchema().Defs["MfaCaching"].Properties["isMfaCachingEnabled"].Type; got != "boolean" {
+		t.Errorf("SettingsSchema() isMfaCachingEnabled type = %s", got)
+	}
+
+	if _, err := GenerateSchema(struct{ Name string }{}); err == nil {
+		t.Errorf("GenerateSchema() expected error for unnamed type")
+	}
+	if _, err := GenerateSchema(map[string]string{}); err == nil {
+		t.Errorf("GenerateSchema() expected error for map")
+	}
+}
+
+func TestPackageSchemas(t *testing.T) {
+	var tests = []struct {
+		name     string
+		accessor func() *Schema
+		value    interface{}
+	}{
+		{name: "Policy", accessor: PolicySchema, value: types.Policy{}},
+		{name: "TargetSetMapping", accessor: TargetSetMappingSchema, value: types.TargetSetMapping{}},
+		{name: "Settings", accessor: SettingsSchema, value: types.Settings{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := GenerateSchema(tt.value)
+			if err != nil {
+				t.Fatalf("GenerateSchema() error = %v", err)
+			}
+			s := tt.accessor()
+			if !reflect.DeepEqual(s, want) {
+				t.Errorf("%sSchema() differs from GenerateSchema()", tt.name)
+			}
+
+			// Changing a returned schema does not change the package schema
+			for _, d := range s.Defs {
+				d.Required = append(d.Required, "changed")
+				d.Properties["changed"] = &Schema{}
+			}
+			s.Defs["Changed"] = &Schema{}
+			if !reflect.DeepEqual(tt.accessor(), want) {
+				t.Errorf("%sSchema() changed by modifying a returned schema", tt.name)
+			}
+		})
+	}
+}
+
+const schemaPolicyYAML = `
+policyName: Prod Access
+status: Enabled
+startDate: "2024-01-01"
+providersData:
+  AWS:
+    regions: [us-east-1]
+    tags:
+      - Key: env
+        Value: [prod]
+userAccessRules:
+  - ruleName: Ops
+    userData:
+      roles:
+        - name: Ops
+          source: IDENTITY
+    connectionInformation:
+      connectAs:
+        AWS:
+          ssh: ec2-user
+          rdp:
+            localEphemeralUser:
+              assignGroups: [Remote Desktop Users]
+      grantAccess: 2
+      daysOfWeek: [Mon, Tue]
+      hoursFrom: "08:00"
+      hoursTo: "18:00"
+      timeZone: Europe/Berlin
+`
+
+func TestSchemaValidate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		schema  *Schema
+		input   string
+		wantErr []string
+	}{
+		{
+			name:   "Valid Policy",
+			schema: PolicySchema(),
+			input:  schemaPolicyYAML,
+		},
+		{
+			name:   "Invalid Values",
+			schema: PolicySchema(),
+			input: strings.NewReplacer(
+				"status: Enabled", "status: Active",
+				`"2024-01-01"`, `"01/01/2024"`,
+				"grantAccess: 2", "grantAccess: 30",
+				"[Mon, Tue]", "[Mon, Mon]",
+				`hoursTo: "18:00"`, `hoursTo: "6pm"`,
+				"Europe/Berlin", "Mars/Olympus",
+				"ruleName: Ops", "rulename: Ops",
+				"ssh: ec2-user", "ssh: 22\n          user: root",
+				"              assignGroups", "              assignGroups: x\n            user: admin\n            groups",
+			).Replace(schemaPolicyYAML),
+			wantErr: []string{
+				`status "Active" is not valid. Valid options are Enabled, Disabled`,
+				`startDate "01/01/2024" is not a valid date`,
+				"userAccessRules[0].connectionInformation.grantAccess must be at most 24",
+				"userAccessRules[0].connectionInformation.daysOfWeek[1] is a duplicate",
+				`userAccessRules[0].connectionInformation.hoursTo "6pm" does not match`,
+				`userAccessRules[0].connectionInformation.timeZone "Mars/Olympus" is not a valid time-zone`,
+				"userAccessRules[0].ruleName is required",
+				"userAccessRules[0].rulename is not a known property",
+				"userAccessRules[0].connectionInformation.connectAs.AWS.ssh must be of type string, got integer",
+				"userAccessRules[0].connectionInformation.connectAs.AWS.user is not a known property",
+				"userAccessRules[0].connectionInformation.connectAs.AWS.rdp must have at most 1 property",
+				"userAccessRules[0].connectionInformation.connectAs.AWS.rdp.localEphemeralUser.assignGroups must be of type array, got string",
+			},
+		},
+		{
+			name:   "Valid API Response",
+			schema: PolicySchema(),
+			input: `{
+				"policyId": "01a4f891-1591-4acb-ae3f-f27e56d45499",
+				"policyName": "Production System Access",
+				"status": "Draft",
+				"description": "",
+				"providersData": {
+					"OnPrem": {
+						"fqdnRulesConjunction": "OR",
+						"fqdnRules": [{"operator": "CONTAINS", "computernamePattern": "prod", "domain": "example.local"}]
+					}
+				},
+				"startDate": null,
+				"endDate": "2024-12-31T00:00:00Z",
+				"userAccessRules": [
+					{
+						"ruleName": "StorageTower",
+						"userData": {"roles": [{"name": "StorageTower", "source": null}], "groups": [], "users": []},
+						"connectionInformation": {
+							"connectAs": {"OnPrem": {"rdp": {"localEphemeralUser": {"assignGroups": ["Remote Desktop Users"]}}}},
+							"grantAccess": 2,
+							"idleTime": 10,
+							"daysOfWeek": ["Mon", "Tue"],
+							"fullDays": false,
+							"hoursFrom": "08:00",
+							"hoursTo": "18:00",
+							"timeZone": "America/New_York"
+						}
+					}
+				]
+			}`,
+		},
+		{
+			name:    "Invalid Null Required Field",
+			schema:  PolicySchema(),
+			input:   `{"policyName": null, "providersData": {"AWS": {}}, "userAccessRules": [{}]}`,
+			wantErr: []string{"policyName must be of type string, got null"},
+		},
+		{
+			name:    "Missing Fields",
+			schema:  PolicySchema(),
+			input:   `{"policyName": "Empty", "providersData": {}, "userAccessRules": []}`,
+			wantErr: []string{"providersData must have at least 1 property", "userAccessRules must have at least 1 item"},
+		},
+		{
+			name:    "Not An Object",
+			schema:  PolicySchema(),
+			input:   `[]`,
+			wantErr: []string{"document must be of type object, got array"},
+		},
+		{
+			name:   "Valid Target Sets",
+			schema: TargetSetMappingSchema(),
+			input:  `{"strong_account_id": "acc-1", "target_sets": [{"name": "example.com", "type": "Domain", "enable_certificate_validation": true}]}`,
+		},
+		{
+			name:    "Invalid Target Sets",
+			schema:  TargetSetMappingSchema(),
+			input:   `{"target_sets": [{"type": "Forest"}]}`,
+			wantErr: []string{"target_sets[0].name is required", `target_sets[0].type "Forest" is not valid`},
+		},
+		{
+			name:   "Valid Settings",
+			schema: SettingsSchema(),
+			input:  "mfaCaching:\n  isMfaCachingEnabled: true\n  keyExpirationTimeSec: 900\n",
+		},
+		{
+			name:    "Invalid Settings",
+			schema:  SettingsSchema(),
+			input:   "mfaCaching:\n  isMfaCachingEnabled: yes please\n  keyExpirationTimeSec: 1.5\n",
+			wantErr: []string{"mfaCaching.isMfaCachingEnabled must be of type boolean, got string", "mfaCaching.keyExpirationTimeSec must be of type integer, got number"},
+		},
+		{
+			name:    "Invalid Document",
+			schema:  SettingsSchema(),
+			input:   "mfaCaching: [",
+			wantErr: []string{"validate: Failed to parse document"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schema.Validate([]byte(tt.input))
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() expected error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error missing %q in\n%s", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaValidateMarshalledPolicies(t *testing.T) {
+	s := PolicySchema()
+	for _, p := range append([]types.Policy{validPolicy()}, simulatorPolicies...) {
+		b, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		if err := s.Validate(b); err != nil {
+			t.Errorf("Validate(%s) error = %v", p.PolicyName, err)
+		}
+	}
+}
+
+func TestSchemaValidateFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(name, []byte(schemaPolicyYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := PolicySchema().ValidateFile(name); err != nil {
+		t.Errorf("ValidateFile() error = %v", err)
+	}
+	if err := SettingsSchema().ValidateFile(name); err == nil || !strings.Contains(err.Error(), "policyName is not a known property") {
+		t.Errorf("ValidateFile() error = %v", err)
+	}
+	if err := PolicySchema().ValidateFile(name + ".missing"); err == nil {
+		t.Errorf("ValidateFile() expected error for missing file")
+	}
+}
@@ -3,12 +3,14 @@ package dpa
 import (
 	"fmt"
 	"net/http"
+	"sync/atomic"
 
 	"golang.org/x/oauth2"
 )
 
 type Service struct {
-	client *Client
+	client     *Client
+	guardrails atomic.Pointer[Guardrails]
 }
 
 func NewService(clientURL, clientApiEndpoint string, verbose bool, authToken *oauth2.Token) (*Service, error) {
@@ -4,16 +4,12 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
 )
 
-var (
-	settings       types.Settings
-	featureSetting types.FeatureSetting
-)
-
 // ListSettings provides all settings as a response.
 // Returns a types.Settings response or types.ErrorResponse based on the
 // response from the API. An error is returned on request failure
@@ -30,6 +26,9 @@ func (s *Service) ListSettings(ctx context.Context) (*types.Settings, *types.Err
 	// Set a timeout for the request
 	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
 
+	var settings types.Settings
+	var errorResponse types.ErrorResponse
+
 	// Make request for settings via service client
 	if err := s.client.Get(ctx, "/settings", &settings, &errorResponse); err != nil {
 		defer cancelCtx()
@@ -40,8 +39,7 @@ func (s *Service) ListSettings(ctx context.Context) (*types.Settings, *types.Err
 }
 
 // ListSettingsFeature provides a specific setting reponse.
-// Valid input strings are:
-// 'MFA_CACHING', 'STANDING_ACCESS', 'SSH_COMMAND_AUDIT', 'RDP_FILE_TRANSFER', 'CERTIFICATE_VALIDATION'
+// Valid features are listed in types.FeatureNames
 //
 // Returns a types.Settings response or types.ErrorResponse based on the
 // response from the API. An error is returned on request failure
@@ -49,15 +47,24 @@ func (s *Service) ListSettings(ctx context.Context) (*types.Settings, *types.Err
 // Example:
 //
 //	// List Settings Feature
-//	resp, dpaerr, err := s.ListSettingsFeature(context.Background(), "MFA_CACHING")
+//	resp, dpaerr, err := s.ListSettingsFeature(context.Background(), types.FeatureMfaCaching)
 //	if err != nil {
 //		log.Fatalf("Failed to retrieve setting. %s", err)
 //		return
 //	}
-func (s *Service) ListSettingsFeature(ctx context.Context, f string) (*types.FeatureSetting, *types.ErrorResponse, error) {
+func (s *Service) ListSettingsFeature(ctx context.Context, f types.FeatureName) (*types.FeatureSetting, *types.ErrorResponse, error) {
 	// Set a timeout for the request
 	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
 
+	// Validate provided feature
+	if !f.Valid() {
+		defer cancelCtx()
+		return nil, nil, fmt.Errorf("getSettings: Invalid feature provided %s. Valid options are %s", f, strings.Join(enumNames(types.FeatureNames), ", "))
+	}
+
+	var featureSetting types.FeatureSetting
+	var errorResponse types.ErrorResponse
+
 	// Make request for specific setting via service client
 	if err := s.client.Get(ctx, fmt.Sprintf("%s/%s", "/settings", f), &featureSetting, &errorResponse); err != nil {
 		defer cancelCtx()
@@ -75,13 +82,12 @@ func (s *Service) ListSettingsFeature(ctx context.Context, f string) (*types.Fea
 //
 // Example:
 //
-//	// Create Body for UpdateSettings Request
-//	updateSettingsRequest := struct {
-//		IsMfaCachingEnabled  bool `json:"isMfaCachingEnabled,omitempty"`
-//		KeyExpirationTimeSec int  `json:"keyExpirationTimeSec,omitempty"`
-//	}{
-//		true,
-//		3600
+//	// Create Body for UpdateSettings Request, only set features are sent
+//	updateSettingsRequest := types.Settings{
+//		MfaCaching: &types.MfaCaching{
+//			IsMfaCachingEnabled:  types.Bool(true),
+//			KeyExpirationTimeSec: types.Int(3600),
+//		},
 //	}
 //
 //	// Update settings using created struct
@@ -94,6 +100,9 @@ func (s *Service) UpdateSettings(ctx context.Context, p interface{}) (*types.Set
 	// Set a timeout for the request
 	ctx, cancelCtx := context.WithTimeout(ctx, 5*time.Second)
 
+	var settings types.Settings
+	var errorResponse types.ErrorResponse
+
 	// Validate provided type
 	val := reflect.ValueOf(p)
 	if val.Kind() != reflect.Struct {
@@ -2,8 +2,10 @@ package dpa
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -84,8 +86,8 @@ func TestListSettings(t *testing.T) {
 	ns, _ := NewService(ts.URL, "api", false, token)
 
 	got, _, err := ns.ListSettings(context.Background())
-	if got.MfaCaching.KeyExpirationTimeSec != want {
-		t.Errorf("got %v, wanted %v", got.MfaCaching.KeyExpirationTimeSec, want)
+	if *got.MfaCaching.KeyExpirationTimeSec != want {
+		t.Errorf("got %v, wanted %v", *got.MfaCaching.KeyExpirationTimeSec, want)
 	}
 	if err != nil {
 		t.Errorf("ListSettings() error = %v, wantNoErr", err)
@@ -95,7 +97,7 @@ func TestListSettings(t *testing.T) {
 func TestListSettingsFeature(t *testing.T) {
 	var tests = []struct {
 		name     string
-		input    string
+		input    types.FeatureName
 		header   http.ConnState
 		sleep    time.Duration
 		response string
@@ -107,11 +109,11 @@ func TestListSettingsFeature(t *testing.T) {
 			header:   http.StatusBadRequest,
 			response: `{"code":"400","message":"Bad Request","description":"value is not a valid enumeration member; permitted: 'MFA_CACHING', 'STANDING_ACCESS', 'SSH_COMMAND_AUDIT', 'RDP_FILE_TRANSFER', 'CERTIFICATE_VALIDATION' (field: featureName)"}`,
 			sleep:    1 * time.Millisecond,
-			wantErr:  false,
+			wantErr:  true,
 		},
 		{
 			name:     "Valid string provided",
-			input:    "MFA_CACHING",
+			input:    types.FeatureMfaCaching,
 			header:   http.StatusOK,
 			response: `{"feature_name":"MFA_CACHING","feature_conf":{"is_mfa_caching_enabled":true,"key_expiration_time_sec":3600}}`,
 			sleep:    1 * time.Millisecond,
@@ -119,7 +121,7 @@ func TestListSettingsFeature(t *testing.T) {
 		},
 		{
 			name:     "Invalid Token",
-			input:    "MFA_CACHING",
+			input:    types.FeatureMfaCaching,
 			header:   http.StatusUnauthorized,
 			response: `{"code":"DPA_AUTHENTICATION_TOKEN_VALIDATION_FAILED","message":"Authentication failed. If the issue persists, please contact your system administrator.","description":"Authentication token validation failed"}`,
 			sleep:    1 * time.Millisecond,
@@ -127,7 +129,7 @@ func TestListSettingsFeature(t *testing.T) {
 		},
 		{
 			name:     "Timeout",
-			input:    "MFA_CACHING",
+			input:    types.FeatureMfaCaching,
 			header:   http.StatusOK,
 			response: `{"feature_name":"MFA_CACHING","feature_conf":{"is_mfa_caching_enabled":true,"key_expiration_time_sec":3600}}`,
 			sleep:    6 * time.Second,
@@ -215,9 +217,9 @@ func TestUpdateSettings(t *testing.T) {
 		{
 			name: "Invalid Input",
 			input: types.Settings{
-				MfaCaching: types.MfaCaching{
-					IsMfaCachingEnabled:  true,
-					KeyExpirationTimeSec: 3600,
+				MfaCaching: &types.MfaCaching{
+					IsMfaCachingEnabled:  types.Bool(true),
+					KeyExpirationTimeSec: types.Int(3600),
 				},
 			},
 			sleep:    1 * time.Millisecond,
@@ -260,3 +262,35 @@ func TestUpdateSettings(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateSettings_RequestBody(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"mfaCaching":{"isMfaCachingEnabled":false,"keyExpirationTimeSec":3600}}`))
+	}))
+	defer ts.Close()
+
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	// Explicitly disabling a feature must send false rather than dropping it
+	input := types.Settings{
+		MfaCaching: &types.MfaCaching{IsMfaCachingEnabled: types.Bool(false)},
+	}
+	got, _, err := ns.UpdateSettings(context.Background(), input)
+	if err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+	if want := `{"mfaCaching":{"isMfaCachingEnabled":false}}`; strings.TrimSpace(body) != want {
+		t.Errorf("UpdateSettings() request body = %s, want %s", body, want)
+	}
+	if got.MfaCaching == nil || got.MfaCaching.IsMfaCachingEnabled == nil || *got.MfaCaching.IsMfaCachingEnabled {
+		t.Errorf("UpdateSettings() response not decoded: %+v", got.MfaCaching)
+	}
+	if got.SSHCommandAudit != nil {
+		t.Errorf("UpdateSettings() unset feature decoded as non nil")
+	}
+}
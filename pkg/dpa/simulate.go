@@ -0,0 +1,546 @@
+package dpa
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Protocols understood by the access simulator.
+const (
+	ProtocolSSH = "ssh"
+	ProtocolRDP = "rdp"
+)
+
+// Identity describes the user attempting to connect. Names are matched
+// case-insensitively against the users, groups and roles of a rule.
+type Identity struct {
+	User   string
+	Groups []string
+	Roles  []string
+}
+
+// Target describes the machine being connected to.
+//
+//	Provider - One of types.ProviderAWS, types.ProviderAzure, types.ProviderGCP or types.ProviderOnPrem
+//	Account - AWS account ID, Azure subscription or GCP project
+//	Region - Cloud region of the machine
+//	Network - AWS/GCP VPC ID or Azure VNet ID
+//	ResourceGroup - Azure resource group
+//	Tags - AWS/Azure tags or GCP labels
+//	FQDN - Fully qualified domain name, used for OnPrem machines
+//	Protocol - ProtocolSSH or ProtocolRDP. If empty SSH is preferred.
+type Target struct {
+	Provider      types.Provider    `json:"provider,omitempty"`
+	Account       string            `json:"account,omitempty"`
+	Region        string            `json:"region,omitempty"`
+	Network       string            `json:"network,omitempty"`
+	ResourceGroup string            `json:"resourceGroup,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	FQDN          string            `json:"fqdn,omitempty"`
+	Protocol      string            `json:"protocol,omitempty"`
+}
+
+// ConnectAsUser describes the account a matching rule would connect with.
+// User is empty for ephemeral users, which are created in the domain when
+// DomainUser is set and added to AssignGroups and AssignDomainGroups.
+type ConnectAsUser struct {
+	Protocol           string
+	User               string
+	EphemeralUser      bool
+	DomainUser         bool
+	AssignGroups       []string
+	AssignDomainGroups []string
+}
+
+// RuleMatch identifies the policy rule which grants access
+type RuleMatch struct {
+	PolicyID   string
+	PolicyName string
+	RuleName   string
+	ConnectAs  ConnectAsUser
+}
+
+// RuleRejection lists the reasons a policy rule does not grant access
+type RuleRejection struct {
+	PolicyID   string
+	PolicyName string
+	RuleName   string
+	Reasons    []string
+}
+
+// AccessDecision is the result of an access simulation
+type AccessDecision struct {
+	Allowed    bool
+	Match      *RuleMatch
+	Rejections []RuleRejection
+}
+
+// SimulateAccess evaluates the provided policies offline and decides
+// whether the identity may connect to the target at the provided time.
+// Policies and rules are evaluated in order and the first matching rule
+// is returned. Every rule that does not match is listed with the reasons
+// it was rejected (status, date range, identity, scope, connect as and schedule).
+//
+// Returns an AccessDecision or an error if the target is invalid.
+//
+// Example:
+//
+//	identity := dpa.Identity{User: "alice@example.com", Roles: []string{"DevOps"}}
+//	target := dpa.Target{Provider: types.ProviderAWS, Region: "us-east-1", Protocol: dpa.ProtocolSSH}
+//
+//	decision, err := dpa.SimulateAccess(policies, identity, target, time.Now())
+//	if err != nil {
+//		log.Fatalf("Failed to simulate access. %s", err)
+//		return
+//	}
+func SimulateAccess(policies []types.Policy, id Identity, target Target, at time.Time) (*AccessDecision, error) {
+	if err := validateTarget(target); err != nil {
+		return nil, fmt.Errorf("simulateAccess: %s", err)
+	}
+
+	decision := &AccessDecision{}
+	for _, p := range policies {
+		if len(p.UserAccessRules) == 0 {
+			decision.Rejections = append(decision.Rejections, RuleRejection{
+				PolicyID:   p.PolicyID,
+				PolicyName: p.PolicyName,
+				Reasons:    []string{"policy has no user access rules"},
+			})
+			continue
+		}
+
+		for _, r := range p.UserAccessRules {
+			var reasons []string
+			reasons = append(reasons, policyStatusReasons(p)...)
+			reasons = append(reasons, policyDateReasons(p, r.ConnectionInformation.TimeZone, at)...)
+			reasons = append(reasons, identityReasons(r.UserData, id)...)
+			reasons = append(reasons, scopeReasons(p, target)...)
+			connectAs, err := resolveConnectAs(r.ConnectionInformation.ConnectAs, target)
+			if err != nil {
+				reasons = append(reasons, err.Error())
+			}
+			reasons = append(reasons, scheduleReasons(r.ConnectionInformation, at)...)
+
+			if len(reasons) > 0 {
+				decision.Rejections = append(decision.Rejections, RuleRejection{
+					PolicyID:   p.PolicyID,
+					PolicyName: p.PolicyName,
+					RuleName:   r.RuleName,
+					Reasons:    reasons,
+				})
+				continue
+			}
+
+			if decision.Match == nil {
+				decision.Allowed = true
+				decision.Match = &RuleMatch{
+					PolicyID:   p.PolicyID,
+					PolicyName: p.PolicyName,
+					RuleName:   r.RuleName,
+					ConnectAs:  connectAs,
+				}
+			}
+		}
+	}
+
+	return decision, nil
+}
+
+// Validates the provider and protocol of a target
+func validateTarget(t Target) error {
+	if len(t.Provider) == 0 {
+		return fmt.Errorf("Target provider cannot be empty")
+	}
+	if _, err := t.Provider.MarshalText(); err != nil {
+		return err
+	}
+	if len(t.Protocol) != 0 && t.Protocol != ProtocolSSH && t.Protocol != ProtocolRDP {
+		return fmt.Errorf("Invalid protocol %s. Valid options are %s, %s", t.Protocol, ProtocolSSH, ProtocolRDP)
+	}
+	return nil
+}
+
+// Returns a reason if the policy is not enabled
+func policyStatusReasons(p types.Policy) []string {
+	if p.Status != types.PolicyStatusEnabled {
+		return []string{fmt.Sprintf("policy status is %q", p.Status)}
+	}
+	return nil
+}
+
+// Returns reasons if the time falls outside of the policy start and end
+// dates. Dates are evaluated in the time zone of the rule.
+func policyDateReasons(p types.Policy, tz string, at time.Time) []string {
+	loc, err := loadTimeZone(tz)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var reasons []string
+	if len(p.StartDate) != 0 {
+		start, err := parsePolicyDate(p.StartDate, loc)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		} else if at.Before(start) {
+			reasons = append(reasons, fmt.Sprintf("policy starts on %s", p.StartDate))
+		}
+	}
+	if len(p.EndDate) != 0 {
+		end, err := parsePolicyDate(p.EndDate, loc)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		} else if !at.Before(end.AddDate(0, 0, 1)) {
+			reasons = append(reasons, fmt.Sprintf("policy ended on %s", p.EndDate))
+		}
+	}
+	return reasons
+}
+
+// Returns a reason if the identity is not assigned to the rule
+func identityReasons(u types.UserData, id Identity) []string {
+	for _, user := range u.Users {
+		if len(id.User) != 0 && strings.EqualFold(user.Name, id.User) {
+			return nil
+		}
+	}
+	for _, group := range u.Groups {
+		if containsFold(id.Groups, group.Name) {
+			return nil
+		}
+	}
+	for _, role := range u.Roles {
+		if containsFold(id.Roles, role.Name) {
+			return nil
+		}
+	}
+	return []string{"identity is not assigned to the rule as a user, group or role"}
+}
+
+// Returns reasons if the target is outside of the policy scope
+func scopeReasons(p types.Policy, t Target) []string {
+	if !providerConfigured(p, t.Provider) {
+		return []string{fmt.Sprintf("policy does not include provider %s", t.Provider)}
+	}
+
+	var reasons []string
+	add := func(reason string) {
+		if len(reason) != 0 {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	pd := p.ProvidersData
+	switch t.Provider {
+	case types.ProviderAWS:
+		aws := deref(pd.Aws)
+		add(matchValue("account", t.Account, aws.AccountIds))
+		add(matchValue("region", t.Region, aws.Regions))
+		add(matchValue("vpc", t.Network, aws.VpcIds))
+		add(matchTags("tag", t.Tags, aws.Tags))
+	case types.ProviderAzure:
+		azure := deref(pd.Azure)
+		add(matchValue("subscription", t.Account, azure.Subscriptions))
+		add(matchValue("region", t.Region, azure.Regions))
+		add(matchValue("vnet", t.Network, azure.VnetIds))
+		add(matchValue("resource group", t.ResourceGroup, azure.ResourceGroups))
+		add(matchTags("tag", t.Tags, azure.Tags))
+	case types.ProviderGCP:
+		gcp := deref(pd.Gcp)
+		add(matchValue("project", t.Account, gcp.Projects))
+		add(matchValue("region", t.Region, gcp.Regions))
+		add(matchValue("vpc", t.Network, gcp.VpcIds))
+		add(matchTags("label", t.Tags, labelsToTags(gcp.Labels)))
+	case types.ProviderOnPrem:
+		if !matchFqdnRules(deref(pd.OnPrem), t.FQDN) {
+			add(fmt.Sprintf("fqdn %q does not match the policy fqdn rules", t.FQDN))
+		}
+	}
+	return reasons
+}
+
+// Determines if a provider is part of the policy. A provider is included
+// when its scope is set or when any rule defines a connect as user for it.
+func providerConfigured(p types.Policy, provider types.Provider) bool {
+	pd := p.ProvidersData
+	switch provider {
+	case types.ProviderAWS:
+		if pd.Aws != nil {
+			return true
+		}
+	case types.ProviderAzure:
+		if pd.Azure != nil {
+			return true
+		}
+	case types.ProviderGCP:
+		if pd.Gcp != nil {
+			return true
+		}
+	case types.ProviderOnPrem:
+		if pd.OnPrem != nil {
+			return true
+		}
+	}
+
+	for _, r := range p.UserAccessRules {
+		ca := r.ConnectionInformation.ConnectAs
+		switch provider {
+		case types.ProviderAWS:
+			if ca.Aws != nil {
+				return true
+			}
+		case types.ProviderAzure:
+			if ca.Azure != nil {
+				return true
+			}
+		case types.ProviderGCP:
+			if ca.Gcp != nil {
+				return true
+			}
+		case types.ProviderOnPrem:
+			if ca.OnPrem != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the connect as user for the target provider and protocol
+func resolveConnectAs(ca types.ConnectAs, t Target) (ConnectAsUser, error) {
+	var ssh string
+	var rdp *types.Rdp
+	switch t.Provider {
+	case types.ProviderAWS:
+		ssh, rdp = deref(ca.Aws).SSH, deref(ca.Aws).Rdp
+	case types.ProviderAzure:
+		ssh, rdp = deref(ca.Azure).SSH, deref(ca.Azure).Rdp
+	case types.ProviderGCP:
+		ssh, rdp = deref(ca.Gcp).SSH, deref(ca.Gcp).Rdp
+	case types.ProviderOnPrem:
+		ssh, rdp = deref(ca.OnPrem).SSH, deref(ca.OnPrem).Rdp
+	}
+
+	switch {
+	case t.Protocol == ProtocolRDP && rdp != nil, len(t.Protocol) == 0 && len(ssh) == 0 && rdp != nil:
+		switch {
+		case rdp.DomainEphemeralUser != nil:
+			return ConnectAsUser{
+				Protocol:           ProtocolRDP,
+				EphemeralUser:      true,
+				DomainUser:         true,
+				AssignGroups:       rdp.DomainEphemeralUser.AssignGroups,
+				AssignDomainGroups: rdp.DomainEphemeralUser.AssignDomainGroups,
+			}, nil
+		case len(rdp.User) != 0:
+			return ConnectAsUser{Protocol: ProtocolRDP, User: rdp.User}, nil
+		}
+		return ConnectAsUser{
+			Protocol:      ProtocolRDP,
+			EphemeralUser: true,
+			AssignGroups:  deref(rdp.LocalEphemeralUser).AssignGroups,
+		}, nil
+	case t.Protocol != ProtocolRDP && len(ssh) != 0:
+		return ConnectAsUser{Protocol: ProtocolSSH, User: ssh}, nil
+	}
+
+	protocol := t.Protocol
+	if len(protocol) == 0 {
+		protocol = "ssh or rdp"
+	}
+	return ConnectAsUser{}, fmt.Errorf("rule has no %s connect as user for %s", protocol, t.Provider)
+}
+
+// Returns reasons if the time falls outside of the rule schedule
+func scheduleReasons(ci types.ConnectionInformation, at time.Time) []string {
+	loc, err := loadTimeZone(ci.TimeZone)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	local := at.In(loc)
+	day := local.Weekday()
+
+	if ci.FullDays || (len(ci.HoursFrom) == 0 && len(ci.HoursTo) == 0) {
+		if !dayAllowed(ci.DaysOfWeek, day) {
+			return []string{fmt.Sprintf("day %s not in allowed days %v (%s)", shortWeekday(day), ci.DaysOfWeek, loc)}
+		}
+		return nil
+	}
+
+	from, err := parseClock(ci.HoursFrom)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	to, err := parseClock(ci.HoursTo)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	// Windows ending before they start continue past midnight and belong
+	// to the day on which they started. Equal hours are a window of 24
+	// hours from HoursFrom, as in ExpandAccessWindows.
+	now := local.Hour()*60 + local.Minute()
+	var open bool
+	if from < to {
+		open = dayAllowed(ci.DaysOfWeek, day) && now >= from && now < to
+	} else {
+		open = (dayAllowed(ci.DaysOfWeek, day) && now >= from) ||
+			(dayAllowed(ci.DaysOfWeek, (day+6)%7) && now < to)
+	}
+	if open {
+		return nil
+	}
+
+	if !dayAllowed(ci.DaysOfWeek, day) && from < to {
+		return []string{fmt.Sprintf("day %s not in allowed days %v (%s)", shortWeekday(day), ci.DaysOfWeek, loc)}
+	}
+	return []string{fmt.Sprintf("time %s on %s outside allowed hours %s-%s (%s)", local.Format("15:04"), shortWeekday(day), ci.HoursFrom, ci.HoursTo, loc)}
+}
+
+// Determines if a value is in the allowed list. An empty list allows all values.
+func matchValue(field, value string, allowed []string) string {
+	if len(allowed) == 0 || containsFold(allowed, value) {
+		return ""
+	}
+	return fmt.Sprintf("%s %q not in %v", field, value, allowed)
+}
+
+// Determines if the target tags satisfy the policy tags. Every policy tag
+// must be present on the target and, when values are listed, the target
+// value must be one of them.
+func matchTags(field string, tags map[string]string, want []types.Tags) string {
+	for _, w := range want {
+		v, ok := tags[w.Key]
+		if !ok {
+			return fmt.Sprintf("%s %q not present", field, w.Key)
+		}
+		if len(w.Value) != 0 && !slices.Contains(w.Value, v) {
+			return fmt.Sprintf("%s %s=%q not in %v", field, w.Key, v, w.Value)
+		}
+	}
+	return ""
+}
+
+// Converts GCP labels so they can be evaluated like tags
+func labelsToTags(labels []types.Labels) []types.Tags {
+	tags := make([]types.Tags, 0, len(labels))
+	for _, l := range labels {
+		tags = append(tags, types.Tags{Key: l.Key, Value: l.Value})
+	}
+	return tags
+}
+
+// Evaluates the OnPrem FQDN rules against a fully qualified domain name.
+// Rules are combined with OR unless the conjunction is AND. A scope with
+// no rules matches nothing.
+func matchFqdnRules(o types.OnPrem, fqdn string) bool {
+	if len(o.FqdnRules) == 0 || len(fqdn) == 0 {
+		return false
+	}
+
+	and := strings.EqualFold(o.FqdnRulesConjunction, "AND")
+	for _, rule := range o.FqdnRules {
+		ok := matchFqdnRule(rule, fqdn)
+		if and && !ok {
+			return false
+		}
+		if !and && ok {
+			return true
+		}
+	}
+	return and
+}
+
+// Evaluates a single FQDN rule. The computer name is the first label of
+// the FQDN and the remainder must equal or end with the rule domain.
+// Valid operators are EXACTLY, WILDCARD, PREFIX, SUFFIX and CONTAINS.
+func matchFqdnRule(rule types.FqdnRules, fqdn string) bool {
+	name, domain, _ := strings.Cut(strings.ToLower(fqdn), ".")
+	if len(rule.Domain) != 0 {
+		d := strings.ToLower(rule.Domain)
+		if domain != d && !strings.HasSuffix(domain, "."+d) {
+			return false
+		}
+	}
+
+	pattern := strings.ToLower(rule.ComputernamePattern)
+	switch strings.ToUpper(rule.Operator) {
+	case "EXACTLY":
+		return name == pattern
+	case "WILDCARD":
+		ok, _ := path.Match(pattern, name)
+		return ok
+	case "PREFIX":
+		return strings.HasPrefix(name, pattern)
+	case "SUFFIX":
+		return strings.HasSuffix(name, pattern)
+	case "CONTAINS":
+		return strings.Contains(name, pattern)
+	}
+	return false
+}
+
+// Loads a time zone, defaulting to UTC when empty
+func loadTimeZone(tz string) (*time.Location, error) {
+	if len(tz) == 0 {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q", tz)
+	}
+	return loc, nil
+}
+
+// Parses a policy start or end date in the provided location
+func parsePolicyDate(d string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02", d, loc)
+	if err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, d); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid policy date %q", d)
+}
+
+// Parses an HH:MM value into minutes since midnight
+func parseClock(c string) (int, error) {
+	t, err := time.Parse("15:04", c)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", c)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Determines if a weekday is allowed. No days allows every day.
+func dayAllowed(days []types.DayOfWeek, d time.Weekday) bool {
+	return len(days) == 0 || slices.Contains(days, shortWeekday(d))
+}
+
+// Returns the three letter day name used by the API (e.g. "Mon")
+func shortWeekday(d time.Weekday) types.DayOfWeek {
+	return types.DayOfWeek(d.String()[:3])
+}
+
+func containsFold(s []string, v string) bool {
+	for _, e := range s {
+		if strings.EqualFold(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the value of an optional field, or its zero value when nil
+func deref[T any](v *T) T {
+	if v == nil {
+		var zero T
+		return zero
+	}
+	return *v
+}
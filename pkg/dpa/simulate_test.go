@@ -0,0 +1,411 @@
+package dpa
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Sample policies used by the access simulator tests
+var simulatorPolicies = []types.Policy{
+	{
+		PolicyID:   "c12f982a-ab1a-12ab-1a31-f221aa31836a",
+		PolicyName: "AWS Business Hours",
+		Status:     "Enabled",
+		ProvidersData: types.ProvidersData{
+			Aws: &types.Aws{
+				Regions:    []string{"us-east-1"},
+				AccountIds: []string{"123456789012"},
+				Tags: []types.Tags{
+					{Key: "env", Value: []string{"prod", "dev"}},
+				},
+			},
+		},
+		StartDate: "2024-01-01",
+		EndDate:   "2024-12-31",
+		UserAccessRules: []types.UserAccessRules{
+			{
+				RuleName: "DevOps SSH",
+				UserData: types.UserData{
+					Roles: []types.Roles{{Name: "DevOps"}},
+				},
+				ConnectionInformation: types.ConnectionInformation{
+					ConnectAs: types.ConnectAs{
+						Aws: &types.ConnectAsAws{SSH: "ec2-user"},
+					},
+					DaysOfWeek: []types.DayOfWeek{"Mon", "Tue", "Wed", "Thu", "Fri"},
+					HoursFrom:  "08:00",
+					HoursTo:    "18:00",
+					TimeZone:   "America/New_York",
+				},
+			},
+		},
+	},
+	{
+		PolicyID:   "01a4f891-1591-4acb-ae3f-f27e56d45499",
+		PolicyName: "OnPrem Night Shift",
+		Status:     "Enabled",
+		ProvidersData: types.ProvidersData{
+			OnPrem: &types.OnPrem{
+				FqdnRulesConjunction: "OR",
+				FqdnRules: []types.FqdnRules{
+					{Operator: "PREFIX", ComputernamePattern: "prod", Domain: "example.local"},
+					{Operator: "WILDCARD", ComputernamePattern: "db-*", Domain: "example.local"},
+				},
+			},
+		},
+		UserAccessRules: []types.UserAccessRules{
+			{
+				RuleName: "Night Shift RDP",
+				UserData: types.UserData{
+					Groups: []types.Groups{{Name: "Operators"}},
+				},
+				ConnectionInformation: types.ConnectionInformation{
+					ConnectAs: types.ConnectAs{
+						OnPrem: &types.ConnectAsOnPrem{
+							Rdp: &types.Rdp{
+								LocalEphemeralUser: &types.LocalEphemeralUser{
+									AssignGroups: []string{"Remote Desktop Users"},
+								},
+							},
+						},
+					},
+					DaysOfWeek: []types.DayOfWeek{"Fri"},
+					HoursFrom:  "22:00",
+					HoursTo:    "06:00",
+					TimeZone:   "UTC",
+				},
+			},
+		},
+	},
+	{
+		PolicyID:   "76321c1a-32ff-488e-af40-b7ae5eefb808",
+		PolicyName: "Disabled GCP",
+		Status:     "Disabled",
+		ProvidersData: types.ProvidersData{
+			Gcp: &types.Gcp{Projects: []string{"my-project"}},
+		},
+		UserAccessRules: []types.UserAccessRules{
+			{
+				RuleName: "Everyone",
+				UserData: types.UserData{
+					Users: []types.Users{{Name: "alice@example.com"}},
+				},
+				ConnectionInformation: types.ConnectionInformation{
+					ConnectAs: types.ConnectAs{
+						Gcp: &types.ConnectAsGcp{SSH: "gcp-user"},
+					},
+					FullDays: true,
+				},
+			},
+		},
+	},
+}
+
+func TestSimulateAccess(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %s", err)
+	}
+
+	var tests = []struct {
+		name       string
+		identity   Identity
+		target     Target
+		at         time.Time
+		wantAllow  bool
+		wantPolicy string
+		wantUser   string
+		wantReason string
+		wantErr    bool
+	}{
+		{
+			name:     "Invalid Empty Provider",
+			identity: Identity{User: "alice@example.com"},
+			target:   Target{},
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid Protocol",
+			identity: Identity{User: "alice@example.com"},
+			target:   Target{Provider: types.ProviderAWS, Protocol: "telnet"},
+			wantErr:  true,
+		},
+		{
+			name:       "Valid AWS Business Hours",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"devops"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "prod"}},
+			at:         time.Date(2024, 3, 5, 10, 0, 0, 0, newYork),
+			wantAllow:  true,
+			wantPolicy: "AWS Business Hours",
+			wantUser:   "ec2-user",
+		},
+		{
+			name:       "Denied AWS Outside Hours",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"DevOps"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "prod"}},
+			at:         time.Date(2024, 3, 5, 21, 0, 0, 0, newYork),
+			wantReason: "outside allowed hours 08:00-18:00",
+		},
+		{
+			name:       "Denied AWS Weekend",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"DevOps"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "prod"}},
+			at:         time.Date(2024, 3, 9, 10, 0, 0, 0, newYork),
+			wantReason: "day Sat not in allowed days",
+		},
+		{
+			name:       "Denied AWS Region",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"DevOps"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "eu-west-1", Tags: map[string]string{"env": "prod"}},
+			at:         time.Date(2024, 3, 5, 10, 0, 0, 0, newYork),
+			wantReason: `region "eu-west-1" not in`,
+		},
+		{
+			name:       "Denied AWS Tag Value",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"DevOps"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "qa"}},
+			at:         time.Date(2024, 3, 5, 10, 0, 0, 0, newYork),
+			wantReason: `tag env="qa" not in`,
+		},
+		{
+			name:       "Denied AWS Policy Expired",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"DevOps"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "prod"}},
+			at:         time.Date(2025, 3, 4, 10, 0, 0, 0, newYork),
+			wantReason: "policy ended on 2024-12-31",
+		},
+		{
+			name:       "Denied AWS Identity",
+			identity:   Identity{User: "bob@example.com", Roles: []string{"Finance"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "prod"}},
+			at:         time.Date(2024, 3, 5, 10, 0, 0, 0, newYork),
+			wantReason: "identity is not assigned",
+		},
+		{
+			name:       "Denied AWS RDP Not Configured",
+			identity:   Identity{User: "alice@example.com", Roles: []string{"DevOps"}},
+			target:     Target{Provider: types.ProviderAWS, Account: "123456789012", Region: "us-east-1", Tags: map[string]string{"env": "prod"}, Protocol: ProtocolRDP},
+			at:         time.Date(2024, 3, 5, 10, 0, 0, 0, newYork),
+			wantReason: "rule has no rdp connect as user for AWS",
+		},
+		{
+			name:       "Valid OnPrem Overnight Window",
+			identity:   Identity{User: "carol@example.com", Groups: []string{"Operators"}},
+			target:     Target{Provider: types.ProviderOnPrem, FQDN: "db-01.example.local", Protocol: ProtocolRDP},
+			at:         time.Date(2024, 3, 9, 3, 0, 0, 0, time.UTC),
+			wantAllow:  true,
+			wantPolicy: "OnPrem Night Shift",
+		},
+		{
+			name:       "Denied OnPrem FQDN",
+			identity:   Identity{User: "carol@example.com", Groups: []string{"Operators"}},
+			target:     Target{Provider: types.ProviderOnPrem, FQDN: "web-01.example.local", Protocol: ProtocolRDP},
+			at:         time.Date(2024, 3, 9, 3, 0, 0, 0, time.UTC),
+			wantReason: "does not match the policy fqdn rules",
+		},
+		{
+			name:       "Denied GCP Disabled Policy",
+			identity:   Identity{User: "alice@example.com"},
+			target:     Target{Provider: types.ProviderGCP, Account: "my-project"},
+			at:         time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC),
+			wantReason: `policy status is "Disabled"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SimulateAccess(simulatorPolicies, tt.identity, tt.target, tt.at)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("SimulateAccess() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SimulateAccess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got.Allowed != tt.wantAllow {
+				t.Fatalf("SimulateAccess() allowed = %v, want %v (rejections %v)", got.Allowed, tt.wantAllow, got.Rejections)
+			}
+			if tt.wantAllow {
+				if got.Match.PolicyName != tt.wantPolicy {
+					t.Errorf("SimulateAccess() policy = %s, want %s", got.Match.PolicyName, tt.wantPolicy)
+				}
+				if got.Match.ConnectAs.User != tt.wantUser {
+					t.Errorf("SimulateAccess() connect as = %s, want %s", got.Match.ConnectAs.User, tt.wantUser)
+				}
+				return
+			}
+
+			var found bool
+			for _, r := range got.Rejections {
+				for _, reason := range r.Reasons {
+					if strings.Contains(reason, tt.wantReason) {
+						found = true
+					}
+				}
+			}
+			if !found {
+				t.Errorf("SimulateAccess() missing reason %q in %v", tt.wantReason, got.Rejections)
+			}
+		})
+	}
+}
+
+func TestScheduleReasons(t *testing.T) {
+	// A Monday window with equal hours lasts until Tuesday 08:00
+	ci := types.ConnectionInformation{
+		DaysOfWeek: []types.DayOfWeek{types.Monday},
+		HoursFrom:  "08:00",
+		HoursTo:    "08:00",
+		TimeZone:   "UTC",
+	}
+
+	var tests = []struct {
+		name     string
+		at       time.Time
+		wantOpen bool
+	}{
+		{name: "Before Start", at: time.Date(2024, 3, 4, 7, 59, 0, 0, time.UTC)},
+		{name: "At Start", at: time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC), wantOpen: true},
+		{name: "Past Midnight", at: time.Date(2024, 3, 5, 7, 59, 0, 0, time.UTC), wantOpen: true},
+		{name: "At End", at: time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reasons := scheduleReasons(ci, tt.at)
+			if (len(reasons) == 0) != tt.wantOpen {
+				t.Errorf("scheduleReasons() = %v, want open %v", reasons, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestMatchFqdnRules(t *testing.T) {
+	var tests = []struct {
+		name   string
+		onPrem types.OnPrem
+		fqdn   string
+		want   bool
+	}{
+		{
+			name: "Exactly",
+			onPrem: types.OnPrem{FqdnRules: []types.FqdnRules{
+				{Operator: "EXACTLY", ComputernamePattern: "web01", Domain: "example.local"},
+			}},
+			fqdn: "WEB01.example.local",
+			want: true,
+		},
+		{
+			name: "Sub Domain",
+			onPrem: types.OnPrem{FqdnRules: []types.FqdnRules{
+				{Operator: "SUFFIX", ComputernamePattern: "01", Domain: "example.local"},
+			}},
+			fqdn: "web01.prod.example.local",
+			want: true,
+		},
+		{
+			name: "Wrong Domain",
+			onPrem: types.OnPrem{FqdnRules: []types.FqdnRules{
+				{Operator: "CONTAINS", ComputernamePattern: "web", Domain: "example.local"},
+			}},
+			fqdn: "web01.example.com",
+			want: false,
+		},
+		{
+			name: "And Conjunction",
+			onPrem: types.OnPrem{FqdnRulesConjunction: "AND", FqdnRules: []types.FqdnRules{
+				{Operator: "PREFIX", ComputernamePattern: "web", Domain: "example.local"},
+				{Operator: "SUFFIX", ComputernamePattern: "02", Domain: "example.local"},
+			}},
+			fqdn: "web01.example.local",
+			want: false,
+		},
+		{
+			name:   "No Rules",
+			onPrem: types.OnPrem{},
+			fqdn:   "web01.example.local",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchFqdnRules(tt.onPrem, tt.fqdn); got != tt.want {
+				t.Errorf("matchFqdnRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveConnectAs(t *testing.T) {
+	ca := types.ConnectAs{
+		Azure: &types.ConnectAsAzure{
+			Rdp: &types.Rdp{
+				DomainEphemeralUser: &types.DomainEphemeralUser{
+					AssignGroups:       []string{"Remote Desktop Users"},
+					AssignDomainGroups: []string{"Domain Operators"},
+				},
+			},
+		},
+		Gcp:    &types.ConnectAsGcp{SSH: "gcp-user", Rdp: &types.Rdp{User: "svc-rdp"}},
+		OnPrem: &types.ConnectAsOnPrem{SSH: "admin"},
+	}
+
+	var tests = []struct {
+		name    string
+		target  Target
+		want    ConnectAsUser
+		wantErr bool
+	}{
+		{
+			name:   "Azure Domain Ephemeral User",
+			target: Target{Provider: types.ProviderAzure},
+			want: ConnectAsUser{
+				Protocol:           ProtocolRDP,
+				EphemeralUser:      true,
+				DomainUser:         true,
+				AssignGroups:       []string{"Remote Desktop Users"},
+				AssignDomainGroups: []string{"Domain Operators"},
+			},
+		},
+		{
+			name:   "GCP Existing RDP User",
+			target: Target{Provider: types.ProviderGCP, Protocol: ProtocolRDP},
+			want:   ConnectAsUser{Protocol: ProtocolRDP, User: "svc-rdp"},
+		},
+		{
+			name:   "GCP Prefers SSH",
+			target: Target{Provider: types.ProviderGCP},
+			want:   ConnectAsUser{Protocol: ProtocolSSH, User: "gcp-user"},
+		},
+		{
+			name:   "OnPrem SSH",
+			target: Target{Provider: types.ProviderOnPrem, Protocol: ProtocolSSH},
+			want:   ConnectAsUser{Protocol: ProtocolSSH, User: "admin"},
+		},
+		{
+			name:    "OnPrem RDP Not Configured",
+			target:  Target{Provider: types.ProviderOnPrem, Protocol: ProtocolRDP},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveConnectAs(ca, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveConnectAs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveConnectAs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+package dpa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+	"sigs.k8s.io/yaml"
+)
+
+// VariableType is the type of a template variable
+type VariableType string
+
+const (
+	VariableString VariableType = "string"
+	VariableInt    VariableType = "int"
+	VariableBool   VariableType = "bool"
+	VariableList   VariableType = "list"
+	VariableMap    VariableType = "map"
+)
+
+// TemplateVariable declares a variable used by a policy template.
+// Variables without a default are required.
+type TemplateVariable struct {
+	Type        VariableType `json:"type"`
+	Default     interface{}  `json:"default,omitempty"`
+	Description string       `json:"description,omitempty"`
+}
+
+// TemplateVariables is a variables file. It declares the variables and
+// lists one set of values per policy to render.
+//
+//	variables:
+//	  team: {type: string}
+//	  accountIds: {type: list}
+//	  grantHours: {type: int, default: 4}
+//	instances:
+//	  - team: payments
+//	    accountIds: ["123456789012"]
+type TemplateVariables struct {
+	Variables map[string]TemplateVariable `json:"variables"`
+	Instances []map[string]interface{}    `json:"instances"`
+}
+
+// PolicyTemplate is a Go text/template which renders a types.Policy as
+// YAML or JSON. Variables are available as fields of the dot, for example
+// {{ .team }}. Besides the standard functions the template may use json,
+// quote, join, lower and upper, e.g. accountIds: {{ json .accountIds }}.
+type PolicyTemplate struct {
+	Name     string
+	template *template.Template
+}
+
+// TemplateAction is the change ApplyTemplate makes for a rendered policy
+type TemplateAction string
+
+const (
+	TemplateCreate    TemplateAction = "create"
+	TemplateUpdate    TemplateAction = "update"
+	TemplateUnchanged TemplateAction = "unchanged"
+)
+
+// TemplateResult reports the outcome of applying one rendered policy.
+// Differences lists how the tenant's policy differs from the rendered one
+// and Applied is true once the change was sent to the API.
+type TemplateResult struct {
+	PolicyName  string             `json:"policyName"`
+	PolicyID    string             `json:"policyId,omitempty"`
+	Action      TemplateAction     `json:"action"`
+	Differences []PolicyDifference `json:"differences,omitempty"`
+	Applied     bool               `json:"applied"`
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"quote": func(v interface{}) string {
+		b, _ := json.Marshal(fmt.Sprint(v))
+		return string(b)
+	},
+	"join": func(sep string, v []string) string {
+		return strings.Join(v, sep)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// ParsePolicyTemplate parses a policy template. Referencing a variable
+// which has no value is an error when the template is rendered.
+//
+// Example:
+//
+//	t, err := dpa.ParsePolicyTemplate("team", `
+//	policyName: {{ .team }} access
+//	status: Enabled
+//	providersData:
+//	  AWS:
+//	    accountIds: {{ json .accountIds }}
+//	...`)
+func ParsePolicyTemplate(name, text string) (*PolicyTemplate, error) {
+	t, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsePolicyTemplate: Failed to parse template. %s", err)
+	}
+	return &PolicyTemplate{Name: name, template: t}, nil
+}
+
+// LoadPolicyTemplateFile parses a policy template from a file
+//
+// Example:
+//
+//	t, err := dpa.LoadPolicyTemplateFile("team-policy.yaml.tmpl")
+//	if err != nil {
+//		log.Fatalf("Failed to load template. %s", err)
+//		return
+//	}
+func LoadPolicyTemplateFile(name string) (*PolicyTemplate, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadPolicyTemplateFile: Failed to read template. %s", err)
+	}
+	return ParsePolicyTemplate(name, string(b))
+}
+
+// ReadTemplateVariables reads a YAML or JSON variables file and checks
+// every instance against the declared variables.
+//
+// Example:
+//
+//	vars, err := dpa.ReadTemplateVariables(os.Stdin)
+//	if err != nil {
+//		log.Fatalf("Failed to read variables. %s", err)
+//		return
+//	}
+func ReadTemplateVariables(r io.Reader) (*TemplateVariables, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("readTemplateVariables: Failed to read variables. %s", err)
+	}
+
+	var v TemplateVariables
+	if err := yaml.UnmarshalStrict(b, &v); err != nil {
+		return nil, fmt.Errorf("readTemplateVariables: Failed to parse variables. %s", err)
+	}
+	for name, decl := range v.Variables {
+		switch decl.Type {
+		case VariableString, VariableInt, VariableBool, VariableList, VariableMap:
+		default:
+			return nil, fmt.Errorf("readTemplateVariables: Variable %s has invalid type %q. Valid options are string, int, bool, list, map", name, decl.Type)
+		}
+		if decl.Default != nil {
+			if _, err := coerceVariable(decl.Type, decl.Default); err != nil {
+				return nil, fmt.Errorf("readTemplateVariables: Variable %s has invalid default. %s", name, err)
+			}
+		}
+	}
+	for i := range v.Instances {
+		if _, err := v.Resolve(i); err != nil {
+			return nil, fmt.Errorf("readTemplateVariables: %s", err)
+		}
+	}
+	return &v, nil
+}
+
+// LoadTemplateVariablesFile reads a variables file.
+// See ReadTemplateVariables for the format.
+func LoadTemplateVariablesFile(name string) (*TemplateVariables, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadTemplateVariablesFile: Failed to open variables file. %s", err)
+	}
+	defer f.Close()
+
+	v, err := ReadTemplateVariables(f)
+	if err != nil {
+		return nil, fmt.Errorf("loadTemplateVariablesFile: %s: %s", name, err)
+	}
+	return v, nil
+}
+
+// Resolve returns the typed values of an instance with defaults applied.
+// Unknown variables, missing required variables and values of the wrong
+// type are errors.
+func (v *TemplateVariables) Resolve(instance int) (map[string]interface{}, error) {
+	if instance < 0 || instance >= len(v.Instances) {
+		return nil, fmt.Errorf("Instance %d does not exist", instance)
+	}
+	values := v.Instances[instance]
+
+	resolved := map[string]interface{}{}
+	for name, value := range values {
+		decl, ok := v.Variables[name]
+		if !ok {
+			return nil, fmt.Errorf("Instance %d sets undeclared variable %s", instance, name)
+		}
+		typed, err := coerceVariable(decl.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("Instance %d variable %s: %s", instance, name, err)
+		}
+		resolved[name] = typed
+	}
+	for name, decl := range v.Variables {
+		if _, ok := resolved[name]; ok {
+			continue
+		}
+		if decl.Default == nil {
+			return nil, fmt.Errorf("Instance %d is missing required variable %s", instance, name)
+		}
+		resolved[name], _ = coerceVariable(decl.Type, decl.Default)
+	}
+	return resolved, nil
+}
+
+// Render executes the template with typed values and returns the validated
+// policy. Fields which are not part of types.Policy are errors.
+//
+// Example:
+//
+//	policy, err := t.Render(map[string]interface{}{"team": "payments", "accountIds": []string{"123456789012"}})
+//	if err != nil {
+//		log.Fatalf("Failed to render policy. %s", err)
+//		return
+//	}
+func (t *PolicyTemplate) Render(values map[string]interface{}) (types.Policy, error) {
+	var buf bytes.Buffer
+	if err := t.template.Execute(&buf, values); err != nil {
+		return types.Policy{}, fmt.Errorf("render: Failed to execute template %s. %s", t.Name, err)
+	}
+
+	b, err := yaml.YAMLToJSON(buf.Bytes())
+	if err != nil {
+		return types.Policy{}, fmt.Errorf("render: Template %s did not render valid YAML. %s", t.Name, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	var p types.Policy
+	if err := dec.Decode(&p); err != nil {
+		return types.Policy{}, fmt.Errorf("render: Template %s did not render a policy. %s", t.Name, err)
+	}
+	if err := ValidatePolicy(p); err != nil {
+		return types.Policy{}, fmt.Errorf("render: Policy %q rendered from %s is invalid. %s", p.PolicyName, t.Name, err)
+	}
+	return p, nil
+}
+
+// RenderAll renders one policy per instance of the variables file. Every
+// rendered policy must have a unique name.
+//
+// Example:
+//
+//	policies, err := t.RenderAll(vars)
+//	if err != nil {
+//		log.Fatalf("Failed to render policies. %s", err)
+//		return
+//	}
+func (t *PolicyTemplate) RenderAll(v *TemplateVariables) ([]types.Policy, error) {
+	policies := make([]types.Policy, 0, len(v.Instances))
+	names := map[string]int{}
+	for i := range v.Instances {
+		values, err := v.Resolve(i)
+		if err != nil {
+			return nil, fmt.Errorf("renderAll: %s", err)
+		}
+		p, err := t.Render(values)
+		if err != nil {
+			return nil, fmt.Errorf("renderAll: Instance %d: %s", i, err)
+		}
+		if j, ok := names[p.PolicyName]; ok {
+			return nil, fmt.Errorf("renderAll: Instances %d and %d both render policy %q", j, i, p.PolicyName)
+		}
+		names[p.PolicyName] = i
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// ApplyTemplate renders every instance of the variables file and compares
+// each policy with the tenant's policy of the same name. Missing policies
+// are created with AddPolicy and differing policies are updated with
+// UpdatePolicy. Fields the template leaves empty, such as the status or a
+// role's source, keep their current value, so a template can change but
+// not remove a field. With dryRun set nothing is changed and the results
+// only report what would be done.
+// Returns a TemplateResult per rendered policy or types.ErrorResponse based
+// on the response from the API. On failure the results so far are returned
+// with the error.
+//
+// Example:
+//
+//	results, dpaerr, err := s.ApplyTemplate(context.Background(), t, vars, true)
+//	if err != nil {
+//		log.Fatalf("Failed to apply template. %s", err)
+//		return
+//	}
+//	for _, r := range results {
+//		fmt.Printf("%s %s (%d differences)\n", r.Action, r.PolicyName, len(r.Differences))
+//	}
+func (s *Service) ApplyTemplate(ctx context.Context, t *PolicyTemplate, v *TemplateVariables, dryRun bool) ([]TemplateResult, *types.ErrorResponse, error) {
+	policies, err := t.RenderAll(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("applyTemplate: %s", err)
+	}
+
+	list, dpaerr, err := s.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("applyTemplate: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return nil, dpaerr, nil
+	}
+	ids := map[string][]string{}
+	for _, item := range list.Items {
+		ids[item.PolicyName] = append(ids[item.PolicyName], item.PolicyID)
+	}
+
+	var results []TemplateResult
+	for _, desired := range policies {
+		result := TemplateResult{PolicyName: desired.PolicyName}
+		switch existing := ids[desired.PolicyName]; len(existing) {
+		case 0:
+			result.Action = TemplateCreate
+			result.Differences = DiffPolicies(types.Policy{}, desired)
+		case 1:
+			current, dpaerr, err := s.GetPolicy(ctx, existing[0])
+			if err != nil {
+				return results, nil, fmt.Errorf("applyTemplate: %s", err)
+			}
+			if !dpaerr.Empty() {
+				return results, dpaerr, nil
+			}
+			result.PolicyID = existing[0]
+			desired, err = overlayPolicy(*current, desired)
+			if err != nil {
+				return results, nil, fmt.Errorf("applyTemplate: %s", err)
+			}
+			result.Differences = DiffPolicies(*current, desired)
+			result.Action = TemplateUpdate
+			if len(result.Differences) == 0 {
+				result.Action = TemplateUnchanged
+			}
+		default:
+			return results, nil, fmt.Errorf("applyTemplate: Policy name %q is ambiguous, matching policies %s", desired.PolicyName, strings.Join(existing, ", "))
+		}
+
+		if !dryRun && result.Action != TemplateUnchanged {
+			switch result.Action {
+			case TemplateCreate:
+				added, dpaerr, err := s.AddPolicy(ctx, desired)
+				if err != nil {
+					return results, nil, fmt.Errorf("applyTemplate: %s", err)
+				}
+				if !dpaerr.Empty() {
+					return results, dpaerr, nil
+				}
+				result.PolicyID = added.PolicyID
+			case TemplateUpdate:
+				desired.PolicyID = result.PolicyID
+				_, dpaerr, err := s.UpdatePolicy(ctx, desired, result.PolicyID)
+				if err != nil {
+					return results, nil, fmt.Errorf("applyTemplate: %s", err)
+				}
+				if !dpaerr.Empty() {
+					return results, dpaerr, nil
+				}
+			}
+			result.Applied = true
+		}
+		results = append(results, result)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].PolicyName < results[j].PolicyName })
+	return results, &types.ErrorResponse{}, nil
+}
+
+// Returns current with the fields set in desired replaced. Objects are
+// merged by property and arrays of objects element by element, arrays of
+// values are replaced.
+func overlayPolicy(current, desired types.Policy) (types.Policy, error) {
+	b, err := json.Marshal(overlayValue(jsonValue(current), jsonValue(desired)))
+	if err != nil {
+		return types.Policy{}, fmt.Errorf("overlayPolicy: Failed to marshal policy. %s", err)
+	}
+	var p types.Policy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return types.Policy{}, fmt.Errorf("overlayPolicy: Failed to unmarshal policy. %s", err)
+	}
+	return p, nil
+}
+
+// Recursively overlays generic JSON value b onto a
+func overlayValue(a, b interface{}) interface{} {
+	switch bv := b.(type) {
+	case map[string]interface{}:
+		am, ok := a.(map[string]interface{})
+		if !ok {
+			return b
+		}
+		out := make(map[string]interface{}, len(am))
+		for k, v := range am {
+			out[k] = v
+		}
+		for k, v := range bv {
+			out[k] = overlayValue(am[k], v)
+		}
+		return out
+	case []interface{}:
+		al, _ := a.([]interface{})
+		out := make([]interface{}, len(bv))
+		for i, v := range bv {
+			if i < len(al) {
+				v = overlayValue(al[i], v)
+			}
+			out[i] = v
+		}
+		return out
+	}
+	return b
+}
+
+// Converts a decoded YAML value to the declared variable type
+func coerceVariable(t VariableType, v interface{}) (interface{}, error) {
+	switch t {
+	case VariableString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case VariableInt:
+		if f, ok := v.(float64); ok && f == math.Trunc(f) {
+			return int(f), nil
+		}
+		if i, ok := v.(int); ok {
+			return i, nil
+		}
+	case VariableBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case VariableList:
+		if s, ok := v.([]string); ok {
+			return s, nil
+		}
+		if l, ok := v.([]interface{}); ok {
+			out := make([]string, len(l))
+			for i, e := range l {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("list item %v is not a string", e)
+				}
+				out[i] = s
+			}
+			return out, nil
+		}
+	case VariableMap:
+		if m, ok := v.(map[string]string); ok {
+			return m, nil
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			out := make(map[string]string, len(m))
+			for k, e := range m {
+				s, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("map value %s is not a string", k)
+				}
+				out[k] = s
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("value %v is not of type %s", v, t)
+}
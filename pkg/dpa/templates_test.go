@@ -0,0 +1,284 @@
+package dpa
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+const teamTemplate = `
+policyName: {{ .team }} access
+status: Enabled
+providersData:
+  AWS:
+    accountIds: {{ json .accountIds }}
+    tags:
+    {{- range $k, $v := .tags }}
+      - Key: {{ quote $k }}
+        Value: [{{ quote $v }}]
+    {{- end }}
+userAccessRules:
+  - ruleName: {{ .team }} engineers
+    userData:
+      roles:
+        - name: {{ quote .role }}
+          source: IDENTITY
+    connectionInformation:
+      connectAs:
+        AWS:
+          ssh: ec2-user
+      grantAccess: {{ .grantHours }}
+      fullDays: true
+      timeZone: UTC
+`
+
+const teamVariables = `
+variables:
+  team: {type: string}
+  role: {type: string}
+  accountIds: {type: list}
+  tags: {type: map, default: {}}
+  grantHours: {type: int, default: 4}
+instances:
+  - team: payments
+    role: Payments Engineers
+    accountIds: ["123456789012"]
+    tags: {team: payments}
+  - team: search
+    role: Search Engineers
+    accountIds: ["210987654321", "111111111111"]
+    grantHours: 8
+`
+
+func TestReadTemplateVariables(t *testing.T) {
+	var tests = []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:  "Valid Variables",
+			input: teamVariables,
+		},
+		{
+			name:    "Invalid Type",
+			input:   "variables:\n  team: {type: number}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Default",
+			input:   "variables:\n  hours: {type: int, default: four}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Missing Required Variable",
+			input:   "variables:\n  team: {type: string}\ninstances:\n  - {}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Undeclared Variable",
+			input:   "variables:\n  team: {type: string}\ninstances:\n  - {team: a, role: b}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong Value Type",
+			input:   "variables:\n  accountIds: {type: list}\ninstances:\n  - {accountIds: 123}\n",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown Field",
+			input:   "variables: {}\nteams: []\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadTemplateVariables(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReadTemplateVariables() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyTemplateRender(t *testing.T) {
+	tmpl, err := ParsePolicyTemplate("team", teamTemplate)
+	if err != nil {
+		t.Fatalf("ParsePolicyTemplate() error = %v", err)
+	}
+	vars, err := ReadTemplateVariables(strings.NewReader(teamVariables))
+	if err != nil {
+		t.Fatalf("ReadTemplateVariables() error = %v", err)
+	}
+
+	policies, err := tmpl.RenderAll(vars)
+	if err != nil {
+		t.Fatalf("RenderAll() error = %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("RenderAll() policies = %d, want 2", len(policies))
+	}
+
+	payments, search := policies[0], policies[1]
+	if payments.PolicyName != "payments access" || payments.Status != types.PolicyStatusEnabled {
+		t.Errorf("RenderAll() policy = %+v", payments)
+	}
+	if tags := payments.ProvidersData.Aws.Tags; len(tags) != 1 || tags[0].Key != "team" || tags[0].Value[0] != "payments" {
+		t.Errorf("RenderAll() tags = %+v", tags)
+	}
+	if got := payments.UserAccessRules[0].ConnectionInformation.GrantAccess; got != 4 {
+		t.Errorf("RenderAll() default grantAccess = %d, want 4", got)
+	}
+	if got := search.ProvidersData.Aws.AccountIds; len(got) != 2 {
+		t.Errorf("RenderAll() accountIds = %v", got)
+	}
+	if got := search.UserAccessRules[0].UserData.Roles[0].Name; got != "Search Engineers" {
+		t.Errorf("RenderAll() role = %s", got)
+	}
+
+	var tests = []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+	}{
+		{
+			name:     "Missing Variable",
+			template: teamTemplate,
+			values:   map[string]interface{}{"team": "payments"},
+		},
+		{
+			name:     "Unknown Field",
+			template: "policyName: {{ .team }}\nowner: platform\n",
+			values:   map[string]interface{}{"team": "payments"},
+		},
+		{
+			name:     "Invalid Policy",
+			template: "policyName: {{ .team }}\nstatus: Enabled\n",
+			values:   map[string]interface{}{"team": "payments"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParsePolicyTemplate(tt.name, tt.template)
+			if err != nil {
+				t.Fatalf("ParsePolicyTemplate() error = %v", err)
+			}
+			if _, err := tmpl.Render(tt.values); err == nil {
+				t.Errorf("Render() expected error")
+			}
+		})
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	tmpl, _ := ParsePolicyTemplate("team", teamTemplate)
+	vars, _ := ReadTemplateVariables(strings.NewReader(teamVariables))
+	rendered, _ := tmpl.RenderAll(vars)
+
+	// The tenant has the search policy with a different grantAccess and
+	// fields the template leaves out
+	current := rendered[1]
+	current.PolicyID = "id-search"
+	current.Description = "Managed by the search team"
+	current.UserAccessRules[0].ConnectionInformation.GrantAccess = 2
+	current.UserAccessRules[0].UserData.Groups = []types.Groups{{Name: "Search On Call", Source: "AD"}}
+	currentJSON, _ := json.Marshal(current)
+
+	for _, dryRun := range []bool{true, false} {
+		var requests []string
+		var updated types.Policy
+
+		// Mock Response
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+path.Base(r.URL.Path))
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case r.Method == http.MethodGet && path.Base(r.URL.Path) == "access-policies":
+				w.Write([]byte(`{"items": [{"policyId": "id-search", "policyName": "search access"}], "totalCount": 1}`))
+			case r.Method == http.MethodGet:
+				w.Write(currentJSON)
+			case r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"policyId": "id-payments"}`))
+			default:
+				json.NewDecoder(r.Body).Decode(&updated)
+				w.Write(currentJSON)
+			}
+		}))
+
+		// Valid Service using httptest New Server URL
+		ns, _ := NewService(ts.URL, "api", false, validToken)
+
+		got, dpaerr, err := ns.ApplyTemplate(context.Background(), tmpl, vars, dryRun)
+		ts.Close()
+		if err != nil || !dpaerr.Empty() {
+			t.Fatalf("ApplyTemplate() error = %v, %v", err, dpaerr)
+		}
+		if len(got) != 2 || got[0].Action != TemplateCreate || got[1].Action != TemplateUpdate {
+			t.Fatalf("ApplyTemplate() = %+v", got)
+		}
+		if d := got[1].Differences; len(d) != 1 || d[0].Before != "2" || d[0].After != "8" {
+			t.Errorf("ApplyTemplate() differences = %+v", d)
+		}
+
+		writes := 0
+		for _, r := range requests {
+			if strings.HasPrefix(r, http.MethodPost) || strings.HasPrefix(r, http.MethodPut) {
+				writes++
+			}
+		}
+		if dryRun && (writes != 0 || got[0].Applied) {
+			t.Errorf("ApplyTemplate() dry run sent %v", requests)
+		}
+		if !dryRun && (writes != 2 || got[0].PolicyID != "id-payments" || !got[1].Applied) {
+			t.Errorf("ApplyTemplate() = %+v, sent %v", got, requests)
+		}
+		if !dryRun && (updated.Description != current.Description || len(updated.UserAccessRules[0].UserData.Groups) != 1) {
+			t.Errorf("ApplyTemplate() dropped fields the template leaves out, sent %+v", updated)
+		}
+	}
+}
+
+func TestDiffPolicies(t *testing.T) {
+	a := types.Policy{
+		PolicyID:   "id-1",
+		PolicyName: "Example Policy",
+		UserAccessRules: []types.UserAccessRules{
+			{RuleName: "Ops", UserData: types.UserData{Roles: []types.Roles{{Name: "Ops"}}}},
+		},
+	}
+	b := a
+	b.PolicyID = "id-2"
+	b.Description = "Updated"
+	b.UserAccessRules = []types.UserAccessRules{
+		{RuleName: "Ops", UserData: types.UserData{Roles: []types.Roles{{Name: "DevOps"}}}},
+	}
+
+	got := DiffPolicies(a, b)
+	if len(got) != 2 {
+		t.Fatalf("DiffPolicies() = %+v", got)
+	}
+	if got[0].Path != "description" || got[0].Before != "" || got[0].After != `"Updated"` {
+		t.Errorf("DiffPolicies() = %+v", got[0])
+	}
+	if got[1].Path != "userAccessRules[0].userData.roles[0].name" {
+		t.Errorf("DiffPolicies() = %+v", got[1])
+	}
+
+	var sb strings.Builder
+	WriteDiffText(&sb, got)
+	if !strings.HasPrefix(sb.String(), `description: (none) -> "Updated"`) {
+		t.Errorf("WriteDiffText() = %s", sb.String())
+	}
+	if len(DiffPolicies(a, a)) != 0 {
+		t.Errorf("DiffPolicies() expected no differences")
+	}
+}
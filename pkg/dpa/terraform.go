@@ -0,0 +1,368 @@
+package dpa
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+// Default resource types of the generated Terraform configuration
+const (
+	DefaultTerraformPolicyResource    = "cyberark_dpa_policy"
+	DefaultTerraformTargetSetResource = "cyberark_dpa_target_set"
+)
+
+// TerraformOptions configures the generated Terraform configuration.
+//
+//	PolicyResource - Resource type of policies (default DefaultTerraformPolicyResource)
+//	TargetSetResource - Resource type of target sets (default DefaultTerraformTargetSetResource)
+//	NoImports - Omit the import blocks
+type TerraformOptions struct {
+	PolicyResource    string `json:"policyResource,omitempty"`
+	TargetSetResource string `json:"targetSetResource,omitempty"`
+	NoImports         bool   `json:"noImports,omitempty"`
+}
+
+// WriteTerraform writes HCL resource blocks for the policies and target
+// sets, each followed by an import block adopting the existing object.
+// Attributes are the API fields in snake_case, e.g. policyName becomes
+// policy_name, and read only fields such as policyId and updatedOn are
+// omitted. Policies are imported by policy id and target sets by name.
+// Resource names are derived from the policy and target set names.
+//
+// Example:
+//
+//	policies, err := dpa.LoadPolicyFile("policies.json")
+//	if err != nil {
+//		log.Fatalf("Failed to load policies. %s", err)
+//		return
+//	}
+//	targetSets, err := dpa.LoadTargetSetsFile("targetsets.json")
+//	if err != nil {
+//		log.Fatalf("Failed to load target sets. %s", err)
+//		return
+//	}
+//	err = dpa.WriteTerraform(os.Stdout, policies, []types.TargetSetMapping{*targetSets}, dpa.TerraformOptions{})
+func WriteTerraform(w io.Writer, policies []types.Policy, targetSets []types.TargetSetMapping, opts TerraformOptions) error {
+	if len(opts.PolicyResource) == 0 {
+		opts.PolicyResource = DefaultTerraformPolicyResource
+	}
+	if len(opts.TargetSetResource) == 0 {
+		opts.TargetSetResource = DefaultTerraformTargetSetResource
+	}
+
+	bw := bufio.NewWriter(w)
+	names := map[string]bool{}
+	for _, p := range policies {
+		if len(p.PolicyID) == 0 && !opts.NoImports {
+			return fmt.Errorf("writeTerraform: Policy %q has no policy id to import", p.PolicyName)
+		}
+		id := p.PolicyID
+		p.PolicyID, p.UpdatedOn = "", ""
+
+		name := terraformName(p.PolicyName, names)
+		writeTerraformResource(bw, opts.PolicyResource, name, reflect.ValueOf(p))
+		if !opts.NoImports {
+			writeTerraformImport(bw, opts.PolicyResource, name, id)
+		}
+	}
+
+	for _, m := range targetSets {
+		for _, ts := range m.TargetSets {
+			if len(ts.Name) == 0 {
+				return fmt.Errorf("writeTerraform: Target set name cannot be empty")
+			}
+			resource := struct {
+				StrongAccountID string `json:"strong_account_id,omitempty"`
+				types.TargetSets
+			}{m.StrongAccountID, ts}
+
+			name := terraformName(ts.Name, names)
+			writeTerraformResource(bw, opts.TargetSetResource, name, reflect.ValueOf(resource))
+			if !opts.NoImports {
+				writeTerraformImport(bw, opts.TargetSetResource, name, ts.Name)
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writeTerraform: Failed to write configuration. %s", err)
+	}
+	return nil
+}
+
+// ExportTerraform writes the Terraform configuration of every policy and
+// target set of the tenant. See WriteTerraform for the format.
+// Returns types.ErrorResponse based on the response from the API. An error
+// is returned on request failure.
+//
+// Example:
+//
+//	f, _ := os.Create("dpa.tf")
+//	defer f.Close()
+//
+//	dpaerr, err := s.ExportTerraform(context.Background(), f, dpa.TerraformOptions{})
+//	if err != nil {
+//		log.Fatalf("Failed to export policies. %s", err)
+//		return
+//	}
+func (s *Service) ExportTerraform(ctx context.Context, w io.Writer, opts TerraformOptions) (*types.ErrorResponse, error) {
+	policies, dpaerr, err := s.FetchPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exportTerraform: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return dpaerr, nil
+	}
+
+	targetSets, dpaerr, err := s.FetchTargetSets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("exportTerraform: %s", err)
+	}
+	if !dpaerr.Empty() {
+		return dpaerr, nil
+	}
+
+	if err := WriteTerraform(w, policies, []types.TargetSetMapping{*targetSets}, opts); err != nil {
+		return nil, fmt.Errorf("exportTerraform: %s", err)
+	}
+	return &types.ErrorResponse{}, nil
+}
+
+// ReadTargetSets reads exported target sets formatted as JSON. The document
+// may be a ListTargetSets response, a TargetSetMapping or an array of
+// target sets.
+//
+// Example:
+//
+//	targetSets, err := dpa.ReadTargetSets(os.Stdin)
+//	if err != nil {
+//		log.Fatalf("Failed to read target sets. %s", err)
+//		return
+//	}
+func ReadTargetSets(r io.Reader) (*types.TargetSetMapping, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("readTargetSets: Failed to read target sets. %s", err)
+	}
+
+	b = bytes.TrimSpace(b)
+	var m types.TargetSetMapping
+	switch {
+	case len(b) == 0:
+		return &m, nil
+	case b[0] == '[':
+		if err := json.Unmarshal(b, &m.TargetSets); err != nil {
+			return nil, fmt.Errorf("readTargetSets: Failed to parse target sets. %s", err)
+		}
+		return &m, nil
+	case b[0] == '{':
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("readTargetSets: Failed to parse target sets. %s", err)
+		}
+		return &m, nil
+	}
+	return nil, fmt.Errorf("readTargetSets: Invalid document. Expected a JSON object or array")
+}
+
+// LoadTargetSetsFile reads exported target sets from a JSON file.
+// See ReadTargetSets for the supported formats.
+//
+// Example:
+//
+//	targetSets, err := dpa.LoadTargetSetsFile("targetsets.json")
+//	if err != nil {
+//		log.Fatalf("Failed to load target sets. %s", err)
+//		return
+//	}
+func LoadTargetSetsFile(name string) (*types.TargetSetMapping, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("loadTargetSetsFile: Failed to open target sets file. %s", err)
+	}
+	defer f.Close()
+
+	m, err := ReadTargetSets(f)
+	if err != nil {
+		return nil, fmt.Errorf("loadTargetSetsFile: %s: %s", name, err)
+	}
+	return m, nil
+}
+
+func writeTerraformResource(w *bufio.Writer, resource, name string, v reflect.Value) {
+	fmt.Fprintf(w, "resource %q %q ", resource, name)
+	writeHCLObject(w, v, "")
+	fmt.Fprint(w, "\n\n")
+}
+
+func writeTerraformImport(w *bufio.Writer, resource, name, id string) {
+	fmt.Fprintf(w, "import {\n  to = %s.%s\n  id = %s\n}\n\n", resource, name, hclString(id))
+}
+
+// Returns a unique Terraform resource name for the object name, e.g.
+// "Production Access" becomes production_access
+func terraformName(s string, used map[string]bool) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		} else if b.Len() != 0 && !strings.HasSuffix(b.String(), "_") {
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "_")
+	if len(name) == 0 || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// Writes a struct as an HCL object. Fields are named by their JSON names
+// in snake_case and fields which JSON would omit are skipped. Consecutive
+// single line attributes are aligned as terraform fmt does.
+func writeHCLObject(w *bufio.Writer, v reflect.Value, indent string) {
+	type attribute struct{ key, value string }
+	var attrs []attribute
+	collectHCLAttributes(v, func(key string, fv reflect.Value) {
+		var b bytes.Buffer
+		bw := bufio.NewWriter(&b)
+		writeHCLValue(bw, fv, indent+"  ")
+		bw.Flush()
+		attrs = append(attrs, attribute{key, b.String()})
+	})
+
+	fmt.Fprintln(w, "{")
+	for i := 0; i < len(attrs); {
+		// Align the group of single line attributes starting at i
+		j, width := i, 0
+		for ; j < len(attrs) && !strings.Contains(attrs[j].value, "\n"); j++ {
+			width = max(width, len(attrs[j].key))
+		}
+		if j == i {
+			j, width = i+1, len(attrs[i].key)
+		}
+		for ; i < j; i++ {
+			fmt.Fprintf(w, "%s  %-*s = %s\n", indent, width, attrs[i].key, attrs[i].value)
+		}
+	}
+	fmt.Fprintf(w, "%s}", indent)
+}
+
+// Calls fn with the name and value of every field JSON would encode,
+// including the fields of embedded structs
+func collectHCLAttributes(v reflect.Value, fn func(string, reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && len(name) == 0 && f.Type.Kind() == reflect.Struct {
+			collectHCLAttributes(v.Field(i), fn)
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		fv := v.Field(i)
+		empty := fv.IsZero() || (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map) && fv.Len() == 0
+		if fv.Kind() == reflect.Pointer && fv.IsNil() || strings.Contains(opts, "omitempty") && empty {
+			continue
+		}
+		fn(snakeCase(name), fv)
+	}
+}
+
+// Writes a value as an HCL expression
+func writeHCLValue(w *bufio.Writer, v reflect.Value, indent string) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			fmt.Fprint(w, "null")
+			return
+		}
+		writeHCLValue(w, v.Elem(), indent)
+	case reflect.Struct:
+		writeHCLObject(w, v, indent)
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		if k := v.Type().Elem().Kind(); k != reflect.Struct && k != reflect.Pointer {
+			items := make([]string, v.Len())
+			for i := range items {
+				var b bytes.Buffer
+				bw := bufio.NewWriter(&b)
+				writeHCLValue(bw, v.Index(i), indent)
+				bw.Flush()
+				items[i] = b.String()
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(items, ", "))
+			return
+		}
+		fmt.Fprintln(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprint(w, indent+"  ")
+			writeHCLValue(w, v.Index(i), indent+"  ")
+			fmt.Fprintln(w, ",")
+		}
+		fmt.Fprintf(w, "%s]", indent)
+	case reflect.String:
+		fmt.Fprint(w, hclString(v.String()))
+	case reflect.Bool:
+		fmt.Fprint(w, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprint(w, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprint(w, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprint(w, v.Float())
+	default:
+		fmt.Fprint(w, "null")
+	}
+}
+
+// Returns s as a quoted HCL string. Template sequences are escaped so the
+// value is used literally.
+func hclString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+	return `"` + r.Replace(s) + `"`
+}
+
+// Converts a JSON field name to snake_case, e.g. accountIds becomes
+// account_ids and OnPrem becomes on_prem
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
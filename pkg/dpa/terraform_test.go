@@ -0,0 +1,217 @@
+package dpa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/strick-j/cybr-dpa/pkg/dpa/types"
+)
+
+func TestWriteTerraform(t *testing.T) {
+	terraformPolicy := validPolicy()
+	terraformPolicy.UserAccessRules[0].RuleName = "Ops ${env}"
+	targetSets := []types.TargetSetMapping{{
+		StrongAccountID: "a0e12345-789e-12ab-abcd-d898f4cc810e",
+		TargetSets: []types.TargetSets{{
+			Name:                        "example.com",
+			EnableCertificateValidation: types.Bool(false),
+			Type:                        types.TargetSetTypeDomain,
+		}},
+	}}
+
+	var b bytes.Buffer
+	if err := WriteTerraform(&b, []types.Policy{terraformPolicy}, targetSets, TerraformOptions{}); err != nil {
+		t.Fatalf("WriteTerraform() error = %v", err)
+	}
+
+	want := `resource "cyberark_dpa_policy" "ops" {
+  policy_name = "Ops"
+  status      = "Enabled"
+  providers_data = {
+    aws = {
+      account_ids = ["111111111111"]
+    }
+  }
+  user_access_rules = [
+    {
+      rule_name = "Ops $${env}"
+      user_data = {
+        roles = [
+          {
+            name   = "Ops"
+            source = "IDENTITY"
+          },
+        ]
+      }
+      connection_information = {
+        connect_as = {
+          aws = {
+            ssh = "ec2-user"
+          }
+        }
+        grant_access = 2
+        full_days    = true
+      }
+    },
+  ]
+}
+
+import {
+  to = cyberark_dpa_policy.ops
+  id = "id-1"
+}
+
+resource "cyberark_dpa_target_set" "example_com" {
+  strong_account_id             = "a0e12345-789e-12ab-abcd-d898f4cc810e"
+  name                          = "example.com"
+  enable_certificate_validation = false
+  type                          = "Domain"
+}
+
+import {
+  to = cyberark_dpa_target_set.example_com
+  id = "example.com"
+}
+
+`
+	if b.String() != want {
+		t.Errorf("WriteTerraform() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	// Policies without an id cannot be imported
+	p := terraformPolicy
+	p.PolicyID = ""
+	if err := WriteTerraform(&b, []types.Policy{p}, nil, TerraformOptions{}); err == nil {
+		t.Errorf("WriteTerraform() expected error for policy without id")
+	}
+	b.Reset()
+	if err := WriteTerraform(&b, []types.Policy{p}, nil, TerraformOptions{PolicyResource: "custom_policy", NoImports: true}); err != nil {
+		t.Fatalf("WriteTerraform() error = %v", err)
+	}
+	if !strings.HasPrefix(b.String(), `resource "custom_policy" "ops" {`) || strings.Contains(b.String(), "import {") {
+		t.Errorf("WriteTerraform() =\n%s", b.String())
+	}
+}
+
+func TestTerraformNames(t *testing.T) {
+	used := map[string]bool{}
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{input: "Production Access", want: "production_access"},
+		{input: "production-access", want: "production_access_2"},
+		{input: "  Ops / DB (EU) ", want: "ops_db_eu"},
+		{input: "2024 Audit", want: "_2024_audit"},
+		{input: "ÜBER", want: "ber"},
+		{input: "", want: "_"},
+	}
+	for _, tt := range tests {
+		if got := terraformName(tt.input, used); got != tt.want {
+			t.Errorf("terraformName(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	for input, want := range map[string]string{
+		"policyName":                   "policy_name",
+		"AWS":                          "aws",
+		"OnPrem":                       "on_prem",
+		"enableEphemeralUserReconnect": "enable_ephemeral_user_reconnect",
+		"secret_id":                    "secret_id",
+		"HTTPServer":                   "http_server",
+	} {
+		if got := snakeCase(input); got != want {
+			t.Errorf("snakeCase(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestReadTargetSets(t *testing.T) {
+	var tests = []struct {
+		name        string
+		input       string
+		wantSets    int
+		wantAccount string
+		wantErr     bool
+	}{
+		{
+			name:     "List Response",
+			input:    `{"target_sets": [{"name": "a.com", "type": "Domain"}, {"name": "b.com", "type": "Suffix"}], "b64_last_evaluated_key": null}`,
+			wantSets: 2,
+		},
+		{
+			name:        "Mapping",
+			input:       `{"strong_account_id": "acc-1", "target_sets": [{"name": "a.com"}]}`,
+			wantSets:    1,
+			wantAccount: "acc-1",
+		},
+		{
+			name:     "Array",
+			input:    `[{"name": "a.com"}]`,
+			wantSets: 1,
+		},
+		{
+			name:    "Unknown Type",
+			input:   `[{"name": "a.com", "type": "Forest"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid Document",
+			input:   `"a.com"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadTargetSets(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadTargetSets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (len(got.TargetSets) != tt.wantSets || got.StrongAccountID != tt.wantAccount) {
+				t.Errorf("ReadTargetSets() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestExportTerraform(t *testing.T) {
+	policy := validPolicy()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/access-policies":
+			json.NewEncoder(w).Encode(types.ListPolicies{Items: []types.Items{{PolicyID: policy.PolicyID}}, TotalCount: 1})
+		case "/api/access-policies/" + policy.PolicyID:
+			json.NewEncoder(w).Encode(policy)
+		case "/api/discovery/targetsets":
+			if r.URL.Query().Get("b64StartKey") == "page-2" {
+				w.Write([]byte(`{"target_sets": [{"name": "b.com", "type": "Suffix"}]}`))
+				return
+			}
+			w.Write([]byte(`{"target_sets": [{"name": "a.com", "type": "Domain"}], "b64_last_evaluated_key": "page-2"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	// Valid Service using httptest New Server URL
+	ns, _ := NewService(ts.URL, "api", false, validToken)
+
+	var b bytes.Buffer
+	dpaerr, err := ns.ExportTerraform(context.Background(), &b, TerraformOptions{})
+	if err != nil || !dpaerr.Empty() {
+		t.Fatalf("ExportTerraform() error = %v, %v", err, dpaerr)
+	}
+	for _, want := range []string{`"cyberark_dpa_policy" "ops"`, `"cyberark_dpa_target_set" "a_com"`, `"cyberark_dpa_target_set" "b_com"`, `id = "b.com"`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("ExportTerraform() missing %s in\n%s", want, b.String())
+		}
+	}
+}
@@ -5,3 +5,9 @@ type GenerateScriptResponse struct {
 	ScriptURL string `json:"script_url,omitempty"`
 	BashCmd   string `json:"bash_cmd,omitempty"`
 }
+
+// GenerateScriptRequest is the body of a connector setup script request
+type GenerateScriptRequest struct {
+	ConnectorOS   ConnectorOS   `json:"connectorOs,omitempty"`
+	ConnectorType ConnectorType `json:"connectorType,omitempty"`
+}
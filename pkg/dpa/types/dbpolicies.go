@@ -0,0 +1,91 @@
+package types
+
+type ListDatabasePolicies struct {
+	Items      []DatabasePolicyItem `json:"items,omitempty"`
+	TotalCount int                  `json:"totalCount,omitempty"`
+}
+
+type DatabasePolicyItem struct {
+	PolicyID    string           `json:"policyId,omitempty"`
+	Status      PolicyStatus     `json:"status,omitempty"`
+	PolicyName  string           `json:"policyName,omitempty"`
+	Description string           `json:"description,omitempty"`
+	UpdatedOn   string           `json:"updatedOn,omitempty"`
+	RuleNames   []string         `json:"ruleNames,omitempty"`
+	Providers   []DatabaseEngine `json:"providers,omitempty"`
+}
+
+// DatabasePolicy grants access to databases onboarded to DPA
+type DatabasePolicy struct {
+	PolicyID        string                `json:"policyId,omitempty"`
+	PolicyName      string                `json:"policyName,omitempty"`
+	Status          PolicyStatus          `json:"status,omitempty"`
+	Description     string                `json:"description,omitempty"`
+	ProvidersData   DatabaseProvidersData `json:"providersData"`
+	StartDate       string                `json:"startDate,omitempty"`
+	EndDate         string                `json:"endDate,omitempty"`
+	UserAccessRules []DatabaseAccessRule  `json:"userAccessRules,omitempty"`
+	UpdatedOn       string                `json:"updatedOn,omitempty"`
+}
+
+// DatabaseProvidersData contains the databases of each engine covered by
+// the policy. Engines which are nil are not sent to the API.
+type DatabaseProvidersData struct {
+	MSSQL      *DatabaseResources `json:"mssql,omitempty"`
+	MySQL      *DatabaseResources `json:"mysql,omitempty"`
+	MariaDB    *DatabaseResources `json:"mariadb,omitempty"`
+	PostgreSQL *DatabaseResources `json:"postgres,omitempty"`
+	Oracle     *DatabaseResources `json:"oracle,omitempty"`
+	DB2        *DatabaseResources `json:"db2,omitempty"`
+	MongoDB    *DatabaseResources `json:"mongo,omitempty"`
+}
+
+// DatabaseResources lists the names of database targets, "*" covers every
+// database of the engine
+type DatabaseResources struct {
+	Resources []string `json:"resources,omitempty"`
+}
+
+type DatabaseAccessRule struct {
+	RuleName              string                        `json:"ruleName,omitempty"`
+	UserData              UserData                      `json:"userData"`
+	ConnectionInformation DatabaseConnectionInformation `json:"connectionInformation"`
+}
+
+type DatabaseConnectionInformation struct {
+	ConnectAs   DatabaseConnectAs `json:"connectAs"`
+	GrantAccess int               `json:"grantAccess,omitempty"`
+	IdleTime    int               `json:"idleTime,omitempty"`
+	DaysOfWeek  []DayOfWeek       `json:"daysOfWeek,omitempty"`
+	FullDays    bool              `json:"fullDays,omitempty"`
+	HoursFrom   string            `json:"hoursFrom,omitempty"`
+	HoursTo     string            `json:"hoursTo,omitempty"`
+	TimeZone    string            `json:"timeZone,omitempty"`
+}
+
+// DatabaseConnectAs contains how users authenticate to the databases of a
+// rule. DBAuth connects with an ephemeral user holding database roles,
+// LdapAuth with the user's own account added to groups and RdsIamUserAuth
+// as an AWS IAM database user.
+type DatabaseConnectAs struct {
+	DBAuth         []DatabaseRoleAuth   `json:"dbAuth,omitempty"`
+	LdapAuth       []DatabaseLdapAuth   `json:"ldapAuth,omitempty"`
+	RdsIamUserAuth *DatabaseIamUserAuth `json:"rdsIamUserAuth,omitempty"`
+}
+
+// DatabaseRoleAuth is an ephemeral user profile. The user is created with
+// the roles on the databases named in ApplyTo.
+type DatabaseRoleAuth struct {
+	Roles   []string `json:"roles,omitempty"`
+	ApplyTo []string `json:"applyTo,omitempty"`
+}
+
+type DatabaseLdapAuth struct {
+	AssignGroups []string `json:"assignGroups,omitempty"`
+	ApplyTo      []string `json:"applyTo,omitempty"`
+}
+
+type DatabaseIamUserAuth struct {
+	User    string   `json:"user,omitempty"`
+	ApplyTo []string `json:"applyTo,omitempty"`
+}
@@ -6,13 +6,13 @@ type ListTargetSetResponse struct {
 	B64LastEvaluatedKey string       `json:"b64_last_evaluated_key,omitempty"`
 }
 type TargetSets struct {
-	Name                        string `json:"name,omitempty"`
-	Description                 string `json:"description,omitempty"`
-	ProvisionFormat             string `json:"provision_format,omitempty"`
-	EnableCertificateValidation bool   `json:"enable_certificate_validation,omitempty"`
-	SecretType                  string `json:"secret_type,omitempty"`
-	SecretID                    string `json:"secret_id,omitempty"`
-	Type                        string `json:"type,omitempty"`
+	Name                        string        `json:"name,omitempty"`
+	Description                 string        `json:"description,omitempty"`
+	ProvisionFormat             string        `json:"provision_format,omitempty"`
+	EnableCertificateValidation *bool         `json:"enable_certificate_validation,omitempty"`
+	SecretType                  string        `json:"secret_type,omitempty"`
+	SecretID                    string        `json:"secret_id,omitempty"`
+	Type                        TargetSetType `json:"type,omitempty"`
 }
 
 // TargetSetMapping is the struct format utilized to post a target set to the API
@@ -0,0 +1,283 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PolicyStatus is the status of an access policy
+type PolicyStatus string
+
+const (
+	PolicyStatusEnabled    PolicyStatus = "Enabled"
+	PolicyStatusDisabled   PolicyStatus = "Disabled"
+	PolicyStatusDraft      PolicyStatus = "Draft"
+	PolicyStatusExpired    PolicyStatus = "Expired"
+	PolicyStatusValidating PolicyStatus = "Validating"
+	PolicyStatusError      PolicyStatus = "Error"
+)
+
+// PolicyStatuses lists every valid PolicyStatus
+var PolicyStatuses = []PolicyStatus{
+	PolicyStatusEnabled, PolicyStatusDisabled, PolicyStatusDraft,
+	PolicyStatusExpired, PolicyStatusValidating, PolicyStatusError,
+}
+
+// Provider is a cloud or on-premises platform as named in policy
+// providersData and connectAs blocks
+type Provider string
+
+const (
+	ProviderAWS    Provider = "AWS"
+	ProviderAzure  Provider = "Azure"
+	ProviderGCP    Provider = "GCP"
+	ProviderOnPrem Provider = "OnPrem"
+)
+
+// Providers lists every valid Provider
+var Providers = []Provider{ProviderAWS, ProviderAzure, ProviderGCP, ProviderOnPrem}
+
+// DayOfWeek is a day on which a policy rule grants access
+type DayOfWeek string
+
+const (
+	Monday    DayOfWeek = "Mon"
+	Tuesday   DayOfWeek = "Tue"
+	Wednesday DayOfWeek = "Wed"
+	Thursday  DayOfWeek = "Thu"
+	Friday    DayOfWeek = "Fri"
+	Saturday  DayOfWeek = "Sat"
+	Sunday    DayOfWeek = "Sun"
+)
+
+// DaysOfWeek lists every valid DayOfWeek starting on Monday
+var DaysOfWeek = []DayOfWeek{Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday}
+
+// ConnectorOS is the operating system of a DPA connector
+type ConnectorOS string
+
+const (
+	ConnectorOSLinux   ConnectorOS = "linux"
+	ConnectorOSWindows ConnectorOS = "windows"
+	ConnectorOSDarwin  ConnectorOS = "darwin"
+)
+
+// ConnectorOSes lists every valid ConnectorOS
+var ConnectorOSes = []ConnectorOS{ConnectorOSLinux, ConnectorOSWindows, ConnectorOSDarwin}
+
+// ConnectorType is the platform a DPA connector is deployed to
+type ConnectorType string
+
+const (
+	ConnectorTypeAWS       ConnectorType = "AWS"
+	ConnectorTypeAzure     ConnectorType = "AZURE"
+	ConnectorTypeGCP       ConnectorType = "GCP"
+	ConnectorTypeOnPremise ConnectorType = "ON-PREMISE"
+)
+
+// ConnectorTypes lists every valid ConnectorType
+var ConnectorTypes = []ConnectorType{ConnectorTypeAWS, ConnectorTypeAzure, ConnectorTypeGCP, ConnectorTypeOnPremise}
+
+// FeatureName is the name of a DPA settings feature
+type FeatureName string
+
+const (
+	FeatureMfaCaching            FeatureName = "MFA_CACHING"
+	FeatureStandingAccess        FeatureName = "STANDING_ACCESS"
+	FeatureSSHCommandAudit       FeatureName = "SSH_COMMAND_AUDIT"
+	FeatureRdpFileTransfer       FeatureName = "RDP_FILE_TRANSFER"
+	FeatureCertificateValidation FeatureName = "CERTIFICATE_VALIDATION"
+)
+
+// FeatureNames lists every valid FeatureName
+var FeatureNames = []FeatureName{
+	FeatureMfaCaching, FeatureStandingAccess, FeatureSSHCommandAudit,
+	FeatureRdpFileTransfer, FeatureCertificateValidation,
+}
+
+// TargetSetType is the type of a discovery target set
+type TargetSetType string
+
+const (
+	TargetSetTypeDomain TargetSetType = "Domain"
+	TargetSetTypeSuffix TargetSetType = "Suffix"
+	TargetSetTypeTarget TargetSetType = "Target"
+)
+
+// TargetSetTypes lists every valid TargetSetType
+var TargetSetTypes = []TargetSetType{TargetSetTypeDomain, TargetSetTypeSuffix, TargetSetTypeTarget}
+
+// DatabaseEngine is a database engine as named in database policy
+// providersData blocks
+type DatabaseEngine string
+
+const (
+	DatabaseEngineMSSQL      DatabaseEngine = "mssql"
+	DatabaseEngineMySQL      DatabaseEngine = "mysql"
+	DatabaseEngineMariaDB    DatabaseEngine = "mariadb"
+	DatabaseEnginePostgreSQL DatabaseEngine = "postgres"
+	DatabaseEngineOracle     DatabaseEngine = "oracle"
+	DatabaseEngineDB2        DatabaseEngine = "db2"
+	DatabaseEngineMongoDB    DatabaseEngine = "mongo"
+)
+
+// DatabaseEngines lists every valid DatabaseEngine
+var DatabaseEngines = []DatabaseEngine{
+	DatabaseEngineMSSQL, DatabaseEngineMySQL, DatabaseEngineMariaDB, DatabaseEnginePostgreSQL,
+	DatabaseEngineOracle, DatabaseEngineDB2, DatabaseEngineMongoDB,
+}
+
+// KubernetesPlatform is a Kubernetes distribution as named in Kubernetes
+// policy providersData blocks
+type KubernetesPlatform string
+
+const (
+	KubernetesPlatformEKS         KubernetesPlatform = "EKS"
+	KubernetesPlatformAKS         KubernetesPlatform = "AKS"
+	KubernetesPlatformGKE         KubernetesPlatform = "GKE"
+	KubernetesPlatformSelfManaged KubernetesPlatform = "SelfManaged"
+)
+
+// KubernetesPlatforms lists every valid KubernetesPlatform
+var KubernetesPlatforms = []KubernetesPlatform{
+	KubernetesPlatformEKS, KubernetesPlatformAKS, KubernetesPlatformGKE, KubernetesPlatformSelfManaged,
+}
+
+// Valid reports whether s is a known policy status
+func (s PolicyStatus) Valid() bool { return slices.Contains(PolicyStatuses, s) }
+
+// Valid reports whether p is a known provider
+func (p Provider) Valid() bool { return slices.Contains(Providers, p) }
+
+// Valid reports whether d is a known day of the week
+func (d DayOfWeek) Valid() bool { return slices.Contains(DaysOfWeek, d) }
+
+// Valid reports whether o is a known connector operating system
+func (o ConnectorOS) Valid() bool { return slices.Contains(ConnectorOSes, o) }
+
+// Valid reports whether c is a known connector type
+func (c ConnectorType) Valid() bool { return slices.Contains(ConnectorTypes, c) }
+
+// Valid reports whether f is a known settings feature
+func (f FeatureName) Valid() bool { return slices.Contains(FeatureNames, f) }
+
+// Valid reports whether t is a known target set type
+func (t TargetSetType) Valid() bool { return slices.Contains(TargetSetTypes, t) }
+
+// Valid reports whether e is a known database engine
+func (e DatabaseEngine) Valid() bool { return slices.Contains(DatabaseEngines, e) }
+
+// Valid reports whether p is a known Kubernetes platform
+func (p KubernetesPlatform) Valid() bool { return slices.Contains(KubernetesPlatforms, p) }
+
+// The text marshalers below reject unknown values so typos fail when a
+// request is encoded or a file is decoded. An empty value is treated as
+// unset and passes through unchanged.
+
+func (s PolicyStatus) MarshalText() ([]byte, error) {
+	return marshalEnum("policy status", s, PolicyStatuses)
+}
+
+func (s *PolicyStatus) UnmarshalText(b []byte) error {
+	return unmarshalEnum("policy status", b, s, PolicyStatuses)
+}
+
+func (p Provider) MarshalText() ([]byte, error) {
+	return marshalEnum("provider", p, Providers)
+}
+
+func (p *Provider) UnmarshalText(b []byte) error {
+	return unmarshalEnum("provider", b, p, Providers)
+}
+
+func (d DayOfWeek) MarshalText() ([]byte, error) {
+	return marshalEnum("day of week", d, DaysOfWeek)
+}
+
+func (d *DayOfWeek) UnmarshalText(b []byte) error {
+	return unmarshalEnum("day of week", b, d, DaysOfWeek)
+}
+
+func (o ConnectorOS) MarshalText() ([]byte, error) {
+	return marshalEnum("connector OS", o, ConnectorOSes)
+}
+
+func (o *ConnectorOS) UnmarshalText(b []byte) error {
+	return unmarshalEnum("connector OS", b, o, ConnectorOSes)
+}
+
+func (c ConnectorType) MarshalText() ([]byte, error) {
+	return marshalEnum("connector type", c, ConnectorTypes)
+}
+
+func (c *ConnectorType) UnmarshalText(b []byte) error {
+	return unmarshalEnum("connector type", b, c, ConnectorTypes)
+}
+
+func (f FeatureName) MarshalText() ([]byte, error) {
+	return marshalEnum("feature name", f, FeatureNames)
+}
+
+func (f *FeatureName) UnmarshalText(b []byte) error {
+	return unmarshalEnum("feature name", b, f, FeatureNames)
+}
+
+func (t TargetSetType) MarshalText() ([]byte, error) {
+	return marshalEnum("target set type", t, TargetSetTypes)
+}
+
+func (t *TargetSetType) UnmarshalText(b []byte) error {
+	return unmarshalEnum("target set type", b, t, TargetSetTypes)
+}
+
+func (e DatabaseEngine) MarshalText() ([]byte, error) {
+	return marshalEnum("database engine", e, DatabaseEngines)
+}
+
+func (e *DatabaseEngine) UnmarshalText(b []byte) error {
+	return unmarshalEnum("database engine", b, e, DatabaseEngines)
+}
+
+func (p KubernetesPlatform) MarshalText() ([]byte, error) {
+	return marshalEnum("Kubernetes platform", p, KubernetesPlatforms)
+}
+
+func (p *KubernetesPlatform) UnmarshalText(b []byte) error {
+	return unmarshalEnum("Kubernetes platform", b, p, KubernetesPlatforms)
+}
+
+// EnumError is returned when a value is not one of the valid options
+type EnumError struct {
+	Kind  string
+	Value string
+	Valid []string
+}
+
+func (e *EnumError) Error() string {
+	return fmt.Sprintf("Invalid %s %q. Valid options are %s", e.Kind, e.Value, strings.Join(e.Valid, ", "))
+}
+
+func marshalEnum[T ~string](kind string, v T, valid []T) ([]byte, error) {
+	if v != "" && !slices.Contains(valid, v) {
+		return nil, enumError(kind, string(v), valid)
+	}
+	return []byte(v), nil
+}
+
+func unmarshalEnum[T ~string](kind string, b []byte, v *T, valid []T) error {
+	s := T(b)
+	if s != "" && !slices.Contains(valid, s) {
+		return enumError(kind, string(s), valid)
+	}
+	*v = s
+	return nil
+}
+
+func enumError[T ~string](kind, value string, valid []T) error {
+	names := make([]string, len(valid))
+	for i, v := range valid {
+		names[i] = string(v)
+	}
+	return &EnumError{Kind: kind, Value: value, Valid: names}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "fmt"
+
 // error response
 type ErrorResponse struct {
 	Code        string                `json:"code,omitempty"`
@@ -16,3 +18,20 @@ type NestedErrorResponse struct {
 	Description string `json:"description,omitempty"`
 	Field       string `json:"field,omitempty"`
 }
+
+// Error allows an ErrorResponse to be returned as an error
+func (e *ErrorResponse) Error() string {
+	msg := e.Description
+	if len(msg) == 0 {
+		msg = e.Message
+	}
+	if len(e.Code) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", e.Code, msg)
+}
+
+// Empty reports whether the API returned no error details
+func (e *ErrorResponse) Empty() bool {
+	return e == nil || (len(e.Code) == 0 && len(e.Message) == 0 && len(e.Description) == 0 && len(e.Errors) == 0)
+}
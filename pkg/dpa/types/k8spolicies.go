@@ -0,0 +1,77 @@
+package types
+
+type ListKubernetesPolicies struct {
+	Items      []KubernetesPolicyItem `json:"items,omitempty"`
+	TotalCount int                    `json:"totalCount,omitempty"`
+}
+
+type KubernetesPolicyItem struct {
+	PolicyID    string               `json:"policyId,omitempty"`
+	Status      PolicyStatus         `json:"status,omitempty"`
+	PolicyName  string               `json:"policyName,omitempty"`
+	Description string               `json:"description,omitempty"`
+	UpdatedOn   string               `json:"updatedOn,omitempty"`
+	RuleNames   []string             `json:"ruleNames,omitempty"`
+	Platforms   []KubernetesPlatform `json:"platforms,omitempty"`
+}
+
+// KubernetesPolicy grants access to Kubernetes clusters
+type KubernetesPolicy struct {
+	PolicyID        string                  `json:"policyId,omitempty"`
+	PolicyName      string                  `json:"policyName,omitempty"`
+	Status          PolicyStatus            `json:"status,omitempty"`
+	Description     string                  `json:"description,omitempty"`
+	ProvidersData   KubernetesProvidersData `json:"providersData"`
+	StartDate       string                  `json:"startDate,omitempty"`
+	EndDate         string                  `json:"endDate,omitempty"`
+	UserAccessRules []KubernetesAccessRule  `json:"userAccessRules,omitempty"`
+	UpdatedOn       string                  `json:"updatedOn,omitempty"`
+}
+
+// KubernetesProvidersData contains the clusters of each platform covered
+// by the policy. Platforms which are nil are not sent to the API.
+type KubernetesProvidersData struct {
+	EKS         *KubernetesClusters `json:"EKS,omitempty"`
+	AKS         *KubernetesClusters `json:"AKS,omitempty"`
+	GKE         *KubernetesClusters `json:"GKE,omitempty"`
+	SelfManaged *KubernetesClusters `json:"SelfManaged,omitempty"`
+}
+
+// KubernetesClusters selects clusters by name or by label. Namespaces
+// limits access to the namespaces listed, every namespace when empty.
+type KubernetesClusters struct {
+	ClusterNames []string `json:"clusterNames,omitempty"`
+	Labels       []Labels `json:"labels,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty"`
+}
+
+type KubernetesAccessRule struct {
+	RuleName              string                          `json:"ruleName,omitempty"`
+	UserData              UserData                        `json:"userData"`
+	ConnectionInformation KubernetesConnectionInformation `json:"connectionInformation"`
+}
+
+type KubernetesConnectionInformation struct {
+	ConnectAs   KubernetesConnectAs `json:"connectAs"`
+	GrantAccess int                 `json:"grantAccess,omitempty"`
+	IdleTime    int                 `json:"idleTime,omitempty"`
+	DaysOfWeek  []DayOfWeek         `json:"daysOfWeek,omitempty"`
+	FullDays    bool                `json:"fullDays,omitempty"`
+	HoursFrom   string              `json:"hoursFrom,omitempty"`
+	HoursTo     string              `json:"hoursTo,omitempty"`
+	TimeZone    string              `json:"timeZone,omitempty"`
+}
+
+// KubernetesConnectAs contains the Kubernetes identity of a rule's users.
+// Users are impersonated with the Groups, and bound to the ClusterRoles
+// across the cluster and the Roles within their namespace.
+type KubernetesConnectAs struct {
+	Groups       []string         `json:"groups,omitempty"`
+	ClusterRoles []string         `json:"clusterRoles,omitempty"`
+	Roles        []KubernetesRole `json:"roles,omitempty"`
+}
+
+type KubernetesRole struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
@@ -0,0 +1,16 @@
+package types
+
+// Bool returns a pointer to the provided value for use in optional fields
+func Bool(v bool) *bool {
+	return &v
+}
+
+// Int returns a pointer to the provided value for use in optional fields
+func Int(v int) *int {
+	return &v
+}
+
+// String returns a pointer to the provided value for use in optional fields
+func String(v string) *string {
+	return &v
+}
@@ -11,25 +11,26 @@ type ListPolicies struct {
 	TotalCount int     `json:"totalCount,omitempty"`
 }
 type Items struct {
-	PolicyID    string   `json:"policyId,omitempty"`
-	Status      string   `json:"status,omitempty"`
-	PolicyName  string   `json:"policyName,omitempty"`
-	Description string   `json:"description,omitempty"`
-	UpdatedOn   string   `json:"updatedOn,omitempty"`
-	RuleNames   []string `json:"ruleNames,omitempty"`
-	Platforms   []string `json:"platforms,omitempty"`
+	PolicyID    string       `json:"policyId,omitempty"`
+	Status      PolicyStatus `json:"status,omitempty"`
+	PolicyName  string       `json:"policyName,omitempty"`
+	Description string       `json:"description,omitempty"`
+	UpdatedOn   string       `json:"updatedOn,omitempty"`
+	RuleNames   []string     `json:"ruleNames,omitempty"`
+	Platforms   []Provider   `json:"platforms,omitempty"`
 }
 
 // Get policy response from getting a policy
 type Policy struct {
 	PolicyID        string            `json:"policyId,omitempty"`
 	PolicyName      string            `json:"policyName,omitempty"`
-	Status          string            `json:"status,omitempty"`
+	Status          PolicyStatus      `json:"status,omitempty"`
 	Description     string            `json:"description,omitempty"`
-	ProvidersData   ProvidersData     `json:"providersData,omitempty"`
+	ProvidersData   ProvidersData     `json:"providersData"`
 	StartDate       string            `json:"startDate,omitempty"`
 	EndDate         string            `json:"endDate,omitempty"`
 	UserAccessRules []UserAccessRules `json:"userAccessRules,omitempty"`
+	UpdatedOn       string            `json:"updatedOn,omitempty"`
 }
 type Tags struct {
 	Key   string   `json:"Key,omitempty"`
@@ -67,11 +68,14 @@ type Gcp struct {
 	VpcIds   []string `json:"vpc_ids,omitempty"`
 	Projects []string `json:"projects,omitempty"`
 }
+
+// ProvidersData contains the target scope of each provider. Providers
+// which are nil are not part of the policy and are not sent to the API.
 type ProvidersData struct {
-	Aws    Aws    `json:"AWS,omitempty"`
-	Azure  Azure  `json:"Azure,omitempty"`
-	OnPrem OnPrem `json:"OnPrem,omitempty"`
-	Gcp    Gcp    `json:"GCP,omitempty"`
+	Aws    *Aws    `json:"AWS,omitempty"`
+	Azure  *Azure  `json:"Azure,omitempty"`
+	OnPrem *OnPrem `json:"OnPrem,omitempty"`
+	Gcp    *Gcp    `json:"GCP,omitempty"`
 }
 
 type Roles struct {
@@ -88,7 +92,7 @@ type Users struct {
 }
 type UserData struct {
 	Roles  []Roles  `json:"roles,omitempty"`
-	Groups []Groups `json:"Groups,omitempty"`
+	Groups []Groups `json:"groups,omitempty"`
 	Users  []Users  `json:"users,omitempty"`
 }
 type UserDataAttributes struct {
@@ -96,43 +100,68 @@ type UserDataAttributes struct {
 	Source string `json:"source,omitempty"`
 }
 
+// LocalEphemeralUser connects RDP sessions as a temporary local account
+// which is added to the AssignGroups
 type LocalEphemeralUser struct {
 	AssignGroups []string `json:"assignGroups,omitempty"`
 }
+
+// DomainEphemeralUser connects RDP sessions as a temporary domain account.
+// The account is added to the local AssignGroups on the target and to the
+// AssignDomainGroups in the domain.
+type DomainEphemeralUser struct {
+	AssignGroups                 []string `json:"assignGroups,omitempty"`
+	AssignDomainGroups           []string `json:"assignDomainGroups,omitempty"`
+	EnableEphemeralUserReconnect *bool    `json:"enableEphemeralUserReconnect,omitempty"`
+}
+
+// Rdp sets the account RDP sessions connect as. One of LocalEphemeralUser,
+// DomainEphemeralUser or User, the name of an existing account, is set.
 type Rdp struct {
-	LocalEphemeralUser LocalEphemeralUser `json:"localEphemeralUser,omitempty"`
+	LocalEphemeralUser  *LocalEphemeralUser  `json:"localEphemeralUser,omitempty"`
+	DomainEphemeralUser *DomainEphemeralUser `json:"domainEphemeralUser,omitempty"`
+	User                string               `json:"user,omitempty"`
 }
+
+// The connect as blocks of every provider support SSH, the name of an
+// existing account, and RDP
 type ConnectAsAws struct {
 	SSH string `json:"ssh,omitempty"`
-	Rdp Rdp    `json:"rdp,omitempty"`
+	Rdp *Rdp   `json:"rdp,omitempty"`
 }
 type ConnectAsAzure struct {
 	SSH string `json:"ssh,omitempty"`
+	Rdp *Rdp   `json:"rdp,omitempty"`
 }
 type ConnectAsOnPrem struct {
-	Rdp Rdp `json:"rdp,omitempty"`
+	SSH string `json:"ssh,omitempty"`
+	Rdp *Rdp   `json:"rdp,omitempty"`
 }
 type ConnectAsGcp struct {
 	SSH string `json:"ssh,omitempty"`
+	Rdp *Rdp   `json:"rdp,omitempty"`
 }
+
+// ConnectAs contains the connect as user of each provider. Providers
+// which are nil are not sent to the API.
 type ConnectAs struct {
-	Aws    ConnectAsAws    `json:"AWS,omitempty"`
-	Azure  ConnectAsAzure  `json:"Azure,omitempty"`
-	OnPrem ConnectAsOnPrem `json:"OnPrem,omitempty"`
-	Gcp    ConnectAsGcp    `json:"GCP,omitempty"`
+	Aws    *ConnectAsAws    `json:"AWS,omitempty"`
+	Azure  *ConnectAsAzure  `json:"Azure,omitempty"`
+	OnPrem *ConnectAsOnPrem `json:"OnPrem,omitempty"`
+	Gcp    *ConnectAsGcp    `json:"GCP,omitempty"`
 }
 type ConnectionInformation struct {
-	ConnectAs   ConnectAs `json:"connectAs,omitempty"`
-	GrantAccess int       `json:"grantAccess,omitempty"`
-	IdleTime    int       `json:"idleTime,omitempty"`
-	DaysOfWeek  []string  `json:"daysOfWeek,omitempty"`
-	FullDays    bool      `json:"fullDays,omitempty"`
-	HoursFrom   string    `json:"hoursFrom,omitempty"`
-	HoursTo     string    `json:"hoursTo,omitempty"`
-	TimeZone    string    `json:"timeZone,omitempty"`
+	ConnectAs   ConnectAs   `json:"connectAs"`
+	GrantAccess int         `json:"grantAccess,omitempty"`
+	IdleTime    int         `json:"idleTime,omitempty"`
+	DaysOfWeek  []DayOfWeek `json:"daysOfWeek,omitempty"`
+	FullDays    bool        `json:"fullDays,omitempty"`
+	HoursFrom   string      `json:"hoursFrom,omitempty"`
+	HoursTo     string      `json:"hoursTo,omitempty"`
+	TimeZone    string      `json:"timeZone,omitempty"`
 }
 type UserAccessRules struct {
 	RuleName              string                `json:"ruleName,omitempty"`
-	UserData              UserData              `json:"userData,omitempty"`
-	ConnectionInformation ConnectionInformation `json:"connectionInformation,omitempty"`
+	UserData              UserData              `json:"userData"`
+	ConnectionInformation ConnectionInformation `json:"connectionInformation"`
 }
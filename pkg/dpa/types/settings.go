@@ -1,45 +1,48 @@
 package types
 
+// Settings contains the configuration of each DPA feature. Features which
+// are nil are not sent to the API, so UpdateSettings only changes the
+// features which are set.
 type Settings struct {
-	MfaCaching            MfaCaching            `json:"mfaCaching,omitempty"`
-	SSHCommandAudit       SSHCommandAudit       `json:"sshCommandAudit,omitempty"`
-	StandingAccess        StandingAccess        `json:"standingAccess,omitempty"`
-	RdpFileTransfer       RdpFileTransfer       `json:"rdpFileTransfer,omitempty"`
-	CertificateValidation CertificateValidation `json:"certificateValidation,omitempty"`
+	MfaCaching            *MfaCaching            `json:"mfaCaching,omitempty"`
+	SSHCommandAudit       *SSHCommandAudit       `json:"sshCommandAudit,omitempty"`
+	StandingAccess        *StandingAccess        `json:"standingAccess,omitempty"`
+	RdpFileTransfer       *RdpFileTransfer       `json:"rdpFileTransfer,omitempty"`
+	CertificateValidation *CertificateValidation `json:"certificateValidation,omitempty"`
 }
 
 type MfaCaching struct {
-	IsMfaCachingEnabled  bool `json:"isMfaCachingEnabled,omitempty"`
-	KeyExpirationTimeSec int  `json:"keyExpirationTimeSec,omitempty"`
+	IsMfaCachingEnabled  *bool `json:"isMfaCachingEnabled,omitempty"`
+	KeyExpirationTimeSec *int  `json:"keyExpirationTimeSec,omitempty"`
 }
 
 type SSHCommandAudit struct {
-	IsCommandParsingForAuditEnabled bool   `json:"isCommandParsingForAuditEnabled,omitempty"`
-	ShellPromptForAudit             string `json:"shellPromptForAudit,omitempty"`
+	IsCommandParsingForAuditEnabled *bool   `json:"isCommandParsingForAuditEnabled,omitempty"`
+	ShellPromptForAudit             *string `json:"shellPromptForAudit,omitempty"`
 }
 
 type StandingAccess struct {
-	StandingAccessAvailable bool `json:"standingAccessAvailable,omitempty"`
-	SessionMaxDuration      int  `json:"sessionMaxDuration,omitempty"`
-	SessionIdleTime         int  `json:"sessionIdleTime,omitempty"`
+	StandingAccessAvailable *bool `json:"standingAccessAvailable,omitempty"`
+	SessionMaxDuration      *int  `json:"sessionMaxDuration,omitempty"`
+	SessionIdleTime         *int  `json:"sessionIdleTime,omitempty"`
 }
 
 type RdpFileTransfer struct {
-	Enabled bool `json:"enabled,omitempty"`
+	Enabled *bool `json:"enabled,omitempty"`
 }
 
 type CertificateValidation struct {
-	Enabled bool `json:"enabled,omitempty"`
+	Enabled *bool `json:"enabled,omitempty"`
 }
 
 type FeatureSetting struct {
-	FeatureName string      `json:"featureName,omitempty"`
-	FeatureConf FeatureConf `json:"featureConf,omitempty"`
+	FeatureName FeatureName  `json:"feature_name,omitempty"`
+	FeatureConf *FeatureConf `json:"feature_conf,omitempty"`
 }
 
 type FeatureConf struct {
-	IsMfaCachingEnabled             bool   `json:"isMfaCachingEnabled,omitempty"`
-	KeyExpirationTimeSec            int    `json:"keyExpirationTimeSec,omitempty"`
-	IsCommandParsingForAuditEnabled bool   `json:"isCommandParsingForAuditEnabled,omitempty"`
-	ShellPromptForAudit             string `json:"shellPromptForAudit,omitempty"`
+	IsMfaCachingEnabled             *bool   `json:"is_mfa_caching_enabled,omitempty"`
+	KeyExpirationTimeSec            *int    `json:"key_expiration_time_sec,omitempty"`
+	IsCommandParsingForAuditEnabled *bool   `json:"is_command_parsing_for_audit_enabled,omitempty"`
+	ShellPromptForAudit             *string `json:"shell_prompt_for_audit,omitempty"`
 }